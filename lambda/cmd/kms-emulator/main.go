@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"lambda-ca-kms/internal/services/kmsemu"
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+// Emulador local do KMS. Para usá-lo com o SDK sem alterar código:
+//
+//	AWS_ENDPOINT_URL_KMS=http://localhost:4599 AWS_REGION=us-east-1 \
+//	AWS_ACCESS_KEY_ID=local AWS_SECRET_ACCESS_KEY=local go run ./cmd/local
+func main() {
+	addr := flag.String("addr", ":4599", "endereço de escuta")
+	statePath := flag.String("state", "kms-state.json", "arquivo de estado com chaves e aliases")
+	region := flag.String("region", "us-east-1", "região usada nos ARNs")
+	account := flag.String("account", "000000000000", "conta usada nos ARNs")
+	autoCreate := flag.Bool("auto-create", false, "cria chaves ECC_NIST_P256 para KeyIds desconhecidos")
+	flag.Parse()
+
+	opts := []softkms.Option{softkms.WithARNScope(*region, *account)}
+	if !*autoCreate {
+		opts = append(opts, softkms.WithStrictKeys())
+	}
+	backend, err := softkms.NewWithState(*statePath, opts...)
+	if err != nil {
+		log.Fatalf("erro ao carregar estado %s: %v", *statePath, err)
+	}
+
+	log.Printf("Emulador de KMS ouvindo em %s (estado: %s)", *addr, *statePath)
+	log.Fatal(http.ListenAndServe(*addr, kmsemu.NewServer(backend)))
+}
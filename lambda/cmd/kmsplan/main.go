@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"lambda-ca-kms/internal/services/keymanager"
+)
+
+// Planejador da rotação de chaves: mostra, para cada transição entre -from e
+// -to, a chave ativa e as publicadas de cada grupo, e aponta períodos sem chave
+// ativa, assinante do JWKS expirado e sobreposições menores que a vida do token.
+//
+//	go run ./cmd/kmsplan -config config/kms-keys.yaml -from 2025-01-01 -to 2026-01-01 -token-ttl 12h
+//	go run ./cmd/kmsplan -config ssm:///lambda-ca/kms-keys -fail-on-warn
+func main() {
+	configURI := flag.String("config", "", "URI da configuração (file, env, ssm, secretsmanager, s3); padrão: KMS_CONFIG_SOURCE ou KMS_CONFIG_PATH")
+	fromFlag := flag.String("from", "", "início da simulação (RFC 3339 ou AAAA-MM-DD); padrão: agora")
+	toFlag := flag.String("to", "", "fim da simulação (RFC 3339 ou AAAA-MM-DD); padrão: from + 1 ano")
+	tokenTTL := flag.Duration("token-ttl", 24*time.Hour, "tempo de vida dos tokens assinados")
+	failOnWarn := flag.Bool("fail-on-warn", false, "sai com código 1 se houver alertas")
+	issuer := flag.String("issuer", "", "nome do issuer em issuers; vazio: chaves do nível raiz")
+	flag.Parse()
+
+	uri := *configURI
+	if uri == "" {
+		uri = os.Getenv("KMS_CONFIG_SOURCE")
+	}
+	if uri == "" {
+		uri = os.Getenv("KMS_CONFIG_PATH")
+	}
+	if uri == "" {
+		uri = "config/kms-keys.yaml"
+	}
+	ctx := context.Background()
+	source, err := keymanager.OpenConfigSource(ctx, uri)
+	if err != nil {
+		log.Fatalf("origem de configuração inválida: %v", err)
+	}
+	cfg, err := source.Load(ctx)
+	if err != nil {
+		log.Fatalf("erro ao carregar %s: %v", source, err)
+	}
+	if *issuer != "" {
+		if cfg = cfg.Issuers[*issuer]; cfg == nil {
+			log.Fatalf("issuer %q não está em issuers", *issuer)
+		}
+	}
+
+	from := time.Now().UTC()
+	if *fromFlag != "" {
+		if from, err = parseDate(*fromFlag); err != nil {
+			log.Fatalf("-from inválido: %v", err)
+		}
+	}
+	to := from.AddDate(1, 0, 0)
+	if *toFlag != "" {
+		if to, err = parseDate(*toFlag); err != nil {
+			log.Fatalf("-to inválido: %v", err)
+		}
+	}
+
+	timeline := keymanager.PlanTimeline(cfg, from, to, *tokenTTL)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANTE\tGRUPO\tATIVA\tPUBLICADAS")
+	for _, tr := range timeline.Transitions {
+		for _, group := range keymanager.Groups {
+			state := tr.Groups[group]
+			active := state.Active
+			if active == "" {
+				active = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tr.At.Format(time.RFC3339), group, active, strings.Join(state.Published, ", "))
+		}
+	}
+	w.Flush()
+
+	if len(timeline.Warnings) == 0 {
+		fmt.Println("\nNenhum problema encontrado.")
+		return
+	}
+	fmt.Printf("\n%d alerta(s):\n", len(timeline.Warnings))
+	for _, warning := range timeline.Warnings {
+		fmt.Println("  " + warning.String())
+	}
+	if *failOnWarn {
+		os.Exit(1)
+	}
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"lambda-ca-kms/handlers"
+)
+
+// Rotação de chaves sob demanda: cria no KMS as sucessoras das chaves que
+// atingem max_key_age_days em menos de rotate_lead_days e acrescenta as
+// entradas na configuração. A auditoria (uma linha JSON por chave) vai para a
+// saída padrão.
+//
+//	go run ./cmd/kmsrotate -config s3://lambda-ca-config/kms-keys.yaml -dry-run
+func main() {
+	source := flag.String("config", "", "URI da configuração gravável (file, secretsmanager, s3; ssm é somente leitura); padrão: KMS_CONFIG_SOURCE ou KMS_CONFIG_PATH")
+	dryRun := flag.Bool("dry-run", false, "só mostra as rotações devidas, sem criar chaves nem gravar a configuração")
+	timeout := flag.Duration("timeout", 2*time.Minute, "tempo máximo da execução")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	result, err := handlers.RunRotation(ctx, *source, *dryRun, os.Stdout)
+	if result != nil {
+		fmt.Fprintf(os.Stderr, "configuração %s: %d rotação(ões)\n", result.ConfigVersion, len(result.Records))
+	}
+	if err != nil {
+		log.Fatalf("erro na rotação: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"lambda-ca-kms/handlers"
+)
+
+// Rotação agendada por uma regra do EventBridge. Usa a mesma configuração do
+// serviço (KMS_CONFIG_SOURCE); ROTATION_DRY_RUN=true só registra as rotações
+// devidas. A auditoria vai para o CloudWatch Logs.
+func main() {
+	lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+		result, err := handlers.RunRotation(ctx, "", os.Getenv("ROTATION_DRY_RUN") == "true", os.Stdout)
+		if result != nil {
+			log.Printf("evento %s: configuração %s, %d rotação(ões)", event.ID, result.ConfigVersion, len(result.Records))
+		}
+		return err
+	})
+}
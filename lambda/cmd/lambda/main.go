@@ -5,26 +5,20 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"lambda-ca-kms/handlers"
-	"net/http"
+	"log"
 )
 
 func init() {
-	handlers.InitKMS()
+	if err := handlers.InitKMS(); err != nil {
+		log.Fatalf("erro ao carregar chaves do KMS: %v", err)
+	}
 }
 func main() {
 	lambda.Start(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		switch req.Path {
-		case "/sign-csr":
-			return handlers.HandleSignCSR(ctx, req)
-		case "/sign-jwt":
-			return handlers.HandleSignJWT(ctx, req)
-		case "/public-key":
-			return handlers.HandleGetPublicKey(ctx, req)
-		default:
-			return events.APIGatewayProxyResponse{
-				StatusCode: http.StatusNotFound,
-				Body:       "rota não encontrada",
-			}, nil
-		}
+		// Em invocações quentes, recarrega a configuração quando o snapshot passa de KMS_RELOAD_INTERVAL
+		handlers.ReloadKeys(ctx)
+
+		// Rotas por issuer: Host ou prefixo de caminho (ver "issuers" no YAML)
+		return handlers.Route(ctx, req)
 	})
 }
@@ -2,48 +2,140 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"io"
 	"lambda-ca-kms/handlers"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 func init() {
-	handlers.InitKMS()
+	if err := handlers.InitKMS(); err != nil {
+		log.Fatalf("erro ao carregar chaves do KMS: %v", err)
+	}
 }
 
 func main() {
-	http.HandleFunc("/sign-csr", func(w http.ResponseWriter, r *http.Request) {
+	go reloadLoop()
+
+	// Todas as rotas passam pelo mesmo roteador da Lambda, inclusive os
+	// prefixos e hosts dos issuers
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		body, _ := io.ReadAll(r.Body)
-		resp, _ := handlers.HandleSignCSR(context.Background(), wrapRequest(string(body)))
+		resp, _ := handlers.Route(r.Context(), wrapRequest(r, string(body)))
+		for k, v := range resp.Headers {
+			w.Header().Set(k, v)
+		}
 		w.WriteHeader(resp.StatusCode)
 		fmt.Fprint(w, resp.Body)
 	})
+	// Só loopback: o servidor não tem a autenticação do API Gateway
+	log.Println("Servidor local ouvindo em http://127.0.0.1:8080")
+	if trustCallerHeaders() {
+		log.Println("identidade do chamador lida dos headers X-Caller-* (LOCAL_TRUST_CALLER_HEADERS)")
+	}
+	log.Fatal(http.ListenAndServe("127.0.0.1:8080", nil))
+}
 
-	http.HandleFunc("/sign-jwt", func(w http.ResponseWriter, r *http.Request) {
-		resp, _ := handlers.HandleSignJWT(context.Background(), wrapRequest(""))
-		w.WriteHeader(resp.StatusCode)
-		fmt.Fprint(w, resp.Body)
-	})
+// Recarrega as chaves a cada KMS_RELOAD_INTERVAL e ao receber SIGHUP
+func reloadLoop() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-	http.HandleFunc("/public-key", func(w http.ResponseWriter, r *http.Request) {
-		resp, _ := handlers.HandleGetPublicKey(context.Background(), wrapRequest(""))
-		w.WriteHeader(resp.StatusCode)
-		fmt.Fprint(w, resp.Body)
-	})
-	http.HandleFunc("/jwks-signed", func(w http.ResponseWriter, r *http.Request) {
-		resp, _ := handlers.HandleGetJWKS(context.Background(), wrapRequest(""))
-		w.WriteHeader(resp.StatusCode)
-		fmt.Fprint(w, resp.Body)
-	})
-	log.Println("Servidor local ouvindo em http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	var tick <-chan time.Time
+	if interval, _ := handlers.ReloadInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+		}
+		if err := handlers.Keys.Reload(context.Background()); err != nil {
+			log.Printf("erro ao recarregar chaves, mantendo as anteriores: %v", err)
+			continue
+		}
+		log.Println("chaves recarregadas")
+	}
+}
+
+// Converte a requisição HTTP no evento do API Gateway. Sem API Gateway na
+// frente, a identidade do chamador só vem dos headers X-Caller-Arn,
+// X-Caller-Principal e X-Caller-Claims (objeto JSON) com
+// LOCAL_TRUST_CALLER_HEADERS=true, para exercitar as regras de authorization
+// localmente; sem ela, toda requisição chega sem identidade.
+func wrapRequest(r *http.Request, body string) events.APIGatewayProxyRequest {
+	headers := map[string]string{"Host": r.Host}
+	for k := range r.Header {
+		headers[k] = r.Header.Get(k)
+	}
+	query := map[string]string{}
+	multiQuery := map[string][]string{}
+	for k, v := range r.URL.Query() {
+		query[k] = v[len(v)-1]
+		multiQuery[k] = v
+	}
+	return events.APIGatewayProxyRequest{
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         headers,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: multiQuery,
+		RequestContext:                  requestContext(r),
+		Body:                            body,
+	}
+}
+
+// Headers X-Caller-* só valem com LOCAL_TRUST_CALLER_HEADERS=true
+func trustCallerHeaders() bool {
+	trust, _ := strconv.ParseBool(os.Getenv("LOCAL_TRUST_CALLER_HEADERS"))
+	return trust
 }
 
-func wrapRequest(body string) events.APIGatewayProxyRequest {
-	return events.APIGatewayProxyRequest{Body: body}
+func requestContext(r *http.Request) events.APIGatewayProxyRequestContext {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	ctx := events.APIGatewayProxyRequestContext{
+		Stage:      "local",
+		Path:       r.URL.Path,
+		HTTPMethod: r.Method,
+		RequestID:  fmt.Sprintf("local-%d", time.Now().UnixNano()),
+		Identity: events.APIGatewayRequestIdentity{
+			SourceIP:  host,
+			UserAgent: r.UserAgent(),
+		},
+	}
+	if !trustCallerHeaders() {
+		return ctx
+	}
+	ctx.Identity.UserArn = r.Header.Get("X-Caller-Arn")
+
+	authorizer := map[string]interface{}{}
+	if principal := r.Header.Get("X-Caller-Principal"); principal != "" {
+		authorizer["principalId"] = principal
+	}
+	if raw := r.Header.Get("X-Caller-Claims"); raw != "" {
+		claims := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(raw), &claims); err != nil {
+			log.Printf("X-Caller-Claims ignorado, JSON inválido: %v", err)
+		} else {
+			authorizer["claims"] = claims
+		}
+	}
+	if len(authorizer) > 0 {
+		ctx.Authorizer = authorizer
+	}
+	return ctx
 }
 
 type lambdaRequest struct {
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"lambda-ca-kms/internal/services/keymanager"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Identidade do chamador no contexto do API Gateway: ARN da autorização IAM,
+// claims do authorizer Cognito ("claims") ou contexto do authorizer Lambda
+func callerFromRequest(req events.APIGatewayProxyRequest) keymanager.Caller {
+	caller := keymanager.Caller{ARN: req.RequestContext.Identity.UserArn}
+	authorizer := req.RequestContext.Authorizer
+	if principal, ok := authorizer["principalId"].(string); ok {
+		caller.Principal = principal
+	}
+	values := authorizer
+	if claims, ok := authorizer["claims"].(map[string]interface{}); ok {
+		values = claims
+	}
+	for name, value := range values {
+		if name == "principalId" || name == "claims" || name == "integrationLatency" {
+			continue
+		}
+		if caller.Claims == nil {
+			caller.Claims = map[string]string{}
+		}
+		caller.Claims[name] = claimValue(value)
+	}
+	return caller
+}
+
+// Listas (ex.: cognito:groups) viram valores separados por vírgula
+func claimValue(value interface{}) string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = fmt.Sprint(item)
+	}
+	return strings.Join(values, ",")
+}
+
+func forbiddenResponse(err error) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(claimErrorBody{Error: "access_denied", Message: err.Error()})
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusForbidden,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCallerFromRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  events.APIGatewayProxyRequestContext
+		want keymanager.Caller
+	}{
+		{"autorização IAM", events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{UserArn: "arn:aws:sts::123456789012:assumed-role/svc-a/sessao"},
+		}, keymanager.Caller{ARN: "arn:aws:sts::123456789012:assumed-role/svc-a/sessao"}},
+		{"authorizer Cognito", events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "u-1", "cognito:groups": []interface{}{"admins", "ops"}}},
+		}, keymanager.Caller{Claims: map[string]string{"sub": "u-1", "cognito:groups": "admins,ops"}}},
+		{"authorizer Lambda", events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{"principalId": "partner-acme", "tier": "gold", "integrationLatency": 12},
+		}, keymanager.Caller{Principal: "partner-acme", Claims: map[string]string{"tier": "gold"}}},
+		{"sem identidade", events.APIGatewayProxyRequestContext{}, keymanager.Caller{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := callerFromRequest(events.APIGatewayProxyRequest{RequestContext: tt.ctx})
+			if got.ARN != tt.want.ARN || got.Principal != tt.want.Principal || len(got.Claims) != len(tt.want.Claims) {
+				t.Fatalf("esperado %+v, obtido %+v", tt.want, got)
+			}
+			for name, value := range tt.want.Claims {
+				if got.Claims[name] != value {
+					t.Errorf("claim %s = %q, esperado %q", name, got.Claims[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestRoute_Authorization(t *testing.T) {
+	conf := &keymanager.Config{
+		Issuer:   "ca.internal",
+		Profiles: map[string]keymanager.TokenProfile{"service-to-service": {Audience: []string{"api.interna"}}},
+		Authorization: &keymanager.AuthorizationConfig{Rules: []keymanager.AccessRule{
+			{Name: "servicos", IAMArn: "arn:aws:sts::123456789012:assumed-role/svc-*", Profiles: []string{"service-to-service"}, Audiences: []string{"api.interna"}},
+			{Name: "ingress", Principal: "ingress", CSRTemplates: []string{"server-tls"}},
+		}},
+		Keys: map[string][]keymanager.KeyEntry{
+			"jwt": {{KeyID: "alias/jwt", UseFrom: time.Now().Add(-time.Hour)}},
+		},
+	}
+	set, err := keymanager.NewKeyLoader(softkms.New(), keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(set)
+
+	service := events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{UserArn: "arn:aws:sts::123456789012:assumed-role/svc-billing/sessao"}}
+	ingress := events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"principalId": "ingress"}}
+	tests := []struct {
+		name       string
+		path       string
+		query      map[string]string
+		body       string
+		ctx        events.APIGatewayProxyRequestContext
+		status     int
+		wantReason string
+	}{
+		{"perfil liberado", "/sign-jwt", map[string]string{"profile": "service-to-service"}, `{}`, service, http.StatusOK, ""},
+		{"token_policy sem liberação", "/sign-jwt", nil, `{"aud":"api.interna"}`, service, http.StatusForbidden, `perfil "default"`},
+		{"sem regra para o chamador", "/sign-jwt", map[string]string{"profile": "service-to-service"}, `{}`, ingress, http.StatusForbidden, `perfil "service-to-service"`},
+		{"chamador anônimo", "/sign-jwt", map[string]string{"profile": "service-to-service"}, `{}`, events.APIGatewayProxyRequestContext{}, http.StatusForbidden, "não identificado"},
+		{"template liberado", "/sign-csr", map[string]string{"template": "server-tls"}, "", ingress, http.StatusBadRequest, ""},
+		{"template proibido", "/sign-csr", map[string]string{"template": "client-tls"}, "", ingress, http.StatusForbidden, `template de CSR "client-tls"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{
+				Path: tt.path, QueryStringParameters: tt.query, Body: tt.body, RequestContext: tt.ctx,
+			})
+			if resp.StatusCode != tt.status {
+				t.Fatalf("esperado %d, obtido %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			if tt.wantReason == "" {
+				return
+			}
+			var body claimErrorBody
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil || body.Error != "access_denied" || !strings.Contains(body.Message, tt.wantReason) {
+				t.Errorf("recusa inesperada: %s", resp.Body)
+			}
+		})
+	}
+}
@@ -9,13 +9,23 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 )
 
+// Com authorization configurada, o template (?template=, padrão "default")
+// precisa estar liberado para o chamador
 func HandleSignCSR(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	if err := set.Authorization().AuthorizeCSR(callerFromRequest(req), req.QueryStringParameters["template"]); err != nil {
+		return forbiddenResponse(err), nil
+	}
+
 	block, _ := pem.Decode([]byte(req.Body))
 	if block == nil || block.Type != "CERTIFICATE REQUEST" {
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "CSR inválido"}, nil
 	}
 
-	_, err := x509.ParseCertificateRequest(block.Bytes)
+	_, err = x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Erro ao analisar CSR"}, nil
 	}
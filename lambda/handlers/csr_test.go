@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"lambda-ca-kms/internal/services/keymanager"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -32,6 +33,7 @@ func TestHandleSignCSR(t *testing.T) {
 		Bytes: csrDER,
 	})
 
+	Keys.Store(keymanager.NewKeySet("", nil, nil, nil))
 	req := events.APIGatewayProxyRequest{Body: string(pemCSR)}
 	resp, err := HandleSignCSR(context.Background(), req)
 	if err != nil {
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func GetDiscovery(ctx context.Context) (*keymanager.DiscoveryDocument, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	set.ConfirmPublished(ctx, now)
+	return set.Discovery(now)
+}
+
+// Serve /.well-known/openid-configuration e /.well-known/oauth-authorization-server
+func HandleGetDiscovery(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	doc, err := GetDiscovery(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}, nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Estado completo das chaves, só para logs: traz kids, erros do KMS, versão da
+// configuração e failovers, que não devem sair em /health
+func GetHealth(ctx context.Context) keymanager.Health {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return keymanager.Health{Status: keymanager.HealthUnavailable}
+	}
+	health := set.Health(time.Now())
+	health.SigningFailovers = failoverMetrics.Counts()
+	if err := Keys.LastError(); err != nil {
+		health.ReloadError = err.Error()
+	}
+	return health
+}
+
+// Resposta pública de /health: só o estado geral
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// Serve /health: 200 para ok ou degradado (falha só em chave futura), 503 se
+// algum grupo não tem chave ativa. O detalhe por chave vai para o log quando
+// o estado não é ok.
+func HandleHealth(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	health := GetHealth(ctx)
+	if health.Status != keymanager.HealthOK {
+		if detail, err := json.Marshal(health); err == nil {
+			log.Printf("health %s: %s", health.Status, detail)
+		}
+	}
+	body, err := json.Marshal(healthStatus{Status: health.Status})
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
+	}
+
+	status := http.StatusOK
+	if health.Status == keymanager.HealthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandleHealth_SoEstadoGeral(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		useFrom    time.Time
+		wantStatus int
+		want       string
+	}{
+		{"com chave ativa", now.Add(-time.Hour), http.StatusOK, keymanager.HealthOK},
+		{"sem chave ativa", now.Add(time.Hour), http.StatusServiceUnavailable, keymanager.HealthUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &keymanager.Config{Issuer: "ca.internal", Keys: map[string][]keymanager.KeyEntry{
+				"jwt": {{KeyID: "alias/segredo-jwt", UseFrom: tt.useFrom}},
+			}}
+			set, err := keymanager.NewKeyLoader(softkms.New(), keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+			if err != nil {
+				t.Fatalf("erro no carregamento: %v", err)
+			}
+			Keys.Store(set)
+
+			resp, _ := HandleHealth(context.Background(), events.APIGatewayProxyRequest{Path: "/health"})
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("esperado %d, obtido %d", tt.wantStatus, resp.StatusCode)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatalf("resposta inválida: %s", resp.Body)
+			}
+			if len(body) != 1 || body["status"] != tt.want {
+				t.Errorf("esperado só status %q, obtido %s", tt.want, resp.Body)
+			}
+			if strings.Contains(resp.Body, "segredo-jwt") {
+				t.Error("/health não deveria expor chaves")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Introspecção de token (RFC 7662): POST application/x-www-form-urlencoded
+// com token=..., autenticado por client_secret_basic ou client_secret_post.
+// Outros métodos recebem 405 e outros tipos de conteúdo, 415.
+func HandleIntrospect(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if req.HTTPMethod != http.MethodPost {
+		resp := oauthErrorResponse(http.StatusMethodNotAllowed, "invalid_request")
+		resp.Headers["Allow"] = http.MethodPost
+		return resp, nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(requestHeader(req, "Content-Type")); err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return oauthErrorResponse(http.StatusUnsupportedMediaType, "invalid_request"), nil
+	}
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_request"), nil
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_request"), nil
+	}
+	id, secret, ok := clientCredentials(req, form)
+	if !ok || set.Introspection().Authenticate(id, secret) != nil {
+		resp := oauthErrorResponse(http.StatusUnauthorized, "invalid_client")
+		resp.Headers["WWW-Authenticate"] = `Basic realm="introspect"`
+		return resp, nil
+	}
+	token := form.Get("token")
+	if token == "" {
+		return oauthErrorResponse(http.StatusBadRequest, "invalid_request"), nil
+	}
+
+	now := time.Now()
+	set.ConfirmPublished(ctx, now)
+	out, err := json.Marshal(set.Introspect(token, now))
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json", "Cache-Control": "no-store"},
+		Body:       string(out),
+	}, nil
+}
+
+// Credenciais do cabeçalho Basic (RFC 6749, seção 2.3.1: id e segredo
+// codificados como formulário) ou dos campos client_id e client_secret
+func clientCredentials(req events.APIGatewayProxyRequest, form url.Values) (string, string, bool) {
+	auth := requestHeader(req, "Authorization")
+	if auth == "" {
+		id, secret := form.Get("client_id"), form.Get("client_secret")
+		return id, secret, id != "" && secret != ""
+	}
+	scheme, encoded, found := strings.Cut(auth, " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	rawID, rawSecret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+	id, errID := url.QueryUnescape(rawID)
+	secret, errSecret := url.QueryUnescape(rawSecret)
+	return id, secret, errID == nil && errSecret == nil
+}
+
+// Erro no formato OAuth 2.0 (RFC 6749, seção 5.2)
+func oauthErrorResponse(status int, code string) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(map[string]string{"error": code})
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json", "Cache-Control": "no-store"},
+		Body:       string(body),
+	}
+}
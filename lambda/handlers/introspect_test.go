@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHandleIntrospect(t *testing.T) {
+	sum := sha256.Sum256([]byte("segredo:1"))
+	now := time.Now()
+	conf := &keymanager.Config{
+		Issuer:        "ca.internal",
+		Introspection: &keymanager.IntrospectionConfig{Clients: []keymanager.IntrospectionClient{{ID: "gateway", SecretSHA256: hex.EncodeToString(sum[:])}}},
+		Keys: map[string][]keymanager.KeyEntry{"jwt": {
+			{KeyID: "alias/jwt", UseFrom: now.Add(-time.Hour)},
+			{KeyID: "alias/revogada", UseFrom: now.Add(-48 * time.Hour), RevokedAt: now.Add(-time.Minute), Reason: "vazamento"},
+		}},
+	}
+	client := softkms.New()
+	set, err := keymanager.NewKeyLoader(client, keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(set)
+
+	sign := func(key *keymanager.KeyHolder, exp time.Time) string {
+		token := jwt.NewWithClaims(key.SigningMethod(), jwt.MapClaims{
+			"iss": "https://ca.internal", "sub": "svc-a", "scope": "leitura", "iat": now.Unix(), "exp": exp.Unix(),
+		})
+		token.Header["kid"] = key.Kid()
+		signed, err := token.SignedString(key.WithContext(context.Background()))
+		if err != nil {
+			t.Fatalf("falha ao assinar: %v", err)
+		}
+		return signed
+	}
+	var current, revoked *keymanager.KeyHolder
+	for _, key := range set.Group("jwt") {
+		if key.RevokedBy(now) {
+			revoked = key
+		} else {
+			current = key
+		}
+	}
+	valid := sign(current, now.Add(5*time.Minute))
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("gateway:"+url.QueryEscape("segredo:1")))
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		auth       string
+		status     int
+		wantActive bool
+		wantError  string
+	}{
+		{"token ativo com Basic", url.Values{"token": {valid}}, basic, http.StatusOK, true, ""},
+		{"token ativo com client_secret_post", url.Values{"token": {valid}, "client_id": {"gateway"}, "client_secret": {"segredo:1"}}, "", http.StatusOK, true, ""},
+		{"token expirado", url.Values{"token": {sign(current, now.Add(-time.Minute))}}, basic, http.StatusOK, false, ""},
+		{"chave revogada", url.Values{"token": {sign(revoked, now.Add(5*time.Minute))}}, basic, http.StatusOK, false, ""},
+		{"kid desconhecido", url.Values{"token": {"eyJhbGciOiJFUzI1NiIsImtpZCI6Im91dHJhIn0.e30.AAAA"}}, basic, http.StatusOK, false, ""},
+		{"segredo errado", url.Values{"token": {valid}}, "Basic " + base64.StdEncoding.EncodeToString([]byte("gateway:outro")), http.StatusUnauthorized, false, "invalid_client"},
+		{"sem credenciais", url.Values{"token": {valid}}, "", http.StatusUnauthorized, false, "invalid_client"},
+		{"sem token", url.Values{}, basic, http.StatusBadRequest, false, "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Path:       "/introspect",
+				Headers:    map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+				Body:       tt.form.Encode(),
+			}
+			if tt.auth != "" {
+				req.Headers["authorization"] = tt.auth
+			}
+			resp, _ := Route(context.Background(), req)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("esperado %d, obtido %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatalf("resposta inválida: %s", resp.Body)
+			}
+			if tt.wantError != "" {
+				if body["error"] != tt.wantError {
+					t.Errorf("erro = %v, esperado %s", body["error"], tt.wantError)
+				}
+				return
+			}
+			if body["active"] != tt.wantActive {
+				t.Fatalf("active = %v, esperado %v: %s", body["active"], tt.wantActive, resp.Body)
+			}
+			if !tt.wantActive {
+				if len(body) != 1 {
+					t.Errorf("token inativo não deve trazer claims: %s", resp.Body)
+				}
+				return
+			}
+			if body["sub"] != "svc-a" || body["scope"] != "leitura" || body["iss"] != "https://ca.internal" || body["token_type"] != "Bearer" {
+				t.Errorf("claims inesperadas: %s", resp.Body)
+			}
+		})
+	}
+	requests := []struct {
+		name        string
+		method      string
+		contentType string
+		status      int
+	}{
+		{"GET", http.MethodGet, "application/x-www-form-urlencoded", http.StatusMethodNotAllowed},
+		{"PUT", http.MethodPut, "application/x-www-form-urlencoded", http.StatusMethodNotAllowed},
+		{"JSON", http.MethodPost, "application/json", http.StatusUnsupportedMediaType},
+		{"sem Content-Type", http.MethodPost, "", http.StatusUnsupportedMediaType},
+		{"formulário com charset", http.MethodPost, "application/x-www-form-urlencoded; charset=UTF-8", http.StatusOK},
+	}
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: tt.method,
+				Path:       "/introspect",
+				Headers:    map[string]string{"Authorization": basic},
+				Body:       url.Values{"token": {valid}}.Encode(),
+			}
+			if tt.contentType != "" {
+				req.Headers["content-type"] = tt.contentType
+			}
+			resp, _ := Route(context.Background(), req)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("esperado %d, obtido %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			if tt.status == http.StatusMethodNotAllowed && resp.Headers["Allow"] != http.MethodPost {
+				t.Errorf("405 deveria informar Allow: POST, obtido %q", resp.Headers["Allow"])
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func GetIssuerMetadata(ctx context.Context) (*keymanager.IssuerMetadata, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keymanager.BuildIssuerMetadata(set.Issuer(), set.Group("jwt"), set.Group("jose"), set.Group("jwks"), time.Now())
+}
+
+// Serve /issuer-config: issuer, estado e ARNs das chaves de cada grupo
+func HandleGetIssuerConfig(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	meta, err := GetIssuerMetadata(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	body, err := json.Marshal(meta)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}, nil
+}
+
+// Serve /issuer-config/schema com o JSON Schema do documento acima
+func HandleGetIssuerConfigSchema(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/schema+json"},
+		Body:       string(keymanager.IssuerSchema()),
+	}, nil
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"github.com/aws/aws-lambda-go/events"
 	"lambda-ca-kms/internal/services/keymanager"
@@ -36,19 +37,12 @@ func base64urlInt(i int) string {
 	return base64.RawURLEncoding.EncodeToString(buf)
 }
 
+const jwkSetContentType = "application/jwk-set+json"
+
 func HandleGetJWKS(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	signedJWTKS, err := keymanager.GetJWKS(ctx)
+	signedJWTKS, err := GetJWKS(ctx)
 	if err != nil {
-		switch {
-		case errors.Is(err, keymanager.ErrInvalidKey):
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro ao decodificar chave pública"}, nil
-		case errors.Is(err, keymanager.ErrConfiguredKeyNotSupported):
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "chave pública com tipo não suportado"}, nil
-		case errors.Is(err, keymanager.ErrCouldNotSignKey):
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro ao assinar JWKS"}, nil
-		default:
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
-		}
+		return jwksErrorResponse(err), nil
 	}
 
 	return events.APIGatewayProxyResponse{
@@ -57,3 +51,38 @@ func HandleGetJWKS(ctx context.Context, req events.APIGatewayProxyRequest) (even
 		Body:       signedJWTKS,
 	}, nil
 }
+
+// Serve /.well-known/jwks.json: o mesmo conjunto de chaves, sem o envelope JWT
+func HandleGetJWKSet(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	set, err := GetJWKSet(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	body, err := json.Marshal(set)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": jwkSetContentType},
+		Body:       string(body),
+	}, nil
+}
+
+func jwksErrorResponse(err error) events.APIGatewayProxyResponse {
+	switch {
+	case errors.Is(err, keymanager.ErrInvalidKey):
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro ao decodificar chave pública"}
+	case errors.Is(err, keymanager.ErrConfiguredKeyNotSupported):
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "chave pública com tipo não suportado"}
+	case errors.Is(err, keymanager.ErrNoActiveKey):
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusServiceUnavailable, Body: "nenhuma chave ativa"}
+	case errors.Is(err, keymanager.ErrNoKeySet):
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusServiceUnavailable, Body: "chaves não carregadas"}
+	case errors.Is(err, keymanager.ErrCouldNotSignKey):
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro ao assinar JWKS"}
+	default:
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}
+	}
+}
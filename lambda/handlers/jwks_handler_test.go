@@ -82,7 +82,7 @@ func TestHandleGetJWKS_Table(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			entry := handlers.KeyEntry{
+			entry := keymanager.KeyEntry{
 				KeyID:     tt.name,
 				UseFrom:   time.Now().Add(-1 * time.Hour),
 				ExpiresAt: time.Now().Add(6 * time.Hour),
@@ -102,9 +102,9 @@ func TestHandleGetJWKS_Table(t *testing.T) {
 			}
 
 			kw := keymanager.NewKeyHolder(pub, cfg, entry)
-			handlers.JWTKeys = []*keymanager.KeyHolder{kw}
-			handlers.JOSEKeys = []*keymanager.KeyHolder{kw}
-			handlers.JWKSKeys = []*keymanager.KeyHolder{kw}
+			handlers.Keys.Store(keymanager.NewKeySet("jwks.ca.internal", map[string][]*keymanager.KeyHolder{
+				"jwt": {kw}, "jose": {kw}, "jwks": {kw},
+			}, nil, nil))
 
 			resp, _ := handlers.HandleGetJWKS(context.Background(), events.APIGatewayProxyRequest{})
 			if resp.StatusCode != tt.expect {
@@ -144,3 +144,57 @@ func TestHandleGetJWKS_Table(t *testing.T) {
 func strPtr(s string) *string {
 	return &s
 }
+
+func TestHandleGetJWKSet(t *testing.T) {
+	keyDER, _ := generateFakeECDSAKey(t)
+
+	tests := []struct {
+		name     string
+		keyData  []byte
+		useFrom  time.Time
+		expect   int
+		wantKeys int
+	}{
+		{"sig e enc publicadas", keyDER, time.Now().Add(-1 * time.Hour), 200, 2},
+		{"enc ainda não ativa fica de fora", keyDER, time.Now().Add(1 * time.Hour), 200, 1},
+		{"chave inválida", []byte("invalid"), time.Now().Add(-1 * time.Hour), 500, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := keymanager.KeyEntry{
+				KeyID:     tt.name,
+				UseFrom:   tt.useFrom,
+				ExpiresAt: time.Now().Add(6 * time.Hour),
+			}
+			pub := &kms.GetPublicKeyOutput{
+				KeyId:     strPtr(entry.KeyID),
+				KeySpec:   types.KeySpecEccNistP256,
+				PublicKey: tt.keyData,
+			}
+			kw := keymanager.NewKeyHolder(pub, jwtkms.NewKMSConfig(nil, entry.KeyID, false), entry)
+			handlers.Keys.Store(keymanager.NewKeySet("", map[string][]*keymanager.KeyHolder{
+				"jwt": {kw}, "jose": {kw},
+			}, nil, nil))
+
+			resp, _ := handlers.HandleGetJWKSet(context.Background(), events.APIGatewayProxyRequest{})
+			if resp.StatusCode != tt.expect {
+				t.Fatalf("esperado status %d, obtido %d", tt.expect, resp.StatusCode)
+			}
+			if tt.expect != 200 {
+				return
+			}
+
+			if ct := resp.Headers["Content-Type"]; ct != "application/jwk-set+json" {
+				t.Errorf("Content-Type inesperado: %s", ct)
+			}
+			var set keymanager.JWKS
+			if err := json.Unmarshal([]byte(resp.Body), &set); err != nil {
+				t.Fatalf("corpo não é um JWKS: %v", err)
+			}
+			if len(set.Keys) != tt.wantKeys {
+				t.Errorf("esperado %d chaves, obtido %d", tt.wantKeys, len(set.Keys))
+			}
+		})
+	}
+}
@@ -2,18 +2,95 @@ package handlers
 
 import (
 	"context"
-	"github.com/golang-jwt/jwt/v5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"lambda-ca-kms/internal/services/keymanager"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// Assina as claims do corpo (objeto JSON) com a chave ativa do grupo jwt. O
+// servidor completa iss, iat, nbf, exp e jti conforme a token_policy do
+// issuer; violações voltam como 4xx com {"error", "claim", "message"}. Com
+// ?profile=<nome>, claims, aud, exp, header typ e grupo de chaves vêm do perfil.
+// Com authorization configurada, o chamador precisa de uma regra que libere o
+// perfil e as audiências do token; do contrário, 403 com o motivo.
 func HandleSignJWT(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	signed, err := keymanager.SignJWT(ctx, jwt.MapClaims{})
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return claimErrorResponse(&keymanager.ClaimError{Code: "invalid_claims", Message: "corpo em base64 inválido", Err: keymanager.ErrMalformedClaims}), nil
+	}
+	var typ string
+	var claims jwt.MapClaims
+	name := req.QueryStringParameters["profile"]
+	if name != "" {
+		var profile keymanager.TokenProfile
+		if profile, err = set.Profile(name); err != nil {
+			return claimErrorResponse(err), nil
+		}
+		typ = profile.Type
+		claims, err = profile.BuildClaims(set.TokenPolicy(), set.Issuer(), body, time.Now())
+	} else {
+		claims, err = set.TokenPolicy().BuildClaims(set.Issuer(), body, time.Now())
+	}
+	if err != nil {
+		return claimErrorResponse(err), nil
+	}
+	if err := set.Authorization().AuthorizeToken(callerFromRequest(req), name, keymanager.TokenAudiences(claims)); err != nil {
+		return forbiddenResponse(err), nil
+	}
+
+	signed, err := signJWT(ctx, "jwt", typ, claims)
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro ao assinar jwt"}, nil
 	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/jwt"},
+		Body:       signed,
+	}, nil
+}
+
+// Corpo da requisição; o API Gateway entrega em base64 quando o conteúdo é binário
+func requestBody(req events.APIGatewayProxyRequest) ([]byte, error) {
+	if req.IsBase64Encoded {
+		return base64.StdEncoding.DecodeString(req.Body)
+	}
+	return []byte(req.Body), nil
+}
 
-	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: signed}, nil
+type claimErrorBody struct {
+	Error   string `json:"error"`
+	Claim   string `json:"claim,omitempty"`
+	Message string `json:"message"`
+}
+
+// 413 para corpo grande demais, 403 para audiência não permitida e 400 para
+// as demais violações da política
+func claimErrorResponse(err error) events.APIGatewayProxyResponse {
+	var claimErr *keymanager.ClaimError
+	if !errors.As(err, &claimErr) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}
+	}
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, keymanager.ErrPayloadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, keymanager.ErrAudienceNotAllowed):
+		status = http.StatusForbidden
+	}
+	body, _ := json.Marshal(claimErrorBody{Error: claimErr.Code, Claim: claimErr.Claim, Message: claimErr.Message})
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
 }
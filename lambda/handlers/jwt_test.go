@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHandleSignJWT_Claims(t *testing.T) {
+	conf := &keymanager.Config{
+		Issuer:      "ca.internal",
+		TokenPolicy: keymanager.TokenPolicy{Audiences: []string{"api.interna"}, MaxPayloadBytes: 256},
+		Keys: map[string][]keymanager.KeyEntry{
+			"jwt": {{KeyID: "alias/jwt", UseFrom: time.Now().Add(-time.Hour)}},
+		},
+	}
+	set, err := keymanager.NewKeyLoader(softkms.New(), keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(set)
+	signer := set.Active("jwt", time.Now())
+	pub, _ := x509.ParsePKIXPublicKey(signer.PubKey.PublicKey)
+
+	tests := []struct {
+		name      string
+		body      string
+		status    int
+		wantError string
+	}{
+		{"claims aceitas", `{"sub":"svc-a","aud":"api.interna","scope":"leitura"}`, http.StatusOK, ""},
+		{"claim reservada", `{"sub":"svc-a","iat":1}`, http.StatusBadRequest, "reserved_claim"},
+		{"audiência não permitida", `{"aud":"outra-api"}`, http.StatusForbidden, "audience_not_allowed"},
+		{"JSON inválido", `{"sub":`, http.StatusBadRequest, "invalid_claims"},
+		{"corpo grande demais", `{"sub":"` + string(make([]byte, 300)) + `"}`, http.StatusRequestEntityTooLarge, "payload_too_large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{Path: "/sign-jwt", Body: tt.body})
+			if resp.StatusCode != tt.status {
+				t.Fatalf("esperado %d, obtido %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			if tt.wantError != "" {
+				var body claimErrorBody
+				if err := json.Unmarshal([]byte(resp.Body), &body); err != nil || body.Error != tt.wantError || body.Message == "" {
+					t.Errorf("erro estruturado inesperado: %s", resp.Body)
+				}
+				return
+			}
+
+			claims := jwt.MapClaims{}
+			token, err := jwt.ParseWithClaims(resp.Body, claims, func(*jwt.Token) (interface{}, error) { return pub, nil },
+				jwt.WithIssuer("https://ca.internal"), jwt.WithAudience("api.interna"), jwt.WithIssuedAt())
+			if err != nil || !token.Valid {
+				t.Fatalf("JWT inválido: %v", err)
+			}
+			if token.Header["kid"] != signer.Kid() || claims["sub"] != "svc-a" || claims["scope"] != "leitura" || claims["jti"] == nil {
+				t.Errorf("token inesperado: header %v, claims %v", token.Header, claims)
+			}
+		})
+	}
+}
+
+func TestHandleSignJWT_Profile(t *testing.T) {
+	conf := &keymanager.Config{
+		Issuer: "ca.internal",
+		Profiles: map[string]keymanager.TokenProfile{
+			"partner-passport": {
+				Lifetime: 10 * time.Minute,
+				Audience: []string{"parceiros"},
+				Claims:   map[string]keymanager.ClaimSpec{"sub": {Type: "string", Required: true}},
+				Type:     "at+jwt",
+			},
+		},
+		Keys: map[string][]keymanager.KeyEntry{
+			"jwt":  {{KeyID: "alias/jwt", UseFrom: time.Now().Add(-time.Hour)}},
+			"jwks": {{KeyID: "alias/jwks", UseFrom: time.Now().Add(-time.Hour)}},
+		},
+	}
+	set, err := keymanager.NewKeyLoader(softkms.New(), keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(set)
+	signer := set.Active("jwt", time.Now())
+	pub, _ := x509.ParsePKIXPublicKey(signer.PubKey.PublicKey)
+
+	tests := []struct {
+		name      string
+		profile   string
+		body      string
+		status    int
+		wantError string
+	}{
+		{"perfil aplicado", "partner-passport", `{"sub":"parceiro-1"}`, http.StatusOK, ""},
+		{"perfil desconhecido", "inexistente", `{"sub":"parceiro-1"}`, http.StatusBadRequest, "unknown_profile"},
+		{"claim fora do perfil", "partner-passport", `{"sub":"parceiro-1","scope":"admin"}`, http.StatusBadRequest, "unknown_claim"},
+		{"obrigatória ausente", "partner-passport", `{}`, http.StatusBadRequest, "missing_claim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{
+				Path: "/sign-jwt", Body: tt.body, QueryStringParameters: map[string]string{"profile": tt.profile},
+			})
+			if resp.StatusCode != tt.status {
+				t.Fatalf("esperado %d, obtido %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			if tt.wantError != "" {
+				var body claimErrorBody
+				if err := json.Unmarshal([]byte(resp.Body), &body); err != nil || body.Error != tt.wantError {
+					t.Errorf("erro estruturado inesperado: %s", resp.Body)
+				}
+				return
+			}
+
+			claims := jwt.MapClaims{}
+			token, err := jwt.ParseWithClaims(resp.Body, claims, func(*jwt.Token) (interface{}, error) { return pub, nil },
+				jwt.WithIssuer("https://ca.internal"), jwt.WithAudience("parceiros"))
+			if err != nil || !token.Valid {
+				t.Fatalf("JWT inválido: %v", err)
+			}
+			if token.Header["typ"] != "at+jwt" || token.Header["kid"] != signer.Kid() {
+				t.Errorf("header inesperado: %v", token.Header)
+			}
+			exp, _ := claims.GetExpirationTime()
+			iat, _ := claims.GetIssuedAt()
+			if exp.Sub(iat.Time) != 10*time.Minute {
+				t.Errorf("lifetime = %s, esperado 10m", exp.Sub(iat.Time))
+			}
+			if result := set.VerifyJWT(resp.Body, "parceiros", time.Now()); !result.Valid {
+				t.Errorf("token do perfil deveria passar em /verify-jwt: %s %s", result.Error, result.Reason)
+			}
+		})
+	}
+}
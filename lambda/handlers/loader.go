@@ -3,108 +3,380 @@ package handlers
 import (
 	"context"
 	"encoding/pem"
-	"io/ioutil"
+	"fmt"
 	"lambda-ca-kms/internal/services/keymanager"
+	"log"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
-	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
-	"gopkg.in/yaml.v3"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/golang-jwt/jwt/v5"
+	"lambda-ca-kms/internal/services/softkms"
 )
 
-// Carrega a configuração YAML
-func loadConfig(path string) (*keymanager.Config, error) {
-	data, err := ioutil.ReadFile(path)
+// Snapshot corrente das chaves; cada requisição usa o KeySet que obteve no
+// início, mesmo que uma recarga o substitua durante a assinatura
+var Keys = &keymanager.KeyStore{}
+
+// Cache de chaves públicas reaproveitado entre recargas. Os certificados do
+// x5c ficam no certificate_store (S3), compartilhado entre as instâncias; sem
+// ele, usam o backend de public_key_cache ou, na falta dele, a memória, o que
+// só os mantém entre recargas da mesma instância.
+var (
+	pubKeyCache       keymanager.PublicKeyCache
+	pubKeyCacheConfig keymanager.PublicKeyCacheConfig
+	pubKeyCerts       keymanager.CertificateCache
+	storeCerts        keymanager.CertificateCache
+	storeURI          string
+	memoryCerts       keymanager.CertificateCache = keymanager.NewMemoryCertificateCache()
+)
+
+// Clientes da AWS criados uma única vez, em InitKMS ou no primeiro uso, e
+// reaproveitados em todas as recargas
+type awsClients struct {
+	kms     *kms.Client
+	regions keymanager.RegionClients // réplicas multirregião, derivadas de kms
+	sources keymanager.ConfigClients // SSM, Secrets Manager e S3 das origens e do certificate_store
+}
+
+var (
+	awsMu     sync.Mutex
+	awsShared *awsClients
+)
+
+func sharedAWSClients(ctx context.Context) (*awsClients, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+	if awsShared != nil {
+		return awsShared, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var cfg keymanager.Config
-	err = yaml.Unmarshal(data, &cfg)
+	base := kms.NewFromConfig(cfg)
+	awsShared = &awsClients{
+		kms:     base,
+		regions: keymanager.KMSRegionClients(base),
+		sources: keymanager.ConfigClients{
+			SSM:            ssm.NewFromConfig(cfg),
+			SecretsManager: secretsmanager.NewFromConfig(cfg),
+			S3:             s3.NewFromConfig(cfg),
+		},
+	}
+	return awsShared, nil
+}
+
+// Failovers de assinatura para réplicas multirregião, emitidos como métricas
+// EMF nos logs e no detalhe de saúde registrado por /health
+var failoverMetrics = keymanager.NewFailoverMetrics("lambda-ca-kms", os.Stdout, keymanager.ReealClock())
+
+// Ponto de entrada principal para carregar todas as chaves. As chamadas ao KMS
+// são repetidas com backoff; só falhas de chaves já necessárias impedem a
+// inicialização, e o erro traz o relatório delas (*keymanager.KeyValidationError).
+// KMS_RELOAD_INTERVAL (ex.: 10m) define a idade máxima do snapshot para ReloadKeys.
+func InitKMS() error {
+	interval, err := ReloadInterval()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &cfg, nil
+	ctx := context.Background()
+	if _, err := sharedAWSClients(ctx); err != nil {
+		return err
+	}
+	Keys = keymanager.NewKeyStore(loadKeySet, interval, keymanager.ReealClock())
+	return Keys.Reload(ctx)
 }
 
-func must(err error) {
+// Intervalo de recarga da configuração; zero desativa
+func ReloadInterval() (time.Duration, error) {
+	value := os.Getenv("KMS_RELOAD_INTERVAL")
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("KMS_RELOAD_INTERVAL inválido: %w", err)
 	}
+	return interval, nil
 }
 
-// Variáveis globais com as chaves organizadas por finalidade
-var (
-	JWTKeys  []*keymanager.KeyHolder
-	JOSEKeys []*keymanager.KeyHolder
-	JWKSKeys []*keymanager.KeyHolder
-)
+// Prazo de cada tentativa de assinatura antes de passar para a réplica
+// (KMS_SIGN_TIMEOUT, ex.: 1500ms); padrão 2s
+func SignAttemptTimeout() (time.Duration, error) {
+	value := os.Getenv("KMS_SIGN_TIMEOUT")
+	if value == "" {
+		return 2 * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("KMS_SIGN_TIMEOUT inválido: %w", err)
+	}
+	return timeout, nil
+}
 
-// Ponto de entrada principal para carregar todas as chaves
-func InitKMS() {
-	ctx := context.Background()
+// Recarrega as chaves se o snapshot passou do intervalo. Uma falha mantém as
+// chaves anteriores e aparece no log de /health.
+func ReloadKeys(ctx context.Context) {
+	if err := Keys.ReloadIfStale(ctx); err != nil {
+		log.Printf("erro ao recarregar chaves, mantendo as anteriores: %v", err)
+	}
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	must(err)
+// Origem da configuração: KMS_CONFIG_SOURCE (URI, ex.: ssm:///lambda-ca/kms-keys),
+// senão o arquivo em KMS_CONFIG_PATH
+func configSourceURI() string {
+	if uri := os.Getenv("KMS_CONFIG_SOURCE"); uri != "" {
+		return uri
+	}
+	if path := os.Getenv("KMS_CONFIG_PATH"); path != "" {
+		return path
+	}
+	return "config/kms-keys.yaml"
+}
 
-	realClient := kms.NewFromConfig(cfg)
+// Lê a configuração e monta um novo snapshot. Se a versão não mudou, o
+// snapshot atual carregou todas as chaves e nenhum certificado x5c precisa de
+// renovação, ele é mantido sem chamar o KMS.
+func loadKeySet(ctx context.Context) (*keymanager.KeySet, error) {
+	source, err := openConfigSource(ctx, configSourceURI())
+	if err != nil {
+		return nil, err
+	}
+	conf, err := source.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
 
-	configPath := os.Getenv("KMS_CONFIG_PATH")
-	if configPath == "" {
-		configPath = "config/kms-keys.yaml"
+	current := Keys.Current()
+	if current != nil && current.Version() == conf.Version &&
+		current.Health(time.Now()).Status == keymanager.HealthOK && !current.CertificatesDue(time.Now()) {
+		return current, nil
+	}
+	if current != nil {
+		log.Printf("configuração %s: versão %s -> %s", source, current.Version(), conf.Version)
 	}
-	conf, err := loadConfig(configPath)
-	must(err)
 
-	days := conf.ExpiresPolicy.OverlapDays
+	client, err := newKMSClient(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
 
-	loadKeyGroup(ctx, realClient, keymanager.ApplyExpirationPolicy(conf.Keys["jwt"], days), &JWTKeys)
-	loadKeyGroup(ctx, realClient, keymanager.ApplyExpirationPolicy(conf.Keys["jose"], days), &JOSEKeys)
-	loadKeyGroup(ctx, realClient, keymanager.ApplyExpirationPolicy(conf.Keys["jwks"], days), &JWKSKeys)
+	loader := keymanager.NewKeyLoader(client, keymanager.DefaultRetryPolicy, keymanager.ReealClock())
+	if _, ok := client.(*kms.Client); ok {
+		shared, err := sharedAWSClients(ctx)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := SignAttemptTimeout()
+		if err != nil {
+			return nil, err
+		}
+		loader.WithFailover(keymanager.FailoverConfig{
+			Clients:        shared.regions,
+			AttemptTimeout: timeout,
+			Metrics:        failoverMetrics,
+		})
+	}
+	if conf.PubKeyCache != nil {
+		if pubKeyCache == nil || pubKeyCacheConfig != *conf.PubKeyCache {
+			cache, err := keymanager.NewPublicKeyCache(*conf.PubKeyCache)
+			if err != nil {
+				return nil, err
+			}
+			certs, err := keymanager.NewCertificateCache(*conf.PubKeyCache)
+			if err != nil {
+				return nil, err
+			}
+			pubKeyCache, pubKeyCerts, pubKeyCacheConfig = cache, certs, *conf.PubKeyCache
+		}
+		loader.WithCache(pubKeyCache).WithCacheMaxAge(conf.PubKeyCache.MaxAge)
+	}
+	certs, err := certificateCache(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	loader.WithCertificateCache(certs)
+	return loader.LoadKeySet(ctx, conf)
 }
 
-// Agora espera o cliente real e também é compatível com a interface
-func loadKeyGroup(ctx context.Context, client jwtkms.KMSClient, entries []keymanager.KeyEntry, target *[]*keymanager.KeyHolder) {
-	for _, entry := range entries {
-		pubKey, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
-			KeyId: &entry.KeyID,
-		})
-		must(err)
+// Origem da URI com os clientes compartilhados; arquivo e env:// não os criam
+func openConfigSource(ctx context.Context, uri string) (keymanager.ConfigSource, error) {
+	var clients keymanager.ConfigClients
+	switch keymanager.ConfigScheme(uri) {
+	case "ssm", "secretsmanager", "s3":
+		shared, err := sharedAWSClients(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clients = shared.sources
+	}
+	return keymanager.NewConfigSource(uri, clients)
+}
 
-		cfg := jwtkms.NewKMSConfig(client, entry.KeyID, false)
+// Onde ficam os certificados do x5c: certificate_store, backend de
+// public_key_cache ou memória, nessa ordem
+func certificateCache(ctx context.Context, conf *keymanager.Config) (keymanager.CertificateCache, error) {
+	switch {
+	case conf.CertStore != "":
+		if conf.CertStore != storeURI {
+			shared, err := sharedAWSClients(ctx)
+			if err != nil {
+				return nil, err
+			}
+			store, err := keymanager.NewS3CertificateCache(shared.sources.S3, conf.CertStore)
+			if err != nil {
+				return nil, err
+			}
+			storeCerts, storeURI = store, conf.CertStore
+		}
+		return storeCerts, nil
+	case conf.PubKeyCache != nil:
+		return pubKeyCerts, nil
+	}
+	return memoryCerts, nil
+}
 
-		kw := keymanager.NewKeyHolder(pubKey, cfg, entry)
-		*target = append(*target, kw)
+// Escolhe o backend de chaves: KMS_BACKEND tem precedência sobre kms_backend do YAML
+func newKMSClient(ctx context.Context, conf *keymanager.Config) (keymanager.KeyClient, error) {
+	backend := os.Getenv("KMS_BACKEND")
+	if backend == "" {
+		backend = conf.KMSBackend
+	}
+
+	switch backend {
+	case "", "aws":
+		shared, err := sharedAWSClients(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return shared.kms, nil
+	case "software":
+		return newSoftwareKMS(conf), nil
+	default:
+		return nil, fmt.Errorf("backend de KMS desconhecido: %s", backend)
 	}
 }
 
-// Alias para uso direto
-func GetJWTSigner() *keymanager.KeyHolder  { return keymanager.GetActiveKey(JWTKeys, time.Now()) }
-func GetJOSESigner() *keymanager.KeyHolder { return keymanager.GetActiveKey(JOSEKeys, time.Now()) }
-func GetJWKSSigner() *keymanager.KeyHolder { return keymanager.GetActiveKey(JWKSKeys, time.Now()) }
+func newSoftwareKMS(conf *keymanager.Config) *softkms.Client {
+	soft := conf.SoftwareKMS
+	if dir := os.Getenv("SOFTKMS_KEY_DIR"); dir != "" {
+		soft.KeyDir = dir
+	}
 
-func GetJWTKeysForJWKS() []*keymanager.KeyHolder { return keymanager.GetVisibleAt(JWTKeys, time.Now()) }
-func GetJOSEKeysForJWKS() []*keymanager.KeyHolder {
-	return keymanager.GetVisibleAt(JOSEKeys, time.Now())
+	opts := []softkms.Option{softkms.WithKeyDir(soft.KeyDir)}
+	if soft.DefaultKeySpec != "" {
+		opts = append(opts, softkms.WithDefaultKeySpec(types.KeySpec(soft.DefaultKeySpec)))
+	}
+	for keyID, spec := range soft.KeySpecs {
+		opts = append(opts, softkms.WithKeySpec(keyID, types.KeySpec(spec)))
+	}
+	for keyID, usage := range softwareKeyUsages(conf) {
+		opts = append(opts, softkms.WithKeyUsage(keyID, usage))
+	}
+	return softkms.New(opts...)
 }
-func GetJWKSKeysForJWKS() []*keymanager.KeyHolder {
-	return keymanager.GetVisibleAt(JWKSKeys, time.Now())
+
+// KeyUsage das chaves locais: key_usages do YAML ou, para o grupo jose da raiz
+// e de cada issuer, o compatível com a spec (ENCRYPT_DECRYPT para RSA,
+// KEY_AGREEMENT para EC)
+func softwareKeyUsages(conf *keymanager.Config) map[string]types.KeyUsageType {
+	soft := conf.SoftwareKMS
+	usages := map[string]types.KeyUsageType{}
+	jose := append([]keymanager.KeyEntry(nil), conf.Keys["jose"]...)
+	for _, issuer := range conf.Issuers {
+		jose = append(jose, issuer.Keys["jose"]...)
+	}
+	for _, entry := range jose {
+		spec := soft.KeySpecs[entry.KeyID]
+		if spec == "" {
+			spec = soft.DefaultKeySpec
+		}
+		usages[entry.KeyID] = types.KeyUsageTypeKeyAgreement
+		if strings.HasPrefix(spec, "RSA_") {
+			usages[entry.KeyID] = types.KeyUsageTypeEncryptDecrypt
+		}
+	}
+	for keyID, usage := range soft.KeyUsages {
+		usages[keyID] = types.KeyUsageType(usage)
+	}
+	return usages
+}
+
+// Entradas publicadas no JWKS com os certificados x5c, quando configurados
+func publishedEntries(ctx context.Context, set *keymanager.KeySet) []*keymanager.JWKSEntry {
+	now := time.Now()
+	set.ConfirmPublished(ctx, now)
+	entries := keymanager.PublishedEntries(set.Group("jwt"), set.Group("jose"), now)
+	if certs := set.Certificates(); certs != nil {
+		certs.Attach(entries)
+	}
+	return entries
 }
 
 func GetJWKS(ctx context.Context) (string, error) {
-	entries := []*keymanager.JWKSEntry{
-		keymanager.NewJWKSEntry(GetJWTSigner(), "sig"),
-		keymanager.NewJWKSEntry(GetJOSESigner(), "enc"),
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return "", err
 	}
-	return keymanager.BuildJWKS(entries, keymanager.NewJWKSConfig(
-		"jwks.ca.internal",
+	signer := set.Active("jwks", time.Now())
+	if signer == nil {
+		return "", fmt.Errorf("%w: jwks", keymanager.ErrNoActiveKey)
+	}
+	return keymanager.BuildJWKS(publishedEntries(ctx, set), keymanager.NewJWKSConfig(
+		set.Issuer(),
 		24,
-		300), GetJWTSigner().SigningMethod(), GetJWKSSigner().WithContext(ctx))
+		300).WithKid(signer.Kid()), signer.SigningMethod(), signer.WithContext(ctx))
+}
+
+// JWKS sem assinatura, com as mesmas regras de visibilidade de GetJWKS
+func GetJWKSet(ctx context.Context) (keymanager.JWKS, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return keymanager.JWKS{}, err
+	}
+	return keymanager.BuildJWKSet(publishedEntries(ctx, set))
+}
+
+func SignJWT(ctx context.Context, claims jwt.Claims) (string, error) {
+	return signJWT(ctx, "jwt", "", claims)
 }
 
-func GetPublicKey() ([]byte, error) {
-	out := GetJWKSSigner().PubKey
+// Assina com a chave ativa do grupo; typ vazio mantém o header padrão (JWT)
+func signJWT(ctx context.Context, group, typ string, claims jwt.Claims) (string, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return "", err
+	}
+	signer := set.Active(group, time.Now())
+	if signer == nil {
+		return "", fmt.Errorf("%w: %s", keymanager.ErrNoActiveKey, group)
+	}
+	token := jwt.NewWithClaims(signer.SigningMethod(), claims)
+	token.Header["kid"] = signer.Kid()
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(signer.WithContext(ctx))
+}
+
+func GetPublicKey(ctx context.Context) ([]byte, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signer := set.Active("jwks", time.Now())
+	if signer == nil {
+		return nil, fmt.Errorf("%w: jwks", keymanager.ErrNoActiveKey)
+	}
+	out := signer.PubKey
 	pemBlock := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: out.PublicKey})
 	return pemBlock, nil
 }
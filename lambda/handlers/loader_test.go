@@ -2,62 +2,93 @@ package handlers
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
 	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
 	"lambda-ca-kms/mocks"
-	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
 	"go.uber.org/mock/gomock"
 )
 
-func TestLoadConfigCases(t *testing.T) {
-	t.Run("Arquivo inexistente", func(t *testing.T) {
-		_, err := loadConfig("naoexiste.yaml")
-		if err == nil {
-			t.Error("esperado erro de arquivo ausente")
-		}
-	})
-	t.Run("YAML inválido", func(t *testing.T) {
-		temp := t.TempDir() + "/bad.yaml"
-		os.WriteFile(temp, []byte("{invalid:"), 0644)
-		_, err := loadConfig(temp)
-		if err == nil {
-			t.Error("esperado erro de YAML inválido")
-		}
-	})
-	t.Run("YAML válido", func(t *testing.T) {
-		temp := t.TempDir() + "/ok.yaml"
-		yaml := `
-keys:
-  jwt:
-    - key_id: "alias/test"
-      use_from: "2024-01-01T00:00:00Z"
-expires_policy:
-  overlap_days: 180`
-		os.WriteFile(temp, []byte(yaml), 0644)
-		cfg, err := loadConfig(temp)
-		if err != nil || len(cfg.Keys["jwt"]) != 1 {
-			t.Errorf("erro ao carregar YAML válido: %v", err)
-		}
-	})
-}
-
-func TestLoadKeyGroup_ErrorPath(t *testing.T) {
+func TestLoadKeyGroups_RelatorioAgregado(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mock := mocks.NewMockKMSClient(ctrl)
-	mock.EXPECT().GetPublicKey(gomock.Any(), gomock.Any()).Return(nil, assertError("falha simulada"))
+	der, _ := generateTestKey(t)
+	mock := mocks.NewMockKeyClient(ctrl)
+	mock.EXPECT().GetPublicKey(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+			if aws.ToString(in.KeyId) == "alias/fora-do-ar" {
+				return nil, assertError("falha simulada")
+			}
+			return &kms.GetPublicKeyOutput{KeyId: in.KeyId, KeySpec: types.KeySpecEccNistP256, PublicKey: der}, nil
+		}).AnyTimes()
+	mock.EXPECT().DescribeKey(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+			md := &types.KeyMetadata{
+				KeyId:             in.KeyId,
+				KeyState:          types.KeyStateEnabled,
+				KeyUsage:          types.KeyUsageTypeSignVerify,
+				SigningAlgorithms: []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256},
+			}
+			if aws.ToString(in.KeyId) == "alias/desabilitada" {
+				md.KeyState = types.KeyStateDisabled
+			}
+			return &kms.DescribeKeyOutput{KeyMetadata: md}, nil
+		}).AnyTimes()
+
+	conf := &keymanager.Config{Keys: map[string][]keymanager.KeyEntry{
+		"jwt":  {{KeyID: "alias/jwt", UseFrom: time.Now()}, {KeyID: "alias/fora-do-ar", UseFrom: time.Now()}},
+		"jose": {{KeyID: "alias/jose-assinatura", UseFrom: time.Now()}},
+		"jwks": {{KeyID: "alias/desabilitada", UseFrom: time.Now()}},
+	}}
+
+	_, err := keymanager.LoadKeyGroups(context.Background(), mock, conf)
+	var report *keymanager.KeyValidationError
+	if !errors.As(err, &report) {
+		t.Fatalf("esperado *KeyValidationError, obtido %v", err)
+	}
 
-	target := []*keymanager.KeyHolder{}
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("esperado panic por erro de GetPublicKey")
+	got := map[string]string{}
+	for _, p := range report.Problems {
+		got[p.KeyID] = p.Check
+	}
+	want := map[string]string{
+		"alias/fora-do-ar":      "get_public_key",
+		"alias/jose-assinatura": "key_usage",
+		"alias/desabilitada":    "key_state",
+	}
+	if len(got) != len(want) {
+		t.Errorf("esperado %d problemas, obtido %v", len(want), report.Problems)
+	}
+	for keyID, check := range want {
+		if got[keyID] != check {
+			t.Errorf("%s: esperado problema %s, obtido %q", keyID, check, got[keyID])
 		}
-	}()
+	}
+	if !errors.Is(err, keymanager.ErrKeyNotEnabled) || !errors.Is(err, keymanager.ErrKeyUsageMismatch) {
+		t.Error("relatório deveria expor os erros de cada verificação via errors.Is")
+	}
+}
 
-	loadKeyGroup(context.Background(), mock, []keymanager.KeyEntry{{KeyID: "fail", UseFrom: time.Now()}}, &target)
+func generateTestKey(t *testing.T) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("erro ao gerar chave: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	return der, priv
 }
 
 func assertError(msg string) error {
@@ -67,3 +98,111 @@ func assertError(msg string) error {
 type mockError struct{ msg string }
 
 func (e *mockError) Error() string { return e.msg }
+
+func TestNewKMSClient_SoftwareBackend(t *testing.T) {
+	t.Setenv("KMS_BACKEND", "software")
+	t.Setenv("SOFTKMS_KEY_DIR", t.TempDir())
+
+	conf := &keymanager.Config{Keys: map[string][]keymanager.KeyEntry{
+		"jwt":  {{KeyID: "alias/jwt-signer", UseFrom: time.Now().Add(-time.Hour)}},
+		"jose": {{KeyID: "alias/passport-decrypter", UseFrom: time.Now().Add(-time.Hour)}},
+		"jwks": {{KeyID: "alias/passport-signer", UseFrom: time.Now().Add(-time.Hour)}},
+	}}
+	conf.SoftwareKMS.KeySpecs = map[string]string{"alias/passport-signer": "RSA_2048"}
+
+	client, err := newKMSClient(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if _, ok := client.(*softkms.Client); !ok {
+		t.Fatalf("esperado cliente softkms, obtido %T", client)
+	}
+
+	set, err := keymanager.NewKeyLoader(client, keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("chaves locais deveriam passar na validação: %v", err)
+	}
+	Keys.Store(set)
+
+	if _, err := GetJWKS(context.Background()); err != nil {
+		t.Errorf("esperado JWKS assinado offline, obtido erro: %v", err)
+	}
+}
+
+func TestSoftwareKeyUsages_Issuers(t *testing.T) {
+	useFrom := time.Now().Add(-time.Hour)
+	conf := &keymanager.Config{
+		Keys: map[string][]keymanager.KeyEntry{"jose": {{KeyID: "alias/raiz-jose", UseFrom: useFrom}}},
+		Issuers: map[string]*keymanager.Config{
+			"a": {Keys: map[string][]keymanager.KeyEntry{"jose": {{KeyID: "alias/a-jose", UseFrom: useFrom}}}},
+			"b": {Keys: map[string][]keymanager.KeyEntry{"jose": {{KeyID: "alias/b-jose", UseFrom: useFrom}}}},
+		},
+	}
+	conf.SoftwareKMS.KeySpecs = map[string]string{"alias/b-jose": "RSA_2048"}
+	conf.SoftwareKMS.KeyUsages = map[string]string{"alias/a-jose": "ENCRYPT_DECRYPT"}
+
+	want := map[string]types.KeyUsageType{
+		"alias/raiz-jose": types.KeyUsageTypeKeyAgreement,
+		"alias/a-jose":    types.KeyUsageTypeEncryptDecrypt,
+		"alias/b-jose":    types.KeyUsageTypeEncryptDecrypt,
+	}
+	usages := softwareKeyUsages(conf)
+	for keyID, usage := range want {
+		if usages[keyID] != usage {
+			t.Errorf("%s: esperado %s, obtido %s", keyID, usage, usages[keyID])
+		}
+	}
+}
+
+func TestSharedAWSClients_CriadosUmaVez(t *testing.T) {
+	t.Setenv("AWS_REGION", "sa-east-1")
+	t.Setenv("KMS_BACKEND", "aws")
+	first, err := newKMSClient(context.Background(), &keymanager.Config{})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	again, _ := newKMSClient(context.Background(), &keymanager.Config{})
+	if first != again {
+		t.Error("recargas deveriam reaproveitar o cliente do KMS")
+	}
+	ssmSource, _ := openConfigSource(context.Background(), "ssm:///lambda-ca/kms-keys")
+	s3Source, _ := openConfigSource(context.Background(), "s3://bucket/kms-keys.yaml")
+	if ssmSource.(*keymanager.SSMSource).Client != awsShared.sources.SSM || s3Source.(*keymanager.S3Source).Client != awsShared.sources.S3 {
+		t.Error("origens deveriam usar os clientes compartilhados")
+	}
+}
+
+func TestNewKMSClient_UnknownBackend(t *testing.T) {
+	t.Setenv("KMS_BACKEND", "hsm")
+	if _, err := newKMSClient(context.Background(), &keymanager.Config{}); err == nil {
+		t.Error("esperado erro para backend desconhecido")
+	}
+}
+
+func TestLoadKeySet_MantemSnapshotDaMesmaVersao(t *testing.T) {
+	t.Setenv("KMS_BACKEND", "software")
+	t.Setenv("SOFTKMS_KEY_DIR", t.TempDir())
+	t.Setenv("KMS_CONFIG_SOURCE", "env://KMS_CONFIG_TESTE")
+	conf := `{"issuer":"env.ca.internal","keys":{"jwt":[{"key_id":"alias/jwt-signer","use_from":"2024-01-01T00:00:00Z"}],` +
+		`"jwks":[{"key_id":"alias/passport-signer","use_from":"2024-01-01T00:00:00Z"}]}}`
+	t.Setenv("KMS_CONFIG_TESTE", conf)
+	Keys.Store(nil)
+
+	first, err := loadKeySet(context.Background())
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(first)
+	if again, _ := loadKeySet(context.Background()); again != first {
+		t.Error("mesma versão deveria manter o snapshot atual")
+	}
+
+	t.Setenv("KMS_CONFIG_TESTE", strings.Replace(conf, "env.ca.internal", "novo.ca.internal", 1))
+	changed, err := loadKeySet(context.Background())
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	if changed == first || changed.Version() == first.Version() || changed.Issuer() != "novo.ca.internal" {
+		t.Errorf("versão nova deveria gerar outro snapshot: %s -> %s", first.Version(), changed.Version())
+	}
+}
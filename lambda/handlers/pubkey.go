@@ -7,7 +7,7 @@ import (
 )
 
 func HandleGetPublicKey(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	pemBlock, err := GetPublicKey()
+	pemBlock, err := GetPublicKey(ctx)
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: err.Error()}, nil
 	}
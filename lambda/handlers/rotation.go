@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lambda-ca-kms/internal/services/keymanager"
+)
+
+// Rotação automática das chaves: lê a configuração de uri (vazio: a mesma do
+// serviço, ver configSourceURI), cria no KMS as chaves devidas pela política e
+// grava as entradas novas na origem. Um registro JSON por rotação vai para audit.
+func RunRotation(ctx context.Context, uri string, dryRun bool, audit io.Writer) (*keymanager.RotationResult, error) {
+	if uri == "" {
+		uri = configSourceURI()
+	}
+	source, err := openConfigSource(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := source.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	client, err := newKMSClient(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	rotator, ok := client.(keymanager.RotationClient)
+	if !ok {
+		return nil, fmt.Errorf("backend de KMS %T não cria chaves", client)
+	}
+
+	job, err := keymanager.NewRotationJob(rotator, source, keymanager.ReealClock())
+	if err != nil {
+		return nil, err
+	}
+	job.WithAudit(audit)
+	if dryRun {
+		job.WithDryRun()
+	}
+	return job.Run(ctx)
+}
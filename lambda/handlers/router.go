@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"lambda-ca-kms/internal/services/keymanager"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type keySetKey struct{}
+
+// KeySet escolhido para a requisição por Route; sem ele, o snapshot raiz corrente
+func currentKeySet(ctx context.Context) (*keymanager.KeySet, error) {
+	if set, ok := ctx.Value(keySetKey{}).(*keymanager.KeySet); ok {
+		return set, nil
+	}
+	set := Keys.Current()
+	if set == nil {
+		return nil, keymanager.ErrNoKeySet
+	}
+	return set, nil
+}
+
+// Contexto com o KeySet do issuer da requisição e o caminho sem o prefixo do
+// issuer. O snapshot é obtido uma única vez, então a requisição inteira usa as
+// mesmas chaves mesmo que haja recarga no meio.
+func ResolveIssuer(ctx context.Context, req events.APIGatewayProxyRequest) (context.Context, string, error) {
+	root := Keys.Current()
+	if root == nil {
+		return ctx, req.Path, keymanager.ErrNoKeySet
+	}
+	set, path := root.Route(requestHost(req), req.Path)
+	return context.WithValue(ctx, keySetKey{}, set), path, nil
+}
+
+func requestHost(req events.APIGatewayProxyRequest) string {
+	return requestHeader(req, "Host")
+}
+
+// Cabeçalho sem diferenciar maiúsculas; o API Gateway repassa como o cliente enviou
+func requestHeader(req events.APIGatewayProxyRequest, name string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Roteia a requisição para o handler do caminho, já no escopo do issuer
+func Route(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	ctx, path, err := ResolveIssuer(ctx, req)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+
+	switch path {
+	case "/sign-csr":
+		return HandleSignCSR(ctx, req)
+	case "/sign-jwt":
+		return HandleSignJWT(ctx, req)
+	case "/verify-jwt":
+		return HandleVerifyJWT(ctx, req)
+	case keymanager.IntrospectPath:
+		return HandleIntrospect(ctx, req)
+	case "/public-key":
+		return HandleGetPublicKey(ctx, req)
+	case keymanager.SignedJWKSPath:
+		return HandleGetJWKS(ctx, req)
+	case keymanager.JWKSPath:
+		return HandleGetJWKSet(ctx, req)
+	case "/.well-known/openid-configuration", "/.well-known/oauth-authorization-server":
+		return HandleGetDiscovery(ctx, req)
+	case "/issuer-config":
+		return HandleGetIssuerConfig(ctx, req)
+	case "/issuer-config/schema":
+		return HandleGetIssuerConfigSchema(ctx, req)
+	case "/health":
+		return HandleHealth(ctx, req)
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotFound,
+			Body:       "rota não encontrada",
+		}, nil
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoute_PorIssuer(t *testing.T) {
+	useFrom := time.Now().Add(-time.Hour)
+	issuer := func(name string) *keymanager.Config {
+		return &keymanager.Config{Issuer: name + ".ca.internal", Keys: map[string][]keymanager.KeyEntry{
+			"jwt":  {{KeyID: "alias/" + name + "-jwt", UseFrom: useFrom}},
+			"jwks": {{KeyID: "alias/" + name + "-jwks", UseFrom: useFrom}},
+		}}
+	}
+	conf := &keymanager.Config{Issuers: map[string]*keymanager.Config{"a": issuer("a"), "b": issuer("b")}}
+	conf.Issuers["b"].Hosts = []string{"b.ca.internal"}
+
+	set, err := keymanager.NewKeyLoader(softkms.New(), keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(set)
+
+	kids := map[string]string{}
+	for name, req := range map[string]events.APIGatewayProxyRequest{
+		"a": {Path: "/a/.well-known/jwks.json"},
+		"b": {Path: "/.well-known/jwks.json", Headers: map[string]string{"host": "b.ca.internal"}},
+	} {
+		resp, _ := Route(context.Background(), req)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: esperado 200, obtido %d: %s", name, resp.StatusCode, resp.Body)
+		}
+		var jwks keymanager.JWKS
+		if err := json.Unmarshal([]byte(resp.Body), &jwks); err != nil || len(jwks.Keys) != 1 {
+			t.Fatalf("%s: JWKS inesperado: %s", name, resp.Body)
+		}
+		kids[name] = jwks.Keys[0].Kid
+	}
+	if kids["a"] == kids["b"] {
+		t.Error("issuers diferentes deveriam publicar chaves diferentes")
+	}
+
+	issuers := map[string]string{}
+	for name, req := range map[string]events.APIGatewayProxyRequest{
+		"a": {Path: "/a" + keymanager.SignedJWKSPath},
+		"b": {Path: keymanager.SignedJWKSPath, Headers: map[string]string{"host": "b.ca.internal"}},
+	} {
+		resp, _ := Route(context.Background(), req)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: esperado 200 no JWKS assinado, obtido %d: %s", name, resp.StatusCode, resp.Body)
+		}
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(resp.Body, claims); err != nil {
+			t.Fatalf("%s: JWKS assinado inválido: %v", name, err)
+		}
+		issuers[name], _ = claims["iss"].(string)
+	}
+	if issuers["a"] != "a.ca.internal" || issuers["b"] != "b.ca.internal" {
+		t.Errorf("iss do JWKS assinado deveria ser o do issuer roteado, obtido %v", issuers)
+	}
+
+	resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{Path: "/a/.well-known/openid-configuration"})
+	var doc keymanager.DiscoveryDocument
+	json.Unmarshal([]byte(resp.Body), &doc)
+	if doc.Issuer != "https://a.ca.internal" {
+		t.Errorf("descoberta deveria ser do issuer a, obtido %q", doc.Issuer)
+	}
+
+	if resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{Path: "/sign-jwt"}); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("raiz sem chaves não deveria assinar, obtido %d", resp.StatusCode)
+	}
+	if resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{Path: "/a/nao-existe"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("esperado 404, obtido %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type verifyRequest struct {
+	Token    string `json:"token"`
+	Audience string `json:"audience,omitempty"` // padrão: verify_policy.audiences
+}
+
+// Verifica um JWT com as chaves jwt publicadas pelo issuer. Token válido ou
+// não, a resposta é 200 com {"valid", "kid", "alg", "claims", "error", "reason"};
+// 400 fica para corpo inválido.
+func HandleVerifyJWT(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	set, err := currentKeySet(ctx)
+	if err != nil {
+		return jwksErrorResponse(err), nil
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "corpo em base64 inválido"}, nil
+	}
+	var in verifyRequest
+	if err := json.Unmarshal(body, &in); err != nil || in.Token == "" {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: `corpo deve ser {"token": "..."}`}, nil
+	}
+
+	now := time.Now()
+	set.ConfirmPublished(ctx, now)
+	out, err := json.Marshal(set.VerifyJWT(in.Token, in.Audience, now))
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Body: "erro interno"}, nil
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(out),
+	}, nil
+}
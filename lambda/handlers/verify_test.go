@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"lambda-ca-kms/internal/services/keymanager"
+	"lambda-ca-kms/internal/services/softkms"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandleVerifyJWT(t *testing.T) {
+	conf := &keymanager.Config{
+		Issuer: "ca.internal",
+		Keys: map[string][]keymanager.KeyEntry{
+			"jwt": {{KeyID: "alias/jwt", UseFrom: time.Now().Add(-time.Hour)}},
+		},
+	}
+	set, err := keymanager.NewKeyLoader(softkms.New(), keymanager.DefaultRetryPolicy, keymanager.ReealClock()).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	Keys.Store(set)
+	signed, _ := Route(context.Background(), events.APIGatewayProxyRequest{Path: "/sign-jwt", Body: `{"sub":"svc-a","aud":"api.interna"}`})
+	if signed.StatusCode != http.StatusOK {
+		t.Fatalf("falha ao emitir token: %d %s", signed.StatusCode, signed.Body)
+	}
+	token := signed.Body
+
+	tests := []struct {
+		name      string
+		body      string
+		status    int
+		wantValid bool
+		wantError string
+	}{
+		{"token válido", `{"token":"` + token + `","audience":"api.interna"}`, http.StatusOK, true, ""},
+		{"audiência diferente", `{"token":"` + token + `","audience":"faturamento"}`, http.StatusOK, false, "invalid_audience"},
+		{"token malformado", `{"token":"abc"}`, http.StatusOK, false, "malformed"},
+		{"sem token", `{}`, http.StatusBadRequest, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := Route(context.Background(), events.APIGatewayProxyRequest{Path: "/verify-jwt", Body: tt.body})
+			if resp.StatusCode != tt.status {
+				t.Fatalf("esperado %d, obtido %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var result keymanager.VerifyResult
+			if err := json.Unmarshal([]byte(resp.Body), &result); err != nil {
+				t.Fatalf("resposta inválida: %v", err)
+			}
+			if result.Valid != tt.wantValid || result.Error != tt.wantError {
+				t.Errorf("resultado inesperado: %s", resp.Body)
+			}
+			if tt.wantValid && (result.Kid != set.Active("jwt", time.Now()).Kid() || result.Claims["sub"] != "svc-a") {
+				t.Errorf("kid ou claims inesperados: %s", resp.Body)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 type KeyManager interface {
 	JWKSCurrent(ctx context.Context) (string, error)
+	JWKSet(ctx context.Context) ([]byte, error)
+	Discovery(ctx context.Context) ([]byte, error)
 	JWKSPublicKey(ctx context.Context) ([]byte, error)
 	IssuerConfig(ctx context.Context) ([]byte, error)
 }
@@ -0,0 +1,182 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+// Algoritmo JWS suportado, com o método de assinatura via KMS e as specs compatíveis
+type SigningAlgorithm struct {
+	Name   string
+	Method *jwtkms.KMSSigningMethod
+	KMS    types.SigningAlgorithmSpec
+	Specs  []types.KeySpec
+}
+
+var rsaSpecs = []types.KeySpec{types.KeySpecRsa2048, types.KeySpecRsa3072, types.KeySpecRsa4096}
+
+// Registro único usado tanto na assinatura quanto no "alg" publicado no JWKS
+var signingAlgorithms = map[string]*SigningAlgorithm{
+	"ES256": {"ES256", jwtkms.SigningMethodECDSA256, types.SigningAlgorithmSpecEcdsaSha256, []types.KeySpec{types.KeySpecEccNistP256}},
+	"ES384": {"ES384", jwtkms.SigningMethodECDSA384, types.SigningAlgorithmSpecEcdsaSha384, []types.KeySpec{types.KeySpecEccNistP384}},
+	"ES512": {"ES512", jwtkms.SigningMethodECDSA512, types.SigningAlgorithmSpecEcdsaSha512, []types.KeySpec{types.KeySpecEccNistP521}},
+	"RS256": {"RS256", jwtkms.SigningMethodRS256, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, rsaSpecs},
+	"RS384": {"RS384", jwtkms.SigningMethodRS384, types.SigningAlgorithmSpecRsassaPkcs1V15Sha384, rsaSpecs},
+	"RS512": {"RS512", jwtkms.SigningMethodRS512, types.SigningAlgorithmSpecRsassaPkcs1V15Sha512, rsaSpecs},
+	"PS256": {"PS256", jwtkms.SigningMethodPS256, types.SigningAlgorithmSpecRsassaPssSha256, rsaSpecs},
+	"PS384": {"PS384", jwtkms.SigningMethodPS384, types.SigningAlgorithmSpecRsassaPssSha384, rsaSpecs},
+	"PS512": {"PS512", jwtkms.SigningMethodPS512, types.SigningAlgorithmSpecRsassaPssSha512, rsaSpecs},
+}
+
+// Algoritmo usado quando a chave não declara "alg" no YAML
+var defaultSigningAlgorithms = map[types.KeySpec]string{
+	types.KeySpecEccNistP256: "ES256",
+	types.KeySpecEccNistP384: "ES384",
+	types.KeySpecEccNistP521: "ES512",
+	types.KeySpecRsa2048:     "PS256",
+	types.KeySpecRsa3072:     "PS256",
+	types.KeySpecRsa4096:     "PS256",
+}
+
+func LookupSigningAlgorithm(name string) (*SigningAlgorithm, bool) {
+	alg, ok := signingAlgorithms[name]
+	return alg, ok
+}
+
+func (a *SigningAlgorithm) Supports(spec types.KeySpec) bool {
+	for _, s := range a.Specs {
+		if s == spec {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve o algoritmo de assinatura para a spec: o "alg" explícito precisa ser
+// compatível com a chave; sem ele, usa o padrão da spec
+func ResolveSigningAlgorithm(alg string, spec types.KeySpec) (*SigningAlgorithm, error) {
+	if alg == "" {
+		name, ok := defaultSigningAlgorithms[spec]
+		if !ok {
+			return nil, fmt.Errorf("%w: nenhum algoritmo JWS para a spec %s", ErrConfiguredKeyNotSupported, spec)
+		}
+		return signingAlgorithms[name], nil
+	}
+
+	found, ok := signingAlgorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: algoritmo desconhecido %s", ErrConfiguredKeyNotSupported, alg)
+	}
+	if !found.Supports(spec) {
+		return nil, fmt.Errorf("%w: algoritmo %s incompatível com a spec %s", ErrConfiguredKeyNotSupported, alg, spec)
+	}
+	return found, nil
+}
+
+// Deduz a spec do KMS a partir da chave pública DER, quando o KMS não a informou
+func keySpecFromDER(der []byte) types.KeySpec {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return ""
+	}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return types.KeySpec(fmt.Sprintf("RSA_%d", k.N.BitLen()))
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().Name {
+		case "P-256":
+			return types.KeySpecEccNistP256
+		case "P-384":
+			return types.KeySpecEccNistP384
+		case "P-521":
+			return types.KeySpecEccNistP521
+		}
+	}
+	return ""
+}
+
+// Algoritmo JWE de gerenciamento de chave anunciado para chaves "enc"
+type EncryptionAlgorithm struct {
+	Name   string
+	KMS    types.EncryptionAlgorithmSpec // vazio para ECDH-ES, que não usa Decrypt do KMS
+	Kty    string
+	KeyOps []string
+}
+
+var encryptionAlgorithms = map[string]*EncryptionAlgorithm{
+	"RSA-OAEP":       {"RSA-OAEP", types.EncryptionAlgorithmSpecRsaesOaepSha1, "RSA", []string{"encrypt", "wrapKey"}},
+	"RSA-OAEP-256":   {"RSA-OAEP-256", types.EncryptionAlgorithmSpecRsaesOaepSha256, "RSA", []string{"encrypt", "wrapKey"}},
+	"ECDH-ES":        {"ECDH-ES", "", "EC", []string{"deriveKey"}},
+	"ECDH-ES+A128KW": {"ECDH-ES+A128KW", "", "EC", []string{"deriveKey", "wrapKey"}},
+	"ECDH-ES+A192KW": {"ECDH-ES+A192KW", "", "EC", []string{"deriveKey", "wrapKey"}},
+	"ECDH-ES+A256KW": {"ECDH-ES+A256KW", "", "EC", []string{"deriveKey", "wrapKey"}},
+}
+
+var defaultEncryptionAlgorithms = map[string]string{
+	"RSA": "RSA-OAEP-256",
+	"EC":  "ECDH-ES",
+}
+
+// Operações anunciadas em key_ops para chaves de assinatura
+var signingKeyOps = []string{"verify"}
+
+func LookupEncryptionAlgorithm(name string) (*EncryptionAlgorithm, bool) {
+	alg, ok := encryptionAlgorithms[name]
+	return alg, ok
+}
+
+// Resolve o algoritmo JWE para a spec, validando o "alg" explícito contra o tipo da chave
+func ResolveEncryptionAlgorithm(alg string, spec types.KeySpec) (*EncryptionAlgorithm, error) {
+	kty := ktyOf(spec)
+	if kty == "" {
+		return nil, fmt.Errorf("%w: nenhum algoritmo JWE para a spec %s", ErrConfiguredKeyNotSupported, spec)
+	}
+	if alg == "" {
+		alg = defaultEncryptionAlgorithms[kty]
+	}
+
+	found, ok := encryptionAlgorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: algoritmo de cifragem desconhecido %s", ErrConfiguredKeyNotSupported, alg)
+	}
+	if found.Kty != kty {
+		return nil, fmt.Errorf("%w: algoritmo %s incompatível com a spec %s", ErrConfiguredKeyNotSupported, alg, spec)
+	}
+	return found, nil
+}
+
+func ktyOf(spec types.KeySpec) string {
+	switch spec {
+	case types.KeySpecRsa2048, types.KeySpecRsa3072, types.KeySpecRsa4096:
+		return "RSA"
+	case types.KeySpecEccNistP256, types.KeySpecEccNistP384, types.KeySpecEccNistP521:
+		return "EC"
+	default:
+		return ""
+	}
+}
+
+// Algoritmo e key_ops publicados no JWK conforme o uso da chave
+func jwkAlgorithm(key *KeyHolder, use string) (string, []string, error) {
+	switch use {
+	case "sig":
+		alg, err := key.SigningAlgorithm()
+		if err != nil {
+			return "", nil, err
+		}
+		return alg.Name, signingKeyOps, nil
+	case "enc":
+		alg, err := key.EncryptionAlgorithm()
+		if err != nil {
+			return "", nil, err
+		}
+		return alg.Name, alg.KeyOps, nil
+	default:
+		return "", nil, fmt.Errorf("%w: %q", ErrUnsupportedKeyUse, use)
+	}
+}
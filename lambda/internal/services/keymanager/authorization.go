@@ -0,0 +1,220 @@
+package keymanager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrAccessDenied         = errors.New("caller not allowed")
+	ErrInvalidAuthorization = errors.New("invalid authorization rules")
+)
+
+// Nome usado em profiles e csr_templates para /sign-jwt sem ?profile e
+// /sign-csr sem ?template
+const DefaultProfile = "default"
+
+// Identidade do chamador, extraída do contexto da requisição do API Gateway
+type Caller struct {
+	ARN       string            // identity.userArn (autorização IAM)
+	Principal string            // principalId do authorizer Lambda
+	Claims    map[string]string // claims do Cognito ou contexto do authorizer; listas separadas por vírgula
+}
+
+// Identificação do chamador nas mensagens de erro e no log
+func (c Caller) String() string {
+	switch {
+	case c.ARN != "":
+		return c.ARN
+	case c.Principal != "":
+		return c.Principal
+	case c.Claims["sub"] != "":
+		return "sub " + c.Claims["sub"]
+	}
+	return "anônimo"
+}
+
+func (c Caller) anonymous() bool {
+	return c.ARN == "" && c.Principal == "" && len(c.Claims) == 0
+}
+
+// Regras de acesso a /sign-jwt e /sign-csr. Sem a seção, qualquer chamador
+// que alcance a função pode assinar.
+type AuthorizationConfig struct {
+	Rules []AccessRule `yaml:"rules"`
+}
+
+// Regra de acesso; todos os critérios de identidade informados precisam
+// bater. Padrões aceitam * como curinga, inclusive sobre "/".
+type AccessRule struct {
+	Name         string            `yaml:"name"`
+	IAMArn       string            `yaml:"iam_arn"`       // ex.: arn:aws:sts::123456789012:assumed-role/svc-*
+	Principal    string            `yaml:"principal"`     // principalId do authorizer Lambda
+	Claims       map[string]string `yaml:"claims"`        // ex.: cognito:groups: admins
+	Profiles     []string          `yaml:"profiles"`      // perfis de /sign-jwt; "default" é a token_policy
+	Audiences    []string          `yaml:"audiences"`     // aud permitidos; vazio aceita os do perfil
+	CSRTemplates []string          `yaml:"csr_templates"` // templates de /sign-csr
+}
+
+func (r AccessRule) matches(caller Caller) bool {
+	if r.IAMArn != "" && !wildcardMatch(r.IAMArn, caller.ARN) {
+		return false
+	}
+	if r.Principal != "" && !wildcardMatch(r.Principal, caller.Principal) {
+		return false
+	}
+	for claim, pattern := range r.Claims {
+		value, ok := caller.Claims[claim]
+		if !ok || !slices.ContainsFunc(strings.Split(value, ","), func(v string) bool {
+			return wildcardMatch(pattern, strings.TrimSpace(v))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r AccessRule) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return "sem nome"
+}
+
+// Confere se o chamador pode emitir um token do perfil com as audiências
+// pedidas; o erro traz o motivo da recusa
+func (a *AuthorizationConfig) AuthorizeToken(caller Caller, profile string, audiences []string) error {
+	if a == nil {
+		return nil
+	}
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	return a.authorize(caller, func(r AccessRule) error {
+		if !matchesAny(r.Profiles, profile) {
+			return fmt.Errorf("perfil %q não permitido", profile)
+		}
+		if len(r.Audiences) == 0 {
+			return nil
+		}
+		if len(audiences) == 0 {
+			return fmt.Errorf("token sem aud")
+		}
+		for _, aud := range audiences {
+			if !matchesAny(r.Audiences, aud) {
+				return fmt.Errorf("audiência %q não permitida", aud)
+			}
+		}
+		return nil
+	})
+}
+
+// Confere se o chamador pode usar o template de CSR
+func (a *AuthorizationConfig) AuthorizeCSR(caller Caller, template string) error {
+	if a == nil {
+		return nil
+	}
+	if template == "" {
+		template = DefaultProfile
+	}
+	return a.authorize(caller, func(r AccessRule) error {
+		if !matchesAny(r.CSRTemplates, template) {
+			return fmt.Errorf("template de CSR %q não permitido", template)
+		}
+		return nil
+	})
+}
+
+// Basta uma regra do chamador permitir; a recusa usa o motivo da primeira
+func (a *AuthorizationConfig) authorize(caller Caller, check func(AccessRule) error) error {
+	if caller.anonymous() {
+		return fmt.Errorf("%w: chamador não identificado", ErrAccessDenied)
+	}
+	var denied error
+	for _, rule := range a.Rules {
+		if !rule.matches(caller) {
+			continue
+		}
+		err := check(rule)
+		if err == nil {
+			return nil
+		}
+		if denied == nil {
+			denied = fmt.Errorf("%w: %s (regra %s): %w", ErrAccessDenied, caller, rule.label(), err)
+		}
+	}
+	if denied == nil {
+		denied = fmt.Errorf("%w: nenhuma regra para %s", ErrAccessDenied, caller)
+	}
+	return denied
+}
+
+func (a *AuthorizationConfig) validate(profiles map[string]TokenProfile) error {
+	var errs []error
+	for i, rule := range a.Rules {
+		if rule.IAMArn == "" && rule.Principal == "" && len(rule.Claims) == 0 {
+			errs = append(errs, fmt.Errorf("regra %d (%s): informe iam_arn, principal ou claims", i, rule.label()))
+		}
+		for _, name := range rule.Profiles {
+			if _, ok := profiles[name]; !ok && name != DefaultProfile && !strings.Contains(name, "*") {
+				errs = append(errs, fmt.Errorf("regra %d (%s): perfil %q não existe em token_profiles", i, rule.label(), name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Valida as regras do nível raiz e de cada issuer
+func (c *Config) validateAuthorization() error {
+	var errs []error
+	if c.Authorization != nil {
+		if err := c.Authorization.validate(c.Profiles); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidAuthorization, err))
+		}
+	}
+	for _, name := range c.IssuerNames() {
+		if issuer := c.Issuers[name]; issuer.Authorization != nil {
+			if err := issuer.Authorization.validate(issuer.Profiles); err != nil {
+				errs = append(errs, fmt.Errorf("%w: issuer %s: %w", ErrInvalidAuthorization, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Audiências do token assinado, aceitando o formato do chamador e o do perfil
+func TokenAudiences(claims jwt.MapClaims) []string {
+	if aud, ok := claims["aud"].(jwt.ClaimStrings); ok {
+		return aud
+	}
+	aud, _ := claimStrings(claims["aud"])
+	return aud
+}
+
+func matchesAny(patterns []string, value string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool { return wildcardMatch(p, value) })
+}
+
+// Casamento com * como curinga de qualquer sequência, incluindo "/"
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
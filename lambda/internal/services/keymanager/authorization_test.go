@@ -0,0 +1,123 @@
+package keymanager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizationConfig_AuthorizeToken(t *testing.T) {
+	authz := &AuthorizationConfig{Rules: []AccessRule{
+		{Name: "servicos", IAMArn: "arn:aws:sts::123456789012:assumed-role/svc-*", Profiles: []string{"service-to-service"}, Audiences: []string{"api.interna"}},
+		{Name: "admins", Claims: map[string]string{"cognito:groups": "admins"}, Profiles: []string{"short-lived-admin", "default"}},
+		{Name: "parceiros", Principal: "partner-*", Profiles: []string{"partner-*"}},
+	}}
+
+	tests := []struct {
+		name       string
+		caller     Caller
+		profile    string
+		audiences  []string
+		wantReason string // vazio: permitido
+	}{
+		{"papel IAM liberado", Caller{ARN: "arn:aws:sts::123456789012:assumed-role/svc-billing/sessao"}, "service-to-service", []string{"api.interna"}, ""},
+		{"papel IAM com audiência proibida", Caller{ARN: "arn:aws:sts::123456789012:assumed-role/svc-billing/sessao"}, "service-to-service", []string{"parceiros"}, `audiência "parceiros"`},
+		{"papel IAM sem aud", Caller{ARN: "arn:aws:sts::123456789012:assumed-role/svc-billing/sessao"}, "service-to-service", nil, "token sem aud"},
+		{"papel IAM com outro perfil", Caller{ARN: "arn:aws:sts::123456789012:assumed-role/svc-billing/sessao"}, "short-lived-admin", []string{"api.interna"}, `perfil "short-lived-admin"`},
+		{"grupo do Cognito", Caller{Claims: map[string]string{"sub": "u-1", "cognito:groups": "leitores,admins"}}, "short-lived-admin", nil, ""},
+		{"perfil padrão", Caller{Claims: map[string]string{"cognito:groups": "admins"}}, "", nil, ""},
+		{"grupo ausente", Caller{Claims: map[string]string{"sub": "u-2", "cognito:groups": "leitores"}}, "short-lived-admin", nil, "nenhuma regra para sub u-2"},
+		{"authorizer Lambda", Caller{Principal: "partner-acme"}, "partner-passport", []string{"parceiros"}, ""},
+		{"chamador anônimo", Caller{}, "service-to-service", nil, "chamador não identificado"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authz.AuthorizeToken(tt.caller, tt.profile, tt.audiences)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("esperado acesso, obtido %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), tt.wantReason) {
+				t.Errorf("esperado recusa com %q, obtido %v", tt.wantReason, err)
+			}
+		})
+	}
+}
+
+func TestAuthorizationConfig_AuthorizeCSR(t *testing.T) {
+	authz := &AuthorizationConfig{Rules: []AccessRule{
+		{IAMArn: "arn:aws:iam::123456789012:role/*", CSRTemplates: []string{"server-tls"}},
+	}}
+	caller := Caller{ARN: "arn:aws:iam::123456789012:role/ingress"}
+	if err := authz.AuthorizeCSR(caller, "server-tls"); err != nil {
+		t.Errorf("esperado acesso ao template, obtido %v", err)
+	}
+	if err := authz.AuthorizeCSR(caller, ""); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("template padrão não liberado, obtido %v", err)
+	}
+	if err := (*AuthorizationConfig)(nil).AuthorizeCSR(Caller{}, "qualquer"); err != nil {
+		t.Errorf("sem authorization tudo é permitido, obtido %v", err)
+	}
+}
+
+func TestLoadConfig_Authorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"regras válidas", `
+token_profiles:
+  service-to-service: {}
+authorization:
+  rules:
+    - name: servicos
+      iam_arn: arn:aws:sts::123456789012:assumed-role/svc-*
+      profiles: [service-to-service, default]
+      csr_templates: [server-tls]`, false},
+		{"regra sem identidade", `
+authorization:
+  rules:
+    - profiles: [default]`, true},
+		{"perfil inexistente", `
+issuers:
+  produto-a:
+    authorization:
+      rules:
+        - principal: svc-a
+          profiles: [partner-passport]`, true},
+		{"perfil com nome reservado", `
+token_profiles:
+  default: {}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"svc-a", "svc-a", true},
+		{"svc-a", "svc-ab", false},
+		{"*", "", true},
+		{"arn:aws:sts::1:assumed-role/*", "arn:aws:sts::1:assumed-role/svc/sessao", true},
+		{"a*b*c", "a-b-b-c", true},
+		{"a*a", "a", false},
+		{"*-admin", "ops-admin", true},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, esperado %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
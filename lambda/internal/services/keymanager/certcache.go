@@ -0,0 +1,205 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var ErrCertificateConflict = errors.New("certificate changed in cache")
+
+// Certificados DER do x5c guardados entre recargas e cold starts, para que
+// x5c e x5t#S256 só mudem quando o certificado é renovado. Get retorna
+// ErrCacheMiss quando o certificado não está guardado; Put só grava se o
+// certificado guardado ainda for previous (nil: nenhum) e, do contrário,
+// retorna ErrCertificateConflict, para que instâncias concorrentes fiquem
+// com o mesmo certificado.
+type CertificateCache interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, der, previous []byte) error
+}
+
+// Mesmo backend do cache de chaves públicas (public_key_cache)
+func NewCertificateCache(cfg PublicKeyCacheConfig) (CertificateCache, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemoryCertificateCache(), nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, errors.New("cache de certificados em arquivo exige dir")
+		}
+		return NewFileCertificateCache(cfg.Dir), nil
+	default:
+		return nil, fmt.Errorf("backend de cache de certificados desconhecido: %s", cfg.Backend)
+	}
+}
+
+func certificateFile(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:]) + ".der"
+}
+
+type MemoryCertificateCache struct {
+	mu    sync.RWMutex
+	certs map[string][]byte
+}
+
+func NewMemoryCertificateCache() *MemoryCertificateCache {
+	return &MemoryCertificateCache{certs: map[string][]byte{}}
+}
+
+func (c *MemoryCertificateCache) Get(ctx context.Context, name string) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	der, ok := c.certs[name]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return der, nil
+}
+
+func (c *MemoryCertificateCache) Put(ctx context.Context, name string, der, previous []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !bytes.Equal(c.certs[name], previous) {
+		return fmt.Errorf("%w: %s", ErrCertificateConflict, name)
+	}
+	c.certs[name] = der
+	return nil
+}
+
+// Um arquivo DER por certificado, nomeado pelo SHA-256 do nome, no diretório
+// do cache de chaves públicas. Só é compartilhado entre processos da mesma
+// máquina; entre instâncias da Lambda, use certificate_store.
+type FileCertificateCache struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileCertificateCache(dir string) *FileCertificateCache {
+	return &FileCertificateCache{dir: dir}
+}
+
+func (c *FileCertificateCache) path(name string) string {
+	return filepath.Join(c.dir, certificateFile(name))
+}
+
+func (c *FileCertificateCache) Get(ctx context.Context, name string) ([]byte, error) {
+	der, err := os.ReadFile(c.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	return der, err
+}
+
+// Grava em arquivo temporário e renomeia, como o cache de chaves públicas
+func (c *FileCertificateCache) Put(ctx context.Context, name string, der, previous []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, err := c.Get(ctx, name)
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		return err
+	}
+	if !bytes.Equal(current, previous) {
+		return fmt.Errorf("%w: %s", ErrCertificateConflict, name)
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".cert-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(der); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(name))
+}
+
+// Certificados num bucket do S3 (certificate_store: s3://bucket/prefixo),
+// compartilhados por todas as instâncias. As gravações são condicionais
+// (If-None-Match na criação, If-Match na renovação): quando duas instâncias
+// emitem ao mesmo tempo, a primeira gravação vale para todas.
+type S3CertificateCache struct {
+	client S3Client
+	bucket string
+	prefix string
+}
+
+func NewS3CertificateCache(client S3Client, uri string) (*S3CertificateCache, error) {
+	target, ok := strings.CutPrefix(uri, "s3://")
+	bucket, prefix, _ := strings.Cut(target, "/")
+	if !ok || bucket == "" {
+		return nil, fmt.Errorf("certificate_store deve ser s3://bucket/prefixo: %s", uri)
+	}
+	return &S3CertificateCache{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (c *S3CertificateCache) key(name string) string {
+	return path.Join(c.prefix, certificateFile(name))
+}
+
+func (c *S3CertificateCache) get(ctx context.Context, name string) ([]byte, *string, error) {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(c.key(name))})
+	var notFound *s3types.NoSuchKey
+	if errors.As(err, &notFound) {
+		return nil, nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer out.Body.Close()
+	der, err := io.ReadAll(out.Body)
+	return der, out.ETag, err
+}
+
+func (c *S3CertificateCache) Get(ctx context.Context, name string) ([]byte, error) {
+	der, _, err := c.get(ctx, name)
+	return der, err
+}
+
+func (c *S3CertificateCache) Put(ctx context.Context, name string, der, previous []byte) error {
+	in := &s3.PutObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(c.key(name)),
+		Body:        bytes.NewReader(der),
+		ContentType: aws.String("application/pkix-cert"),
+	}
+	if previous == nil {
+		in.IfNoneMatch = aws.String("*")
+	} else {
+		current, etag, err := c.get(ctx, name)
+		if err != nil && !errors.Is(err, ErrCacheMiss) {
+			return err
+		}
+		if !bytes.Equal(current, previous) {
+			return fmt.Errorf("%w: %s", ErrCertificateConflict, name)
+		}
+		in.IfMatch = etag
+	}
+	_, err := c.client.PutObject(ctx, in)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+		return fmt.Errorf("%w: %s", ErrCertificateConflict, name)
+	}
+	return err
+}
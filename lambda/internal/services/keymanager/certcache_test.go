@@ -0,0 +1,114 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Bucket em memória com as gravações condicionais do S3
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	puts    int
+}
+
+func newFakeBucket() *fakeBucket {
+	return &fakeBucket{objects: map[string][]byte{}, etags: map[string]string{}}
+}
+
+func (f *fakeBucket) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[aws.ToString(in.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ETag: aws.String(f.etags[aws.ToString(in.Key)])}, nil
+}
+
+func (f *fakeBucket) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("não usado")
+}
+
+func (f *fakeBucket) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(in.Key)
+	etag, exists := f.etags[key]
+	if (in.IfNoneMatch != nil && exists) || (in.IfMatch != nil && aws.ToString(in.IfMatch) != etag) {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+	data, _ := io.ReadAll(in.Body)
+	f.puts++
+	f.objects[key], f.etags[key] = data, fmt.Sprintf(`"%d"`, f.puts)
+	return &s3.PutObjectOutput{ETag: aws.String(f.etags[key])}, nil
+}
+
+func TestCertificateCache_PrimeiraGravacaoVale(t *testing.T) {
+	ctx := context.Background()
+	s3Cache, err := NewS3CertificateCache(newFakeBucket(), "s3://certs/ca/x5c")
+	if err != nil {
+		t.Fatalf("erro ao criar cache: %v", err)
+	}
+	caches := map[string]CertificateCache{
+		"memory": NewMemoryCertificateCache(),
+		"file":   NewFileCertificateCache(t.TempDir()),
+		"s3":     s3Cache,
+	}
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			if _, err := cache.Get(ctx, "leaf"); !errors.Is(err, ErrCacheMiss) {
+				t.Fatalf("esperado ErrCacheMiss, obtido %v", err)
+			}
+			if err := cache.Put(ctx, "leaf", []byte("a"), nil); err != nil {
+				t.Fatalf("erro na primeira gravação: %v", err)
+			}
+			// Outra instância emitiu ao mesmo tempo, sem ver a gravação de "a"
+			if err := cache.Put(ctx, "leaf", []byte("b"), nil); !errors.Is(err, ErrCertificateConflict) {
+				t.Errorf("esperado ErrCertificateConflict, obtido %v", err)
+			}
+			// Renovação sobre um certificado que já foi trocado
+			if err := cache.Put(ctx, "leaf", []byte("c"), []byte("b")); !errors.Is(err, ErrCertificateConflict) {
+				t.Errorf("esperado ErrCertificateConflict, obtido %v", err)
+			}
+			if err := cache.Put(ctx, "leaf", []byte("d"), []byte("a")); err != nil {
+				t.Fatalf("erro na renovação: %v", err)
+			}
+			if der, err := cache.Get(ctx, "leaf"); err != nil || string(der) != "d" {
+				t.Errorf("esperado certificado renovado, obtido %q (%v)", der, err)
+			}
+		})
+	}
+}
+
+func TestNewS3CertificateCache(t *testing.T) {
+	tests := []struct {
+		uri     string
+		wantErr bool
+	}{
+		{"s3://certs/ca/x5c", false},
+		{"s3://certs", false},
+		{"s3:///x5c", true},
+		{"/tmp/certs", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			_, err := NewS3CertificateCache(newFakeBucket(), tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("erro esperado: %v, obtido: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+// Emissão de certificados para o x5c do JWKS
+type CertificateConfig struct {
+	CAKeyID         string `yaml:"ca_key_id"` // vazio: certificados autoassinados via KMS Sign
+	Organization    string `yaml:"organization"`
+	ValidityDays    int    `yaml:"validity_days"`
+	CAValidityDays  int    `yaml:"ca_validity_days"`
+	RenewBeforeDays int    `yaml:"renew_before_days"`
+}
+
+const (
+	defaultCertValidityDays   = 90
+	defaultCAValidityDays     = 3650
+	defaultCertRenewBeforeDay = 15
+	certBackdate              = 5 * time.Minute
+)
+
+// Emite os certificados das chaves de um snapshot no carregamento (Prepare) e
+// os entrega prontos ao JWKS (Attach), sem chamar o KMS nas requisições.
+// Certificados a menos de renew_before_days do fim são reemitidos na recarga
+// seguinte (RenewalDue).
+type CertificateIssuer struct {
+	client jwtkms.KMSClient
+	cfg    CertificateConfig
+	clock  Clock
+	cache  CertificateCache
+
+	mu      sync.RWMutex
+	ca      *x509.Certificate
+	issued  map[string]*x509.Certificate // por leafName
+	renewAt time.Time                    // primeira renovação devida entre os emitidos
+}
+
+func NewCertificateIssuer(client jwtkms.KMSClient, cfg CertificateConfig, clock Clock) *CertificateIssuer {
+	if cfg.ValidityDays <= 0 {
+		cfg.ValidityDays = defaultCertValidityDays
+	}
+	if cfg.CAValidityDays <= 0 {
+		cfg.CAValidityDays = defaultCAValidityDays
+	}
+	if cfg.RenewBeforeDays <= 0 {
+		cfg.RenewBeforeDays = defaultCertRenewBeforeDay
+	}
+	return &CertificateIssuer{
+		client: client,
+		cfg:    cfg,
+		clock:  clock,
+		issued: map[string]*x509.Certificate{},
+	}
+}
+
+// Reaproveita os certificados guardados em cache, desde que confiram com as
+// chaves do KMS, e guarda lá os emitidos
+func (c *CertificateIssuer) WithCache(cache CertificateCache) *CertificateIssuer {
+	c.cache = cache
+	return c
+}
+
+// Emite, ou lê do cache, os certificados das entradas. As chamadas ao KMS
+// acontecem fora do lock; só o resultado é guardado sob ele. Sem CA
+// configurada, chaves "enc" não têm certificado, já que não podem assinar o
+// próprio certificado.
+func (c *CertificateIssuer) Prepare(ctx context.Context, entries []*JWKSEntry) error {
+	now := c.clock.Now()
+	var ca *x509.Certificate
+	if c.cfg.CAKeyID != "" {
+		var err error
+		if ca, err = c.caCertificate(ctx, now); err != nil {
+			return err
+		}
+	}
+
+	issued := map[string]*x509.Certificate{}
+	for _, entry := range entries {
+		if entry == nil || entry.key == nil || (ca == nil && entry.use != "sig") {
+			continue
+		}
+		name := c.leafName(entry.key, entry.use)
+		if leaf := c.current(name); leaf != nil && c.validLeaf(leaf, entry.key, entry.use, ca) && !c.leafNeedsRenewal(leaf, entry.key, now) {
+			continue
+		}
+		leaf, err := c.leaf(ctx, entry.key, entry.use, ca, now)
+		if err != nil {
+			return err
+		}
+		issued[name] = leaf
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ca = ca
+	for name, leaf := range issued {
+		c.issued[name] = leaf
+	}
+	c.renewAt = time.Time{}
+	if ca != nil {
+		c.renewAt = c.renewalTime(ca)
+	}
+	for _, entry := range entries {
+		if entry == nil || entry.key == nil {
+			continue
+		}
+		if leaf := c.issued[c.leafName(entry.key, entry.use)]; leaf != nil {
+			at := c.renewalTime(leaf)
+			if !entry.key.ExpiresAt.IsZero() && !leaf.NotAfter.Before(entry.key.ExpiresAt) {
+				continue // já vai até o fim da chave
+			}
+			if c.renewAt.IsZero() || at.Before(c.renewAt) {
+				c.renewAt = at
+			}
+		}
+	}
+	return nil
+}
+
+// Algum certificado emitido por Prepare já deveria ser renovado
+func (c *CertificateIssuer) RenewalDue(now time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.renewAt.IsZero() && !now.Before(c.renewAt)
+}
+
+func (c *CertificateIssuer) current(name string) *x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.issued[name]
+}
+
+// Preenche a cadeia de certificados de cada entrada do JWKS com o que foi
+// emitido no carregamento; entradas sem certificado válido ficam sem x5c
+func (c *CertificateIssuer) Attach(entries []*JWKSEntry) {
+	for _, entry := range entries {
+		if entry == nil || entry.key == nil {
+			continue
+		}
+		entry.chain = c.Chain(entry.key, entry.use)
+	}
+}
+
+// Cadeia DER (folha primeiro) emitida por Prepare; nil se a chave não tem
+// certificado ou se ele já expirou
+func (c *CertificateIssuer) Chain(key *KeyHolder, use string) [][]byte {
+	now := c.clock.Now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	leaf := c.issued[c.leafName(key, use)]
+	if leaf == nil || !now.Before(leaf.NotAfter) {
+		return nil
+	}
+	if c.ca == nil {
+		return [][]byte{leaf.Raw}
+	}
+	return [][]byte{leaf.Raw, c.ca.Raw}
+}
+
+func (c *CertificateIssuer) renewalTime(cert *x509.Certificate) time.Time {
+	return cert.NotAfter.AddDate(0, 0, -c.cfg.RenewBeforeDays)
+}
+
+func (c *CertificateIssuer) needsRenewal(cert *x509.Certificate, now time.Time) bool {
+	return !now.Before(c.renewalTime(cert))
+}
+
+// O certificado não passa de expires_at da chave; perto do fim da chave só é
+// reemitido se o novo puder ir além do atual
+func (c *CertificateIssuer) leafNeedsRenewal(leaf *x509.Certificate, key *KeyHolder, now time.Time) bool {
+	if key.ExpiresAt.IsZero() {
+		return c.needsRenewal(leaf, now)
+	}
+	return leaf.NotAfter.After(key.ExpiresAt) || (c.needsRenewal(leaf, now) && leaf.NotAfter.Before(key.ExpiresAt))
+}
+
+// Nomes no cache: chave que assina, chave certificada, uso e subject, para que
+// issuers com organization diferente não troquem certificados entre si
+func (c *CertificateIssuer) leafName(key *KeyHolder, use string) string {
+	signer := key.KeyId()
+	if c.cfg.CAKeyID != "" {
+		signer = c.cfg.CAKeyID
+	}
+	return fmt.Sprintf("leaf|%s|%s|%s|%s", signer, key.KeyId(), use, c.subject(key.Kid()))
+}
+
+func (c *CertificateIssuer) caName() string {
+	return fmt.Sprintf("ca|%s|%s", c.cfg.CAKeyID, c.subject("KMS CA"))
+}
+
+// Certificado da chave: o do cache, se válido, ou um novo. Se outra instância
+// gravou um certificado válido no meio tempo, fica com o dela.
+func (c *CertificateIssuer) leaf(ctx context.Context, key *KeyHolder, use string, ca *x509.Certificate, now time.Time) (*x509.Certificate, error) {
+	name := c.leafName(key, use)
+	stored := c.cached(ctx, name)
+	if stored != nil && c.validLeaf(stored, key, use, ca) && !c.leafNeedsRenewal(stored, key, now) {
+		return stored, nil
+	}
+	leaf, err := c.issue(ctx, key, use, ca, now)
+	if err != nil {
+		return nil, err
+	}
+	if other := c.store(ctx, name, leaf, stored); other != nil && c.validLeaf(other, key, use, ca) && !c.leafNeedsRenewal(other, key, now) {
+		return other, nil
+	}
+	return leaf, nil
+}
+
+// Grava o certificado no lugar de previous. Se outra instância gravou antes,
+// retorna o certificado dela; demais falhas só custam uma reemissão.
+func (c *CertificateIssuer) store(ctx context.Context, name string, cert, previous *x509.Certificate) *x509.Certificate {
+	if c.cache == nil {
+		return nil
+	}
+	var prev []byte
+	if previous != nil {
+		prev = previous.Raw
+	}
+	if err := c.cache.Put(ctx, name, cert.Raw, prev); errors.Is(err, ErrCertificateConflict) {
+		return c.cached(ctx, name)
+	}
+	return nil
+}
+
+func (c *CertificateIssuer) cached(ctx context.Context, name string) *x509.Certificate {
+	if c.cache == nil {
+		return nil
+	}
+	der, err := c.cache.Get(ctx, name)
+	if err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
+
+// O certificado certifica a chave pública do KMS com o subject e o uso atuais
+// e está assinado pela CA ou, sem CA, pela própria chave
+func (c *CertificateIssuer) validLeaf(leaf *x509.Certificate, key *KeyHolder, use string, ca *x509.Certificate) bool {
+	if !bytes.Equal(leaf.RawSubjectPublicKeyInfo, key.PubKey.PublicKey) ||
+		!sameSubject(leaf.Subject, c.subject(key.Kid())) || leaf.KeyUsage != leafKeyUsage(leaf.PublicKey, use) {
+		return false
+	}
+	if ca != nil {
+		return leaf.CheckSignatureFrom(ca) == nil
+	}
+	return leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil
+}
+
+// Certificado da CA conferido contra a chave pública da CA no KMS
+func (c *CertificateIssuer) validCA(ca *x509.Certificate, pub crypto.PublicKey, now time.Time) bool {
+	if !ca.IsCA || c.needsRenewal(ca, now) || !sameSubject(ca.Subject, c.subject("KMS CA")) {
+		return false
+	}
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	return err == nil && bytes.Equal(ca.RawSubjectPublicKeyInfo, spki) && ca.CheckSignatureFrom(ca) == nil
+}
+
+func sameSubject(a, b pkix.Name) bool {
+	return a.CommonName == b.CommonName && slices.Equal(a.Organization, b.Organization)
+}
+
+// Certificado autoassinado da CA: o já carregado, o do cache ou um novo
+func (c *CertificateIssuer) caCertificate(ctx context.Context, now time.Time) (*x509.Certificate, error) {
+	c.mu.RLock()
+	current := c.ca
+	c.mu.RUnlock()
+	if current != nil && !c.needsRenewal(current, now) {
+		return current, nil
+	}
+
+	signer, err := newKMSSigner(ctx, c.client, c.cfg.CAKeyID)
+	if err != nil {
+		return nil, err
+	}
+	stored := c.cached(ctx, c.caName())
+	if stored != nil && c.validCA(stored, signer.Public(), now) {
+		return stored, nil
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               c.subject("KMS CA"),
+		NotBefore:             now.Add(-certBackdate),
+		NotAfter:              now.AddDate(0, 0, c.cfg.CAValidityDays),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, signer.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: certificado da CA: %w", ErrCouldNotSignKey, err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if other := c.store(ctx, c.caName(), ca, stored); other != nil && c.validCA(other, signer.Public(), now) {
+		return other, nil
+	}
+	return ca, nil
+}
+
+func (c *CertificateIssuer) issue(ctx context.Context, key *KeyHolder, use string, ca *x509.Certificate, now time.Time) (*x509.Certificate, error) {
+	pub, err := x509.ParsePKIXPublicKey(key.PubKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := now.AddDate(0, 0, c.cfg.ValidityDays)
+	if !key.ExpiresAt.IsZero() && key.ExpiresAt.Before(notAfter) {
+		notAfter = key.ExpiresAt
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      c.subject(key.Kid()),
+		NotBefore:    now.Add(-certBackdate),
+		NotAfter:     notAfter,
+		KeyUsage:     leafKeyUsage(pub, use),
+	}
+
+	parent := tmpl
+	signerKeyID := key.KeyId()
+	if ca != nil {
+		parent = ca
+		signerKeyID = c.cfg.CAKeyID
+	}
+	signer, err := newKMSSigner(ctx, c.client, signerKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: certificado de %s: %w", ErrCouldNotSignKey, key.Kid(), err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+func (c *CertificateIssuer) subject(cn string) pkix.Name {
+	name := pkix.Name{CommonName: cn}
+	if c.cfg.Organization != "" {
+		name.Organization = []string{c.cfg.Organization}
+	}
+	return name
+}
+
+func leafKeyUsage(pub crypto.PublicKey, use string) x509.KeyUsage {
+	if use == "sig" {
+		return x509.KeyUsageDigitalSignature
+	}
+	if _, ok := pub.(*ecdsa.PublicKey); ok {
+		return x509.KeyUsageKeyAgreement
+	}
+	return x509.KeyUsageKeyEncipherment
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// x5t#S256: SHA-256 do certificado DER em base64url
+func certificateThumbprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// crypto.Signer que delega a assinatura ao KMS, usado por x509.CreateCertificate
+type kmsSigner struct {
+	ctx    context.Context
+	client jwtkms.KMSClient
+	keyID  string
+	pub    crypto.PublicKey
+}
+
+func newKMSSigner(ctx context.Context, client jwtkms.KMSClient, keyID string) (*kmsSigner, error) {
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	return &kmsSigner{ctx: ctx, client: client, keyID: keyID, pub: pub}, nil
+}
+
+func (s *kmsSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	alg, err := kmsSigningAlgorithm(s.pub, opts)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.client.Sign(s.ctx, &kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: alg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
+
+func kmsSigningAlgorithm(pub crypto.PublicKey, opts crypto.SignerOpts) (types.SigningAlgorithmSpec, error) {
+	hash := opts.HashFunc()
+	_, pss := opts.(*rsa.PSSOptions)
+
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return types.SigningAlgorithmSpecEcdsaSha256, nil
+		case crypto.SHA384:
+			return types.SigningAlgorithmSpecEcdsaSha384, nil
+		case crypto.SHA512:
+			return types.SigningAlgorithmSpecEcdsaSha512, nil
+		}
+	case *rsa.PublicKey:
+		switch {
+		case pss && hash == crypto.SHA256:
+			return types.SigningAlgorithmSpecRsassaPssSha256, nil
+		case pss && hash == crypto.SHA384:
+			return types.SigningAlgorithmSpecRsassaPssSha384, nil
+		case pss && hash == crypto.SHA512:
+			return types.SigningAlgorithmSpecRsassaPssSha512, nil
+		case hash == crypto.SHA256:
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, nil
+		case hash == crypto.SHA384:
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha384, nil
+		case hash == crypto.SHA512:
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha512, nil
+		}
+	}
+	return "", fmt.Errorf("%w: combinação de chave e hash %v", ErrConfiguredKeyNotSupported, hash)
+}
@@ -0,0 +1,274 @@
+package keymanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func softHolder(t *testing.T, client *softkms.Client, keyID string) *KeyHolder {
+	t.Helper()
+	pub, err := client.GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		t.Fatalf("GetPublicKey falhou: %v", err)
+	}
+	return NewKeyHolder(pub, jwtkms.NewKMSConfig(client, keyID, false), KeyEntry{KeyID: keyID})
+}
+
+// Emite no carregamento e devolve a cadeia publicada para a chave
+func prepareChain(t *testing.T, issuer *CertificateIssuer, holder *KeyHolder, use string) [][]byte {
+	t.Helper()
+	if err := issuer.Prepare(context.Background(), []*JWKSEntry{NewJWKSEntry(holder, use)}); err != nil {
+		t.Fatalf("erro ao emitir certificado: %v", err)
+	}
+	return issuer.Chain(holder, use)
+}
+
+func TestCertificateIssuer_Chain(t *testing.T) {
+	client := softkms.New(
+		softkms.WithKeySpec("alias/ca", types.KeySpecEccNistP384),
+		softkms.WithKeySpec("alias/rsa-signer", types.KeySpecRsa2048),
+		softkms.WithKeySpec("alias/jose", types.KeySpecRsa2048),
+	)
+
+	tests := []struct {
+		name      string
+		caKeyID   string
+		keyID     string
+		use       string
+		wantLen   int
+		wantUsage x509.KeyUsage
+	}{
+		{"Assinatura assinada pela CA", "alias/ca", "alias/ec-signer", "sig", 2, x509.KeyUsageDigitalSignature},
+		{"Assinatura RSA autoassinada", "", "alias/rsa-signer", "sig", 1, x509.KeyUsageDigitalSignature},
+		{"Cifragem assinada pela CA", "alias/ca", "alias/jose", "enc", 2, x509.KeyUsageKeyEncipherment},
+		{"Cifragem sem CA não tem certificado", "", "alias/jose", "enc", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := NewCertificateIssuer(client, CertificateConfig{CAKeyID: tt.caKeyID, Organization: "CA Interna"}, ReealClock())
+			holder := softHolder(t, client, tt.keyID)
+
+			chain := prepareChain(t, issuer, holder, tt.use)
+			if len(chain) != tt.wantLen {
+				t.Fatalf("esperado %d certificados, obtido %d", tt.wantLen, len(chain))
+			}
+			if tt.wantLen == 0 {
+				return
+			}
+
+			leaf, err := x509.ParseCertificate(chain[0])
+			if err != nil {
+				t.Fatalf("certificado inválido: %v", err)
+			}
+			if leaf.KeyUsage != tt.wantUsage {
+				t.Errorf("KeyUsage esperado %v, obtido %v", tt.wantUsage, leaf.KeyUsage)
+			}
+			pubDER, _ := x509.MarshalPKIXPublicKey(leaf.PublicKey)
+			if string(pubDER) != string(holder.PubKey.PublicKey) {
+				t.Error("certificado não contém a chave pública do KMS")
+			}
+
+			if len(chain) == 1 {
+				if err := leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+					t.Errorf("certificado autoassinado não confere: %v", err)
+				}
+				return
+			}
+			ca, err := x509.ParseCertificate(chain[1])
+			if err != nil {
+				t.Fatalf("certificado da CA inválido: %v", err)
+			}
+			if !ca.IsCA {
+				t.Error("último certificado da cadeia deveria ser CA")
+			}
+			if err := leaf.CheckSignatureFrom(ca); err != nil {
+				t.Errorf("assinatura do certificado não confere: %v", err)
+			}
+		})
+	}
+}
+
+func TestCertificateIssuer_RenovaAntesDeExpirar(t *testing.T) {
+	client := softkms.New()
+	clock := MockClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	issuer := NewCertificateIssuer(client, CertificateConfig{ValidityDays: 30, RenewBeforeDays: 5}, clock)
+	holder := softHolder(t, client, "alias/signer")
+
+	first := prepareChain(t, issuer, holder, "sig")
+
+	clock.Add(20 * 24 * time.Hour)
+	if issuer.RenewalDue(clock.Now()) {
+		t.Error("certificado ainda válido não deveria pedir renovação")
+	}
+	cached := prepareChain(t, issuer, holder, "sig")
+	if string(cached[0]) != string(first[0]) {
+		t.Error("certificado ainda válido não deveria ser reemitido")
+	}
+
+	clock.Add(6 * 24 * time.Hour)
+	if !issuer.RenewalDue(clock.Now()) {
+		t.Error("certificado dentro da janela de renovação deveria pedir renovação")
+	}
+	renewed := prepareChain(t, issuer, holder, "sig")
+	if issuer.RenewalDue(clock.Now()) {
+		t.Error("certificado renovado não deveria pedir nova renovação")
+	}
+	if string(renewed[0]) == string(first[0]) {
+		t.Error("certificado dentro da janela de renovação deveria ser reemitido")
+	}
+}
+
+func TestCertificateIssuer_Cache(t *testing.T) {
+	ctx := context.Background()
+	client := softkms.New(softkms.WithKeySpec("alias/ca", types.KeySpecEccNistP384))
+	holder := softHolder(t, client, "alias/signer")
+	other := softHolder(t, client, "alias/outra")
+
+	for _, caKeyID := range []string{"", "alias/ca"} {
+		t.Run("ca="+caKeyID, func(t *testing.T) {
+			cfg := CertificateConfig{CAKeyID: caKeyID, ValidityDays: 30, RenewBeforeDays: 5}
+			clock := MockClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			cache := NewFileCertificateCache(t.TempDir())
+
+			first := prepareChain(t, NewCertificateIssuer(client, cfg, clock).WithCache(cache), holder, "sig")
+
+			// Novo emissor (cold start ou recarga) reaproveita a cadeia guardada
+			clock.Add(10 * 24 * time.Hour)
+			issuer := NewCertificateIssuer(client, cfg, clock).WithCache(cache)
+			again := prepareChain(t, issuer, holder, "sig")
+			if len(again) != len(first) || certificateThumbprint(again[0]) != certificateThumbprint(first[0]) {
+				t.Fatal("certificado guardado deveria ser reaproveitado")
+			}
+			if len(first) == 2 && string(again[1]) != string(first[1]) {
+				t.Error("certificado da CA guardado deveria ser reaproveitado")
+			}
+
+			// Certificado de outra chave sob o nome desta é descartado
+			forged := prepareChain(t, NewCertificateIssuer(client, cfg, clock), other, "sig")
+			if err := cache.Put(ctx, issuer.leafName(holder, "sig"), forged[0], again[0]); err != nil {
+				t.Fatalf("erro ao adulterar o cache: %v", err)
+			}
+			replaced := prepareChain(t, NewCertificateIssuer(client, cfg, clock).WithCache(cache), holder, "sig")
+			leaf, _ := x509.ParseCertificate(replaced[0])
+			if string(leaf.RawSubjectPublicKeyInfo) != string(holder.PubKey.PublicKey) {
+				t.Error("certificado adulterado no cache não deveria ser publicado")
+			}
+
+			// Perto de expirar, o emissor seguinte renova e guarda o novo
+			clock.Add(26 * 24 * time.Hour)
+			renewed := prepareChain(t, NewCertificateIssuer(client, cfg, clock).WithCache(cache), holder, "sig")
+			if string(renewed[0]) == string(replaced[0]) {
+				t.Error("certificado dentro da janela de renovação deveria ser reemitido")
+			}
+			latest := prepareChain(t, NewCertificateIssuer(client, cfg, clock).WithCache(cache), holder, "sig")
+			if string(latest[0]) != string(renewed[0]) {
+				t.Error("certificado renovado deveria ser guardado no cache")
+			}
+		})
+	}
+}
+
+func TestKeyLoader_CertificadosEntreRecargas(t *testing.T) {
+	ctx := context.Background()
+	conf := &Config{
+		Issuer:       "ca.internal",
+		Certificates: &CertificateConfig{},
+		Keys:         map[string][]KeyEntry{"jwt": {{KeyID: "alias/jwt", UseFrom: time.Now().Add(-time.Hour)}}},
+	}
+	loader := NewKeyLoader(softkms.New(), DefaultRetryPolicy, ReealClock()).WithCertificateCache(NewMemoryCertificateCache())
+
+	var thumbprints []string
+	for i := 0; i < 2; i++ {
+		set, err := loader.LoadKeySet(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro no carregamento: %v", err)
+		}
+		chain := set.Certificates().Chain(set.Group("jwt")[0], "sig")
+		if len(chain) == 0 {
+			t.Fatal("certificado deveria ser emitido no carregamento")
+		}
+		thumbprints = append(thumbprints, certificateThumbprint(chain[0]))
+	}
+	if thumbprints[0] != thumbprints[1] {
+		t.Error("x5t#S256 não deveria mudar entre recargas")
+	}
+}
+
+func TestBuildJWKSet_X5tS256(t *testing.T) {
+	client := softkms.New()
+	issuer := NewCertificateIssuer(client, CertificateConfig{CAKeyID: "alias/ca"}, ReealClock())
+	entries := []*JWKSEntry{NewJWKSEntry(softHolder(t, client, "alias/signer"), "sig")}
+
+	if err := issuer.Prepare(context.Background(), entries); err != nil {
+		t.Fatalf("erro ao emitir certificados: %v", err)
+	}
+	issuer.Attach(entries)
+	set, err := BuildJWKSet(entries)
+	if err != nil {
+		t.Fatalf("erro ao montar JWKS: %v", err)
+	}
+
+	jwk := set.Keys[0]
+	if len(jwk.X5c) != 2 {
+		t.Fatalf("esperado x5c com folha e CA, obtido %d certificados", len(jwk.X5c))
+	}
+	der, err := base64.StdEncoding.DecodeString(jwk.X5c[0])
+	if err != nil {
+		t.Fatalf("x5c deveria ser base64 padrão: %v", err)
+	}
+	if jwk.X5tS256 != certificateThumbprint(der) {
+		t.Errorf("x5t#S256 %s não corresponde ao certificado da folha", jwk.X5tS256)
+	}
+}
+
+// Depois do carregamento, publicar o JWKS não chama o KMS; a recarga só
+// reemite quando algum certificado entra na janela de renovação
+func TestKeyLoader_CertificadosNoCarregamento(t *testing.T) {
+	ctx := context.Background()
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	conf := &Config{
+		Issuer:       "ca.internal",
+		Certificates: &CertificateConfig{CAKeyID: "alias/ca", ValidityDays: 30, RenewBeforeDays: 5},
+		Keys:         map[string][]KeyEntry{"jwt": {{KeyID: "alias/jwt", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}}},
+	}
+	client := newCountingClient(softkms.New())
+	clock := MockClock(now)
+	loader := NewKeyLoader(client, DefaultRetryPolicy, clock).WithCertificateCache(NewMemoryCertificateCache())
+
+	set, err := loader.LoadKeySet(ctx, conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	signs := client.calls["Sign"]
+	if signs == 0 {
+		t.Fatal("certificados deveriam ser emitidos no carregamento")
+	}
+
+	entries := PublishedEntries(set.Group("jwt"), set.Group("jose"), now)
+	set.Certificates().Attach(entries)
+	if len(entries[0].chain) != 2 {
+		t.Fatalf("esperado x5c com folha e CA, obtido %d certificados", len(entries[0].chain))
+	}
+	if client.calls["Sign"] != signs {
+		t.Error("anexar certificados não deveria chamar o KMS")
+	}
+
+	if set.CertificatesDue(clock.Now()) {
+		t.Error("certificados recém-emitidos não deveriam pedir renovação")
+	}
+	clock.Add(26 * 24 * time.Hour)
+	if !set.CertificatesDue(clock.Now()) {
+		t.Error("certificado na janela de renovação deveria pedir recarga")
+	}
+}
@@ -0,0 +1,262 @@
+package keymanager
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrPayloadTooLarge    = errors.New("claims payload too large")
+	ErrMalformedClaims    = errors.New("claims must be a JSON object")
+	ErrReservedClaim      = errors.New("reserved claim cannot be set by the caller")
+	ErrAudienceNotAllowed = errors.New("audience not allowed")
+	ErrLifetimeExceeded   = errors.New("token lifetime exceeds policy")
+	ErrInvalidTokenPolicy = errors.New("invalid token policy")
+)
+
+// Claims preenchidas pelo servidor
+var ReservedClaims = []string{"iss", "iat", "nbf", "exp", "jti"}
+
+// Reservadas que token_policy.allow_overrides pode liberar; iss e iat são
+// sempre do servidor
+var overridableClaims = []string{"nbf", "exp", "jti"}
+
+const (
+	defaultTokenLifetime   = 15 * time.Minute
+	defaultMaxLifetime     = time.Hour
+	defaultMaxPayloadBytes = 8 << 10
+)
+
+// Política das claims recebidas em /sign-jwt
+type TokenPolicy struct {
+	DefaultLifetime time.Duration `yaml:"default_lifetime"`  // exp quando o chamador não define; padrão 15m
+	MaxLifetime     time.Duration `yaml:"max_lifetime"`      // limite de exp - iat; padrão 1h
+	Audiences       []string      `yaml:"audiences"`         // aud permitidos; vazio aceita qualquer um
+	AllowOverrides  []string      `yaml:"allow_overrides"`   // reservadas que o chamador pode definir: nbf, exp, jti
+	MaxPayloadBytes int           `yaml:"max_payload_bytes"` // padrão 8 KiB
+}
+
+func (p TokenPolicy) withDefaults() TokenPolicy {
+	if p.DefaultLifetime <= 0 {
+		p.DefaultLifetime = defaultTokenLifetime
+	}
+	if p.MaxLifetime <= 0 {
+		p.MaxLifetime = defaultMaxLifetime
+	}
+	if p.MaxPayloadBytes <= 0 {
+		p.MaxPayloadBytes = defaultMaxPayloadBytes
+	}
+	return p
+}
+
+func (p TokenPolicy) validate() error {
+	p = p.withDefaults()
+	if p.DefaultLifetime > p.MaxLifetime {
+		return fmt.Errorf("%w: default_lifetime %s maior que max_lifetime %s", ErrInvalidTokenPolicy, p.DefaultLifetime, p.MaxLifetime)
+	}
+	for _, claim := range p.AllowOverrides {
+		if !slices.Contains(overridableClaims, claim) {
+			return fmt.Errorf("%w: allow_overrides não aceita %q", ErrInvalidTokenPolicy, claim)
+		}
+	}
+	return nil
+}
+
+// Valida a token_policy do nível raiz e de cada issuer
+func (c *Config) validateTokenPolicies() error {
+	var errs []error
+	if err := c.TokenPolicy.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range c.IssuerNames() {
+		if err := c.Issuers[name].TokenPolicy.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Violação da política, com o código e a claim devolvidos ao chamador
+type ClaimError struct {
+	Code    string // ver claimErrorCodes
+	Claim   string
+	Message string
+	Err     error
+}
+
+func (e *ClaimError) Error() string {
+	if e.Claim == "" {
+		return fmt.Sprintf("%v: %s", e.Err, e.Message)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Claim, e.Err, e.Message)
+}
+
+func (e *ClaimError) Unwrap() error { return e.Err }
+
+var claimErrorCodes = map[error]string{
+	ErrPayloadTooLarge:    "payload_too_large",
+	ErrMalformedClaims:    "invalid_claims",
+	ErrReservedClaim:      "reserved_claim",
+	ErrAudienceNotAllowed: "audience_not_allowed",
+	ErrLifetimeExceeded:   "lifetime_exceeded",
+	ErrUnknownProfile:     "unknown_profile",
+	ErrUnknownClaim:       "unknown_claim",
+	ErrMissingClaim:       "missing_claim",
+	ErrClaimType:          "invalid_claim_type",
+}
+
+func claimError(err error, claim, format string, args ...interface{}) *ClaimError {
+	return &ClaimError{Code: claimErrorCodes[err], Claim: claim, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Lê o objeto JSON de claims do corpo; corpo vazio equivale a {}
+func (p TokenPolicy) ParseClaims(payload []byte) (jwt.MapClaims, error) {
+	p = p.withDefaults()
+	if len(payload) > p.MaxPayloadBytes {
+		return nil, claimError(ErrPayloadTooLarge, "", "%d bytes, máximo %d", len(payload), p.MaxPayloadBytes)
+	}
+	claims := jwt.MapClaims{}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return claims, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil || claims == nil || dec.More() {
+		return nil, claimError(ErrMalformedClaims, "", "corpo deve ser um objeto JSON")
+	}
+	return claims, nil
+}
+
+// Confere as claims do chamador e preenche iss, iat, nbf, exp e jti. exp é
+// limitado a max_lifetime a partir de now; sem override, vale now +
+// default_lifetime.
+func (p TokenPolicy) Apply(issuer string, claims jwt.MapClaims, now time.Time) (jwt.MapClaims, error) {
+	p = p.withDefaults()
+	for _, claim := range ReservedClaims {
+		if _, set := claims[claim]; set && !slices.Contains(p.AllowOverrides, claim) {
+			return nil, claimError(ErrReservedClaim, claim, "definida pelo servidor")
+		}
+	}
+	if err := p.checkAudience(claims["aud"]); err != nil {
+		return nil, err
+	}
+
+	now = now.Truncate(time.Second)
+	nbf, exp := now, now.Add(p.DefaultLifetime)
+	var err error
+	if value, ok := claims["nbf"]; ok {
+		if nbf, err = numericDate("nbf", value); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := claims["exp"]; ok {
+		if exp, err = numericDate("exp", value); err != nil {
+			return nil, err
+		}
+	}
+	if !exp.After(now) || !exp.After(nbf) {
+		return nil, claimError(ErrMalformedClaims, "exp", "deve ser posterior a iat e nbf")
+	}
+	if lifetime := exp.Sub(now); lifetime > p.MaxLifetime {
+		return nil, claimError(ErrLifetimeExceeded, "exp", "%s, máximo %s", lifetime, p.MaxLifetime)
+	}
+	if value, ok := claims["jti"]; ok {
+		if id, isString := value.(string); !isString || id == "" {
+			return nil, claimError(ErrMalformedClaims, "jti", "deve ser uma string não vazia")
+		}
+	} else {
+		claims["jti"] = newJTI()
+	}
+
+	if issuer != "" {
+		claims["iss"] = IssuerURL(issuer)
+	}
+	claims["iat"], claims["nbf"], claims["exp"] = now.Unix(), nbf.Unix(), exp.Unix()
+	return claims, nil
+}
+
+// ParseClaims seguido de Apply
+func (p TokenPolicy) BuildClaims(issuer string, payload []byte, now time.Time) (jwt.MapClaims, error) {
+	claims, err := p.ParseClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+	return p.Apply(issuer, claims, now)
+}
+
+// aud pode ser string ou lista de strings (RFC 7519, seção 4.1.3)
+func (p TokenPolicy) checkAudience(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	audiences, ok := claimStrings(value)
+	if !ok || len(audiences) == 0 {
+		return claimError(ErrMalformedClaims, "aud", "deve ser uma string ou lista de strings")
+	}
+	if len(p.Audiences) == 0 {
+		return nil
+	}
+	for _, aud := range audiences {
+		if !slices.Contains(p.Audiences, aud) {
+			return claimError(ErrAudienceNotAllowed, "aud", "%q", aud)
+		}
+	}
+	return nil
+}
+
+func claimStrings(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, v != ""
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok || s == "" {
+				return nil, false
+			}
+			values = append(values, s)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// NumericDate em segundos (RFC 7519); frações são descartadas
+func numericDate(claim string, value interface{}) (time.Time, error) {
+	var seconds float64
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, claimError(ErrMalformedClaims, claim, "deve ser um NumericDate")
+		}
+		seconds = f
+	case float64:
+		seconds = v
+	case int64:
+		seconds = float64(v)
+	default:
+		return time.Time{}, claimError(ErrMalformedClaims, claim, "deve ser um NumericDate")
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds < 0 {
+		return time.Time{}, claimError(ErrMalformedClaims, claim, "deve ser um NumericDate")
+	}
+	return time.Unix(int64(seconds), 0), nil
+}
+
+// 128 bits aleatórios em base64url
+func newJTI() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
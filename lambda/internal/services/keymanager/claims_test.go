@@ -0,0 +1,96 @@
+package keymanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenPolicy_BuildClaims(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	base := TokenPolicy{Audiences: []string{"api.interna", "faturamento"}}
+
+	tests := []struct {
+		name     string
+		policy   TokenPolicy
+		payload  string
+		wantErr  error
+		wantCode string
+		wantExp  time.Duration
+	}{
+		{"corpo vazio", base, "", nil, "", 15 * time.Minute},
+		{"claims do chamador", base, `{"sub":"svc-a","aud":["api.interna"],"scope":"leitura"}`, nil, "", 15 * time.Minute},
+		{"default_lifetime configurado", TokenPolicy{DefaultLifetime: 5 * time.Minute}, `{"sub":"svc-a"}`, nil, "", 5 * time.Minute},
+		{"exp liberado dentro do limite", TokenPolicy{AllowOverrides: []string{"exp"}}, `{"exp":1740834000}`, nil, "", time.Hour},
+		{"exp além de max_lifetime", TokenPolicy{AllowOverrides: []string{"exp"}}, `{"exp":1740837600}`, ErrLifetimeExceeded, "lifetime_exceeded", 0},
+		{"exp no passado", TokenPolicy{AllowOverrides: []string{"exp"}}, `{"exp":1740830000}`, ErrMalformedClaims, "invalid_claims", 0},
+		{"exp sem liberação", base, `{"exp":1740831000}`, ErrReservedClaim, "reserved_claim", 0},
+		{"iss nunca é do chamador", base, `{"iss":"https://outro"}`, ErrReservedClaim, "reserved_claim", 0},
+		{"audiência fora da lista", base, `{"aud":"outra-api"}`, ErrAudienceNotAllowed, "audience_not_allowed", 0},
+		{"aud com tipo inválido", base, `{"aud":42}`, ErrMalformedClaims, "invalid_claims", 0},
+		{"corpo não é objeto", base, `["sub"]`, ErrMalformedClaims, "invalid_claims", 0},
+		{"JSON com lixo no fim", base, `{"sub":"a"} {}`, ErrMalformedClaims, "invalid_claims", 0},
+		{"corpo grande demais", TokenPolicy{MaxPayloadBytes: 16}, `{"sub":"um-sujeito-longo"}`, ErrPayloadTooLarge, "payload_too_large", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.policy.BuildClaims("ca.internal", []byte(tt.payload), now)
+			if tt.wantErr != nil {
+				var claimErr *ClaimError
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &claimErr) || claimErr.Code != tt.wantCode {
+					t.Fatalf("esperado %v (%s), obtido %v", tt.wantErr, tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if claims["iss"] != "https://ca.internal" || claims["iat"] != now.Unix() || claims["nbf"] != now.Unix() {
+				t.Errorf("claims do servidor inesperadas: %v", claims)
+			}
+			if claims["exp"] != now.Add(tt.wantExp).Unix() {
+				t.Errorf("exp = %v, esperado %d", claims["exp"], now.Add(tt.wantExp).Unix())
+			}
+			if jti, _ := claims["jti"].(string); len(jti) < 16 {
+				t.Errorf("jti ausente ou curto: %v", claims["jti"])
+			}
+		})
+	}
+}
+
+func TestLoadConfig_TokenPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"política válida", `
+token_policy:
+  default_lifetime: 10m
+  max_lifetime: 2h
+  audiences: [api.interna]
+  allow_overrides: [exp, jti]`, false},
+		{"padrão maior que o máximo", `
+token_policy:
+  default_lifetime: 2h`, true},
+		{"iss não pode ser liberado", `
+issuers:
+  produto-a:
+    token_policy:
+      allow_overrides: [iss]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.TokenPolicy.MaxLifetime != 2*time.Hour {
+				t.Errorf("max_lifetime = %s, esperado 2h", cfg.TokenPolicy.MaxLifetime)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTokenPolicy) {
+				t.Errorf("esperado ErrInvalidTokenPolicy, obtido %v", err)
+			}
+		})
+	}
+}
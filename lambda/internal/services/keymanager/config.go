@@ -0,0 +1,99 @@
+package keymanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Carrega a configuração YAML
+func LoadConfig(path string) (*Config, error) {
+	return (&FileSource{Path: path}).Load(context.Background())
+}
+
+// Interpreta e valida o conteúdo da configuração (YAML ou JSON)
+func ParseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	err := yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validateIssuers(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateKeys(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateTokenPolicies(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateProfiles(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateAuthorization(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateVerifyPolicies(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateIntrospection(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Nomes dos issuers de "issuers" em ordem estável
+func (c *Config) IssuerNames() []string {
+	names := make([]string, 0, len(c.Issuers))
+	for name := range c.Issuers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Prefixo de caminho do issuer nomeado: path_prefix ou "/<nome>"
+func (c *Config) RoutePrefix(name string) string {
+	prefix := c.Issuers[name].PathPrefix
+	if prefix == "" {
+		prefix = name
+	}
+	return "/" + strings.Trim(prefix, "/")
+}
+
+// Rotas duplicadas ou configurações que só valem no nível raiz são recusadas
+func (c *Config) validateIssuers() error {
+	if len(c.Hosts) > 0 || c.PathPrefix != "" {
+		return fmt.Errorf("hosts e path_prefix só valem dentro de issuers")
+	}
+	prefixes := map[string]string{}
+	hosts := map[string]string{}
+	for _, name := range c.IssuerNames() {
+		issuer := c.Issuers[name]
+		if issuer == nil {
+			return fmt.Errorf("issuer %q sem configuração", name)
+		}
+		if len(issuer.Issuers) > 0 || issuer.KMSBackend != "" || issuer.PubKeyCache != nil || issuer.CertStore != "" {
+			return fmt.Errorf("issuer %q: issuers, kms_backend, public_key_cache e certificate_store só valem no nível raiz", name)
+		}
+		prefix := c.RoutePrefix(name)
+		if prefix == "/" {
+			return fmt.Errorf("issuer %q: path_prefix não pode ser a raiz", name)
+		}
+		if other, ok := prefixes[prefix]; ok {
+			return fmt.Errorf("issuers %q e %q usam o mesmo path_prefix %s", other, name, prefix)
+		}
+		prefixes[prefix] = name
+		for _, host := range issuer.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				return fmt.Errorf("issuers %q e %q usam o mesmo host %s", other, name, host)
+			}
+			hosts[host] = name
+		}
+	}
+	return nil
+}
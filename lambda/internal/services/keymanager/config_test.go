@@ -0,0 +1,96 @@
+package keymanager
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadConfigCases(t *testing.T) {
+	t.Run("Arquivo inexistente", func(t *testing.T) {
+		_, err := LoadConfig("naoexiste.yaml")
+		if err == nil {
+			t.Error("esperado erro de arquivo ausente")
+		}
+	})
+	t.Run("YAML inválido", func(t *testing.T) {
+		temp := t.TempDir() + "/bad.yaml"
+		os.WriteFile(temp, []byte("{invalid:"), 0644)
+		_, err := LoadConfig(temp)
+		if err == nil {
+			t.Error("esperado erro de YAML inválido")
+		}
+	})
+	t.Run("YAML válido", func(t *testing.T) {
+		temp := t.TempDir() + "/ok.yaml"
+		yaml := `
+keys:
+  jwt:
+    - key_id: "alias/test"
+      use_from: "2024-01-01T00:00:00Z"
+expires_policy:
+  overlap_days: 180`
+		os.WriteFile(temp, []byte(yaml), 0644)
+		cfg, err := LoadConfig(temp)
+		if err != nil || len(cfg.Keys["jwt"]) != 1 {
+			t.Errorf("erro ao carregar YAML válido: %v", err)
+		}
+	})
+}
+
+func TestLoadConfig_Issuers(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"prefixo padrão é o nome", `
+issuers:
+  produto-a:
+    issuer: a.ca.internal
+  produto-b:
+    issuer: b.ca.internal
+    path_prefix: /b/prd
+    hosts: [b.ca.internal]`, false},
+		{"prefixo repetido", `
+issuers:
+  produto-a:
+    path_prefix: /compartilhado
+  produto-b:
+    path_prefix: /compartilhado/`, true},
+		{"host repetido", `
+issuers:
+  produto-a:
+    hosts: [ca.internal]
+  produto-b:
+    hosts: [CA.internal]`, true},
+		{"backend dentro de issuer", `
+issuers:
+  produto-a:
+    kms_backend: software`, true},
+		{"hosts no nível raiz", `
+hosts: [ca.internal]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/kms-keys.yaml"
+			os.WriteFile(path, []byte(tt.yaml), 0644)
+			cfg, err := LoadConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("esperado erro de validação dos issuers")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if got := cfg.RoutePrefix("produto-a"); got != "/produto-a" {
+				t.Errorf("esperado prefixo /produto-a, obtido %s", got)
+			}
+			if got := cfg.RoutePrefix("produto-b"); got != "/b/prd" {
+				t.Errorf("esperado prefixo /b/prd, obtido %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var (
+	ErrEmptyConfig    = errors.New("configuration source is empty")
+	ErrConfigConflict = errors.New("configuration changed since it was read")
+	ErrReadOnlyConfig = errors.New("configuration source is read-only")
+)
+
+// Origem da configuração. Load preenche Config.Version com um identificador do
+// conteúdo lido (versão do parâmetro, VersionId do segredo ou do objeto, ETag
+// ou hash do conteúdo), para que recargas saibam se algo mudou.
+type ConfigSource interface {
+	Load(ctx context.Context) (*Config, error)
+	String() string
+}
+
+// Origem que aceita gravação, usada pela rotação automática de chaves
+type ConfigWriter interface {
+	ConfigSource
+	// Conteúdo bruto e sua versão, no mesmo formato de Config.Version
+	Read(ctx context.Context) ([]byte, string, error)
+	// Grava data se a origem ainda estiver na versão lida; senão ErrConfigConflict
+	Write(ctx context.Context, data []byte, version string) error
+}
+
+// Subconjuntos dos clientes da AWS usados pelas origens
+type SSMClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Clientes disponíveis para NewConfigSource; só o do esquema usado é exigido
+type ConfigClients struct {
+	SSM            SSMClient
+	SecretsManager SecretsManagerClient
+	S3             S3Client
+}
+
+// Esquema da URI de configuração; caminhos sem esquema são arquivos
+func ConfigScheme(uri string) string {
+	if i := strings.Index(uri, "://"); i > 0 {
+		return uri[:i]
+	}
+	return "file"
+}
+
+// Escolhe a origem pelo esquema da URI:
+//
+//	config/kms-keys.yaml ou file://config/kms-keys.yaml
+//	env://KMS_CONFIG_JSON
+//	ssm:///lambda-ca/kms-keys
+//	secretsmanager://lambda-ca/kms-keys
+//	s3://bucket/caminho/kms-keys.yaml
+func NewConfigSource(uri string, clients ConfigClients) (ConfigSource, error) {
+	scheme := ConfigScheme(uri)
+	target := strings.TrimPrefix(uri, scheme+"://")
+	if target == "" {
+		return nil, fmt.Errorf("URI de configuração sem destino: %s", uri)
+	}
+
+	switch scheme {
+	case "file":
+		return &FileSource{Path: target}, nil
+	case "env":
+		return &EnvSource{Name: target}, nil
+	case "ssm":
+		if clients.SSM == nil {
+			return nil, fmt.Errorf("cliente SSM não configurado para %s", uri)
+		}
+		return &SSMSource{Client: clients.SSM, Name: target}, nil
+	case "secretsmanager":
+		if clients.SecretsManager == nil {
+			return nil, fmt.Errorf("cliente Secrets Manager não configurado para %s", uri)
+		}
+		return &SecretsManagerSource{Client: clients.SecretsManager, SecretID: target}, nil
+	case "s3":
+		bucket, key, ok := strings.Cut(target, "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, fmt.Errorf("URI do S3 deve ser s3://bucket/chave: %s", uri)
+		}
+		if clients.S3 == nil {
+			return nil, fmt.Errorf("cliente S3 não configurado para %s", uri)
+		}
+		return &S3Source{Client: clients.S3, Bucket: bucket, Key: key}, nil
+	default:
+		return nil, fmt.Errorf("esquema de configuração desconhecido: %s", scheme)
+	}
+}
+
+// NewConfigSource com os clientes da AWS criados pela configuração padrão do
+// SDK, só para os esquemas que precisam deles
+func OpenConfigSource(ctx context.Context, uri string) (ConfigSource, error) {
+	var clients ConfigClients
+	switch ConfigScheme(uri) {
+	case "ssm", "secretsmanager", "s3":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clients = ConfigClients{
+			SSM:            ssm.NewFromConfig(cfg),
+			SecretsManager: secretsmanager.NewFromConfig(cfg),
+			S3:             s3.NewFromConfig(cfg),
+		}
+	}
+	return NewConfigSource(uri, clients)
+}
+
+// YAML ou JSON (o JSON é um subconjunto do YAML) com a versão informada
+func parseVersioned(data []byte, version string) (*Config, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, ErrEmptyConfig
+	}
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Version = version
+	return cfg, nil
+}
+
+// Versão de origens sem versionamento próprio
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Origem que entrega o conteúdo bruto e a versão (ver ConfigWriter.Read)
+type configReader interface {
+	Read(ctx context.Context) ([]byte, string, error)
+}
+
+// Carrega a configuração a partir do conteúdo bruto e da versão lidos
+func loadWritable(ctx context.Context, source configReader) (*Config, error) {
+	data, version, err := source.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseVersioned(data, version)
+}
+
+// Confere se a origem ainda está na versão esperada antes de gravar
+func checkVersion(ctx context.Context, source ConfigWriter, version string) error {
+	_, current, err := source.Read(ctx)
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return fmt.Errorf("%s: %w (%s -> %s)", source, ErrConfigConflict, version, current)
+	}
+	return nil
+}
+
+type FileSource struct {
+	Path string
+}
+
+var _ ConfigWriter = (*FileSource)(nil)
+
+func (s *FileSource) String() string { return "file://" + s.Path }
+
+func (s *FileSource) Load(ctx context.Context) (*Config, error) {
+	return loadWritable(ctx, s)
+}
+
+func (s *FileSource) Read(ctx context.Context) ([]byte, string, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentVersion(data), nil
+}
+
+// Grava num arquivo temporário e renomeia, para quem lê nunca ver um YAML pela metade
+func (s *FileSource) Write(ctx context.Context, data []byte, version string) error {
+	if err := checkVersion(ctx, s, version); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(s.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// JSON ou YAML inline numa variável de ambiente; somente leitura
+type EnvSource struct {
+	Name string
+}
+
+func (s *EnvSource) String() string { return "env://" + s.Name }
+
+func (s *EnvSource) Load(ctx context.Context) (*Config, error) {
+	data := []byte(os.Getenv(s.Name))
+	cfg, err := parseVersioned(data, contentVersion(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	return cfg, nil
+}
+
+// Parâmetro do SSM Parameter Store, String ou SecureString. Somente leitura:
+// o Parameter Store não tem gravação condicional, então a rotação automática
+// não teria como detectar uma edição feita entre a leitura e o PutParameter.
+type SSMSource struct {
+	Client SSMClient
+	Name   string
+}
+
+func (s *SSMSource) String() string { return "ssm://" + s.Name }
+
+func (s *SSMSource) Load(ctx context.Context) (*Config, error) {
+	return loadWritable(ctx, s)
+}
+
+func (s *SSMSource) Read(ctx context.Context) ([]byte, string, error) {
+	out, err := s.Client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(s.Name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return nil, "", err
+	}
+	if out.Parameter == nil {
+		return nil, "", fmt.Errorf("%s: %w", s.Name, ErrEmptyConfig)
+	}
+	return []byte(aws.ToString(out.Parameter.Value)), strconv.FormatInt(out.Parameter.Version, 10), nil
+}
+
+type SecretsManagerSource struct {
+	Client   SecretsManagerClient
+	SecretID string
+}
+
+var _ ConfigWriter = (*SecretsManagerSource)(nil)
+
+func (s *SecretsManagerSource) String() string { return "secretsmanager://" + s.SecretID }
+
+func (s *SecretsManagerSource) Load(ctx context.Context) (*Config, error) {
+	return loadWritable(ctx, s)
+}
+
+func (s *SecretsManagerSource) Read(ctx context.Context) ([]byte, string, error) {
+	out, err := s.Client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(s.SecretID)})
+	if err != nil {
+		return nil, "", err
+	}
+	data := out.SecretBinary
+	if out.SecretString != nil {
+		data = []byte(*out.SecretString)
+	}
+	return data, aws.ToString(out.VersionId), nil
+}
+
+// Cria uma nova versão do segredo, que passa a ser a AWSCURRENT
+func (s *SecretsManagerSource) Write(ctx context.Context, data []byte, version string) error {
+	if err := checkVersion(ctx, s, version); err != nil {
+		return err
+	}
+	_, err := s.Client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{SecretId: aws.String(s.SecretID), SecretString: aws.String(string(data))})
+	return err
+}
+
+type S3Source struct {
+	Client S3Client
+	Bucket string
+	Key    string
+}
+
+var _ ConfigWriter = (*S3Source)(nil)
+
+func (s *S3Source) String() string { return "s3://" + s.Bucket + "/" + s.Key }
+
+func (s *S3Source) Load(ctx context.Context) (*Config, error) {
+	return loadWritable(ctx, s)
+}
+
+// Versão: VersionId com versionamento no bucket, senão o ETag
+func (s *S3Source) Read(ctx context.Context) ([]byte, string, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.Key)})
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, s3Version(out.VersionId, out.ETag), nil
+}
+
+// PutObject condicionado ao ETag atual (If-Match), que o S3 recusa se o
+// objeto mudou depois do HeadObject
+func (s *S3Source) Write(ctx context.Context, data []byte, version string) error {
+	head, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.Key)})
+	if err != nil {
+		return err
+	}
+	if current := s3Version(head.VersionId, head.ETag); current != version {
+		return fmt.Errorf("%s: %w (%s -> %s)", s, ErrConfigConflict, version, current)
+	}
+	_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:  aws.String(s.Bucket),
+		Key:     aws.String(s.Key),
+		Body:    bytes.NewReader(data),
+		IfMatch: head.ETag,
+	})
+	return err
+}
+
+func s3Version(versionID, etag *string) string {
+	if version := aws.ToString(versionID); version != "" {
+		return version
+	}
+	return strings.Trim(aws.ToString(etag), `"`)
+}
@@ -0,0 +1,239 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const sourceYAML = `
+issuer: fonte.ca.internal
+keys:
+  jwt:
+    - key_id: "alias/test"
+      use_from: "2024-01-01T00:00:00Z"`
+
+type fakeSSM struct {
+	value   string
+	version int64
+	name    string
+	decrypt bool
+}
+
+func (f *fakeSSM) GetParameter(ctx context.Context, in *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.name, f.decrypt = aws.ToString(in.Name), aws.ToBool(in.WithDecryption)
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(f.value), Version: f.version}}, nil
+}
+
+type fakeSecrets struct {
+	value     string
+	versionID string
+}
+
+func (f *fakeSecrets) GetSecretValue(ctx context.Context, in *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(f.value), VersionId: aws.String(f.versionID)}, nil
+}
+
+func (f *fakeSecrets) PutSecretValue(ctx context.Context, in *secretsmanager.PutSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	f.value = aws.ToString(in.SecretString)
+	f.versionID += "+"
+	return &secretsmanager.PutSecretValueOutput{VersionId: aws.String(f.versionID)}, nil
+}
+
+type fakeS3 struct {
+	value     string
+	versionID string
+	etag      string
+	bucket    string
+	key       string
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.bucket, f.key = aws.ToString(in.Bucket), aws.ToString(in.Key)
+	out := &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(f.value)), ETag: aws.String(f.etag)}
+	if f.versionID != "" {
+		out.VersionId = aws.String(f.versionID)
+	}
+	return out, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	out := &s3.HeadObjectOutput{ETag: aws.String(f.etag)}
+	if f.versionID != "" {
+		out.VersionId = aws.String(f.versionID)
+	}
+	return out, nil
+}
+
+// Simula a gravação condicional: If-Match diferente do ETag atual falha
+func (f *fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if in.IfMatch != nil && aws.ToString(in.IfMatch) != f.etag {
+		return nil, errors.New("PreconditionFailed")
+	}
+	data, _ := io.ReadAll(in.Body)
+	f.value, f.etag = string(data), `"`+contentVersion(data)+`"`
+	return &s3.PutObjectOutput{ETag: aws.String(f.etag)}, nil
+}
+
+func TestNewConfigSource(t *testing.T) {
+	clients := ConfigClients{SSM: &fakeSSM{}, SecretsManager: &fakeSecrets{}, S3: &fakeS3{}}
+	tests := []struct {
+		uri     string
+		clients ConfigClients
+		want    string
+		wantErr bool
+	}{
+		{"config/kms-keys.yaml", clients, "file://config/kms-keys.yaml", false},
+		{"file:///etc/kms-keys.yaml", clients, "file:///etc/kms-keys.yaml", false},
+		{"env://KMS_CONFIG_JSON", clients, "env://KMS_CONFIG_JSON", false},
+		{"ssm:///lambda-ca/kms-keys", clients, "ssm:///lambda-ca/kms-keys", false},
+		{"secretsmanager://lambda-ca/kms-keys", clients, "secretsmanager://lambda-ca/kms-keys", false},
+		{"s3://bucket/ca/kms-keys.yaml", clients, "s3://bucket/ca/kms-keys.yaml", false},
+		{"s3://bucket", clients, "", true},
+		{"ssm:///lambda-ca/kms-keys", ConfigClients{}, "", true},
+		{"env://", clients, "", true},
+		{"http://ca.internal/kms-keys.yaml", clients, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			source, err := NewConfigSource(tt.uri, tt.clients)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if err == nil && source.String() != tt.want {
+				t.Errorf("origem = %s, esperado %s", source, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigSource_Version(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("arquivo muda de versão quando o conteúdo muda", func(t *testing.T) {
+		path := t.TempDir() + "/kms-keys.yaml"
+		os.WriteFile(path, []byte(sourceYAML), 0644)
+		source := &FileSource{Path: path}
+		first, err := source.Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := source.Load(ctx)
+		if first.Version == "" || first.Version != again.Version {
+			t.Errorf("versões = %q e %q, esperado iguais e não vazias", first.Version, again.Version)
+		}
+		os.WriteFile(path, []byte(sourceYAML+"\nexpires_policy:\n  overlap_days: 30"), 0644)
+		changed, _ := source.Load(ctx)
+		if changed.Version == first.Version {
+			t.Error("versão deveria mudar com o conteúdo")
+		}
+	})
+
+	t.Run("variável de ambiente com JSON", func(t *testing.T) {
+		t.Setenv("KMS_CONFIG_TESTE", `{"issuer":"env.ca.internal","keys":{"jwt":[{"key_id":"alias/test","use_from":"2024-01-01T00:00:00Z"}]}}`)
+		cfg, err := (&EnvSource{Name: "KMS_CONFIG_TESTE"}).Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Issuer != "env.ca.internal" || !strings.HasPrefix(cfg.Version, "sha256:") {
+			t.Errorf("issuer = %s, versão = %s", cfg.Issuer, cfg.Version)
+		}
+	})
+
+	t.Run("variável de ambiente vazia", func(t *testing.T) {
+		t.Setenv("KMS_CONFIG_TESTE", "")
+		_, err := (&EnvSource{Name: "KMS_CONFIG_TESTE"}).Load(ctx)
+		if !errors.Is(err, ErrEmptyConfig) {
+			t.Errorf("erro = %v, esperado ErrEmptyConfig", err)
+		}
+	})
+
+	t.Run("SSM usa a versão do parâmetro", func(t *testing.T) {
+		client := &fakeSSM{value: sourceYAML, version: 7}
+		cfg, err := (&SSMSource{Client: client, Name: "/lambda-ca/kms-keys"}).Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Version != "7" || client.name != "/lambda-ca/kms-keys" || !client.decrypt {
+			t.Errorf("versão = %s, parâmetro = %s, decrypt = %v", cfg.Version, client.name, client.decrypt)
+		}
+	})
+
+	t.Run("Secrets Manager usa o VersionId", func(t *testing.T) {
+		cfg, err := (&SecretsManagerSource{Client: &fakeSecrets{value: sourceYAML, versionID: "v-123"}, SecretID: "lambda-ca"}).Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Version != "v-123" || cfg.Issuer != "fonte.ca.internal" {
+			t.Errorf("versão = %s, issuer = %s", cfg.Version, cfg.Issuer)
+		}
+	})
+
+	t.Run("S3 usa o VersionId ou o ETag", func(t *testing.T) {
+		client := &fakeS3{value: sourceYAML, etag: `"abc123"`}
+		source, _ := NewConfigSource("s3://bucket/ca/kms-keys.yaml", ConfigClients{S3: client})
+		cfg, err := source.Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Version != "abc123" || client.bucket != "bucket" || client.key != "ca/kms-keys.yaml" {
+			t.Errorf("versão = %s, objeto = %s/%s", cfg.Version, client.bucket, client.key)
+		}
+		client.versionID = "3HL4kqtJ"
+		cfg, _ = source.Load(ctx)
+		if cfg.Version != "3HL4kqtJ" {
+			t.Errorf("versão = %s, esperado o VersionId", cfg.Version)
+		}
+	})
+}
+
+func TestConfigWriter_Write(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/kms-keys.yaml"
+	os.WriteFile(path, []byte(sourceYAML), 0600)
+
+	sources := map[string]ConfigWriter{
+		"arquivo":         &FileSource{Path: path},
+		"secrets manager": &SecretsManagerSource{Client: &fakeSecrets{value: sourceYAML, versionID: "v1"}, SecretID: "lambda-ca"},
+		"s3":              &S3Source{Client: &fakeS3{value: sourceYAML, etag: `"e1"`}, Bucket: "bucket", Key: "kms-keys.yaml"},
+	}
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			_, version, err := source.Read(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			updated := strings.Replace(sourceYAML, "fonte.ca.internal", "nova.ca.internal", 1)
+			if err := source.Write(ctx, []byte(updated), version); err != nil {
+				t.Fatalf("erro ao gravar: %v", err)
+			}
+			cfg, err := source.Load(ctx)
+			if err != nil || cfg.Issuer != "nova.ca.internal" || cfg.Version == version {
+				t.Fatalf("esperado conteúdo e versão novos, obtido %+v (%v)", cfg, err)
+			}
+			if err := source.Write(ctx, []byte(sourceYAML), version); !errors.Is(err, ErrConfigConflict) {
+				t.Errorf("gravação sobre versão antiga: esperado ErrConfigConflict, obtido %v", err)
+			}
+		})
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("permissões do arquivo alteradas para %v", info.Mode().Perm())
+	}
+	if _, err := NewRotationJob(nil, &EnvSource{Name: "KMS_CONFIG_TESTE"}, ReealClock()); !errors.Is(err, ErrReadOnlyConfig) {
+		t.Errorf("env:// não aceita gravação, obtido %v", err)
+	}
+	ssmSource := &SSMSource{Client: &fakeSSM{value: sourceYAML, version: 1}, Name: "/lambda-ca/kms-keys"}
+	if _, err := NewRotationJob(nil, ssmSource, ReealClock()); !errors.Is(err, ErrReadOnlyConfig) {
+		t.Errorf("ssm:// não tem gravação condicional e não deveria aceitar rotação, obtido %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package keymanager
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Caminhos publicados pelo serviço, relativos ao issuer
+const (
+	JWKSPath       = "/.well-known/jwks.json"
+	SignedJWKSPath = "/jwks-signed"
+	IntrospectPath = "/introspect"
+)
+
+// Metadados de descoberta (OpenID Connect Discovery 1.0 / RFC 8414), só com o
+// que o serviço atende: não há authorization_endpoint nem fluxo de
+// autorização, então response_types_supported e afins não são anunciados
+type DiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	SignedJWKSURI                    string   `json:"signed_jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"` // algs dos JWTs de /sign-jwt
+	IntrospectionEndpoint            string   `json:"introspection_endpoint,omitempty"`      // RFC 7662; só com introspection configurada
+}
+
+// Issuer com esquema; o YAML aceita apenas o host (ex.: ca.internal)
+func IssuerURL(issuer string) string {
+	issuer = strings.TrimRight(issuer, "/")
+	if issuer == "" || strings.Contains(issuer, "://") {
+		return issuer
+	}
+	return "https://" + issuer
+}
+
+// Monta o documento de descoberta a partir das chaves publicadas em now, com as
+// mesmas regras do JWKS (PublishedEntries): os algoritmos de assinatura vêm das
+// chaves visíveis do grupo jwt
+func BuildDiscovery(issuer string, sigKeys []*KeyHolder, now time.Time) (*DiscoveryDocument, error) {
+	base := IssuerURL(issuer)
+
+	var sigAlgs []string
+	for _, key := range GetVisibleAt(sigKeys, now) {
+		alg, err := key.SigningAlgorithm()
+		if err != nil {
+			return nil, err
+		}
+		sigAlgs = append(sigAlgs, alg.Name)
+	}
+
+	return &DiscoveryDocument{
+		Issuer:                           base,
+		JWKSURI:                          base + JWKSPath,
+		SignedJWKSURI:                    base + SignedJWKSPath,
+		IDTokenSigningAlgValuesSupported: uniqueSorted(sigAlgs),
+	}, nil
+}
+
+// Documento de descoberta do issuer do snapshot
+func (s *KeySet) Discovery(now time.Time) (*DiscoveryDocument, error) {
+	doc, err := BuildDiscovery(s.issuer, s.Group("jwt"), now)
+	if err != nil {
+		return nil, err
+	}
+	if s.intro != nil {
+		doc.IntrospectionEndpoint = IssuerURL(s.issuer) + IntrospectPath
+	}
+	return doc, nil
+}
+
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
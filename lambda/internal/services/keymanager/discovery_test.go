@@ -0,0 +1,104 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+func TestIssuerURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ca.internal", "https://ca.internal"},
+		{"https://ca.internal/", "https://ca.internal"},
+		{"http://localhost:8080", "http://localhost:8080"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := IssuerURL(tt.in); got != tt.want {
+			t.Errorf("IssuerURL(%q) = %q, esperado %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDiscovery(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	holder := func(der []byte, alg string) *KeyHolder {
+		return NewKeyHolder(&kms.GetPublicKeyOutput{PublicKey: der}, nil, KeyEntry{KeyID: "k", Alg: alg, UseFrom: now.AddDate(0, -1, 0), ExpiresAt: now.AddDate(0, 1, 0)})
+	}
+	expired := holder(rsaDER, "PS384")
+	expired.ExpiresAt = now.Add(-time.Hour)
+	revoked := holder(rsaDER, "PS512")
+	revoked.RevokedAt = now.Add(-time.Hour)
+	older := holder(ecDER, "")
+	older.UseFrom = now.AddDate(0, -2, 0)
+
+	sigKeys := []*KeyHolder{holder(ecDER, ""), holder(rsaDER, "RS256"), holder(ecDER, "ES256"), expired, revoked}
+	sigKeys = append(sigKeys, older)
+
+	doc, err := BuildDiscovery("ca.internal", sigKeys, now)
+	if err != nil {
+		t.Fatalf("erro ao montar descoberta: %v", err)
+	}
+	if doc.Issuer != "https://ca.internal" || doc.JWKSURI != "https://ca.internal/.well-known/jwks.json" {
+		t.Errorf("issuer ou jwks_uri inesperados: %s %s", doc.Issuer, doc.JWKSURI)
+	}
+	if doc.SignedJWKSURI != "https://ca.internal/jwks-signed" {
+		t.Errorf("signed_jwks_uri inesperado: %s", doc.SignedJWKSURI)
+	}
+	if want := []string{"ES256", "RS256"}; !reflect.DeepEqual(doc.IDTokenSigningAlgValuesSupported, want) {
+		t.Errorf("algs de assinatura esperados %v, obtidos %v", want, doc.IDTokenSigningAlgValuesSupported)
+	}
+
+	if _, err := BuildDiscovery("ca.internal", []*KeyHolder{holder(ecDER, "PS256")}, now); err == nil {
+		t.Error("esperado erro para alg incompatível com a chave")
+	}
+}
+
+// Só anuncia o que o serviço atende: nenhum endpoint ou fluxo de autorização
+func TestKeySet_DiscoverySemFluxosInexistentes(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	key := NewKeyHolder(&kms.GetPublicKeyOutput{PublicKey: ecDER}, nil, KeyEntry{KeyID: "k", UseFrom: now.AddDate(0, -1, 0)})
+
+	served := map[string]bool{
+		"issuer":                                true,
+		"jwks_uri":                              true,
+		"signed_jwks_uri":                       true,
+		"id_token_signing_alg_values_supported": true,
+		"introspection_endpoint":                true,
+	}
+	for _, intro := range []*IntrospectionConfig{nil, {}} {
+		set := &KeySet{issuer: "ca.internal", groups: map[string][]*KeyHolder{"jwt": {key}}, intro: intro}
+		doc, err := set.Discovery(now)
+		if err != nil {
+			t.Fatalf("erro ao montar descoberta: %v", err)
+		}
+		data, _ := json.Marshal(doc)
+		var fields map[string]interface{}
+		json.Unmarshal(data, &fields)
+		for name := range fields {
+			if !served[name] {
+				t.Errorf("descoberta anuncia %s, que o serviço não atende", name)
+			}
+		}
+		if _, ok := fields["introspection_endpoint"]; ok != (intro != nil) {
+			t.Errorf("introspection_endpoint deveria aparecer só com introspection configurada: %s", data)
+		}
+	}
+}
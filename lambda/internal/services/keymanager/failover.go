@@ -0,0 +1,257 @@
+package keymanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+var (
+	ErrInvalidReplicaARN = errors.New("replica must be a KMS key ARN")
+	ErrReplicasExhausted = errors.New("signing failed on primary key and all replicas")
+)
+
+// Região de um ARN de chave do KMS (arn:aws:kms:<região>:<conta>:key/mrk-...)
+func ReplicaRegion(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kms" || parts[3] == "" || !strings.HasPrefix(parts[5], "key/") {
+		return "", fmt.Errorf("%w: %s", ErrInvalidReplicaARN, arn)
+	}
+	return parts[3], nil
+}
+
+// Cliente de assinatura de uma região
+type RegionClients func(region string) jwtkms.KMSClient
+
+// Clientes por região derivados de base, criados uma vez por região
+func KMSRegionClients(base *kms.Client) RegionClients {
+	var mu sync.Mutex
+	clients := map[string]jwtkms.KMSClient{}
+	return func(region string) jwtkms.KMSClient {
+		mu.Lock()
+		defer mu.Unlock()
+		if client, ok := clients[region]; ok {
+			return client
+		}
+		client := kms.New(base.Options(), func(o *kms.Options) { o.Region = region })
+		clients[region] = client
+		return client
+	}
+}
+
+// Failover das assinaturas para as réplicas listadas em "replicas"
+type FailoverConfig struct {
+	Clients        RegionClients
+	AttemptTimeout time.Duration // por tentativa; zero usa só o prazo do ctx
+	Metrics        *FailoverMetrics
+}
+
+// Erros em que outra região pode responder: throttling, timeout e falhas do
+// lado do KMS. Com o ctx da requisição encerrado não há tempo para tentar.
+func shouldFailover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var (
+		apiErr      smithy.APIError
+		respErr     *awshttp.ResponseError
+		netErr      net.Error
+		internal    *types.KMSInternalException
+		dependency  *types.DependencyTimeoutException
+		unavailable *types.KeyUnavailableException
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.As(err, &internal), errors.As(err, &dependency), errors.As(err, &unavailable):
+		return true
+	case errors.As(err, &respErr) && respErr.HTTPStatusCode() >= 500:
+		return true
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException":
+		return true
+	}
+	return false
+}
+
+type replica struct {
+	client jwtkms.KMSClient
+	keyID  string
+	region string
+}
+
+// Cliente de assinatura de uma chave multirregião. Sign vai primeiro à chave
+// principal e, nos erros de shouldFailover, às réplicas na ordem do YAML. As
+// réplicas compartilham o material da chave: a assinatura verifica com a mesma
+// chave pública e o kid não muda.
+type failoverClient struct {
+	jwtkms.KMSClient // principal; Verify e GetPublicKey sempre nela
+	keyID            string
+	replicas         []replica
+	timeout          time.Duration
+	metrics          *FailoverMetrics
+}
+
+func (f FailoverConfig) wrap(primary jwtkms.KMSClient, entry KeyEntry) (*failoverClient, error) {
+	client := &failoverClient{KMSClient: primary, keyID: entry.KeyID, timeout: f.AttemptTimeout, metrics: f.Metrics}
+	for _, arn := range entry.Replicas {
+		region, err := ReplicaRegion(arn)
+		if err != nil {
+			return nil, err
+		}
+		client.replicas = append(client.replicas, replica{client: f.Clients(region), keyID: arn, region: region})
+	}
+	return client, nil
+}
+
+func (c *failoverClient) Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	out, err := c.attempt(ctx, c.KMSClient, in, optFns)
+	if err == nil || !shouldFailover(ctx, err) {
+		return out, err
+	}
+
+	for _, r := range c.replicas {
+		replicaIn := *in
+		replicaIn.KeyId = aws.String(r.keyID)
+		out, replicaErr := c.attempt(ctx, r.client, &replicaIn, optFns)
+		c.metrics.Record(FailoverEvent{KeyID: c.keyID, Replica: r.keyID, Region: r.region, Cause: err, Succeeded: replicaErr == nil})
+		if replicaErr == nil {
+			return out, nil
+		}
+		if !shouldFailover(ctx, replicaErr) {
+			return nil, replicaErr
+		}
+		err = replicaErr
+	}
+	return nil, fmt.Errorf("%w: %s: %w", ErrReplicasExhausted, c.keyID, err)
+}
+
+func (c *failoverClient) attempt(ctx context.Context, client jwtkms.KMSClient, in *kms.SignInput, optFns []func(*kms.Options)) (*kms.SignOutput, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return client.Sign(ctx, in, optFns...)
+}
+
+// Assinatura desviada para uma réplica
+type FailoverEvent struct {
+	KeyID     string // key_id da entrada no YAML
+	Replica   string // ARN da réplica tentada
+	Region    string
+	Cause     error // erro que levou à réplica
+	Succeeded bool
+}
+
+// Contadores de failover por chave e região, com cada evento também emitido
+// no Embedded Metric Format do CloudWatch quando há um destino
+type FailoverMetrics struct {
+	namespace string
+	emf       io.Writer
+	clock     Clock
+
+	mu     sync.Mutex
+	counts map[string]FailoverCount
+}
+
+type FailoverCount struct {
+	KeyID     string `json:"key_id"`
+	Region    string `json:"region"`
+	Succeeded int64  `json:"succeeded"`
+	Failed    int64  `json:"failed"`
+}
+
+// emf nil só acumula os contadores
+func NewFailoverMetrics(namespace string, emf io.Writer, clock Clock) *FailoverMetrics {
+	return &FailoverMetrics{namespace: namespace, emf: emf, clock: clock, counts: map[string]FailoverCount{}}
+}
+
+// Registra o evento; métricas nil descartam
+func (m *FailoverMetrics) Record(event FailoverEvent) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := event.KeyID + " " + event.Region
+	count := m.counts[key]
+	count.KeyID, count.Region = event.KeyID, event.Region
+	if event.Succeeded {
+		count.Succeeded++
+	} else {
+		count.Failed++
+	}
+	m.counts[key] = count
+
+	if m.emf != nil {
+		m.writeEMF(event)
+	}
+}
+
+// Contadores desde o início do processo, por key_id e região
+func (m *FailoverMetrics) Counts() []FailoverCount {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make([]FailoverCount, 0, len(m.counts))
+	for _, count := range m.counts {
+		counts = append(counts, count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].KeyID != counts[j].KeyID {
+			return counts[i].KeyID < counts[j].KeyID
+		}
+		return counts[i].Region < counts[j].Region
+	})
+	return counts
+}
+
+// Uma linha JSON que o CloudWatch Logs converte nas métricas SigningFailover e
+// SigningFailoverError, com dimensões KeyId e Region
+func (m *FailoverMetrics) writeEMF(event FailoverEvent) {
+	succeeded, failed := 1, 0
+	if !event.Succeeded {
+		succeeded, failed = 0, 1
+	}
+	line := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": m.clock.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  m.namespace,
+				"Dimensions": [][]string{{"KeyId", "Region"}},
+				"Metrics": []map[string]string{
+					{"Name": "SigningFailover", "Unit": "Count"},
+					{"Name": "SigningFailoverError", "Unit": "Count"},
+				},
+			}},
+		},
+		"KeyId":                event.KeyID,
+		"Region":               event.Region,
+		"Replica":              event.Replica,
+		"SigningFailover":      succeeded,
+		"SigningFailoverError": failed,
+	}
+	if event.Cause != nil {
+		line["cause"] = event.Cause.Error()
+	}
+	json.NewEncoder(m.emf).Encode(line)
+}
@@ -0,0 +1,184 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func TestShouldFailover(t *testing.T) {
+	httpErr := func(status int) error {
+		return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      errors.New("falha simulada"),
+		}}
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"throttling", context.Background(), &smithy.GenericAPIError{Code: "ThrottlingException"}, true},
+		{"erro interno do KMS", context.Background(), &types.KMSInternalException{}, true},
+		{"HTTP 503", context.Background(), httpErr(http.StatusServiceUnavailable), true},
+		{"timeout da tentativa", context.Background(), context.DeadlineExceeded, true},
+		{"HTTP 400", context.Background(), httpErr(http.StatusBadRequest), false},
+		{"uso inválido", context.Background(), &types.InvalidKeyUsageException{}, false},
+		{"requisição encerrada", canceled, &types.KMSInternalException{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldFailover(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("shouldFailover(%v) = %v, esperado %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplicaRegion(t *testing.T) {
+	if region, err := ReplicaRegion("arn:aws:kms:sa-east-1:111122223333:key/mrk-1234"); err != nil || region != "sa-east-1" {
+		t.Errorf("região = %q (%v), esperado sa-east-1", region, err)
+	}
+	for _, arn := range []string{"alias/jwt", "arn:aws:kms:sa-east-1:111122223333:alias/jwt", "arn:aws:s3:::bucket"} {
+		if _, err := ReplicaRegion(arn); !errors.Is(err, ErrInvalidReplicaARN) {
+			t.Errorf("%s: esperado ErrInvalidReplicaARN, obtido %v", arn, err)
+		}
+	}
+}
+
+// Cliente cuja assinatura falha sempre com err
+type downClient struct {
+	*softkms.Client
+	err   error
+	delay time.Duration
+}
+
+func (c *downClient) Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	if c.delay > 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.Client.Sign(ctx, in, optFns...)
+}
+
+func TestKeyLoader_Failover(t *testing.T) {
+	const replicaARN = "arn:aws:kms:sa-east-1:000000000000:key/mrk-1"
+	ctx := context.Background()
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException"}
+
+	tests := []struct {
+		name       string
+		primary    *downClient
+		replicaErr error
+		wantErr    error
+		wantCounts []FailoverCount
+	}{
+		{"principal saudável", &downClient{}, nil, nil, nil},
+		{"throttling vai para a réplica", &downClient{err: throttled}, nil, nil,
+			[]FailoverCount{{KeyID: "alias/jwt", Region: "sa-east-1", Succeeded: 1}}},
+		{"timeout vai para a réplica", &downClient{delay: time.Second}, nil, nil,
+			[]FailoverCount{{KeyID: "alias/jwt", Region: "sa-east-1", Succeeded: 1}}},
+		{"erro do cliente não troca de região", &downClient{err: &types.InvalidKeyUsageException{}}, nil, &types.InvalidKeyUsageException{}, nil},
+		{"réplica também fora", &downClient{err: throttled}, throttled, ErrReplicasExhausted,
+			[]FailoverCount{{KeyID: "alias/jwt", Region: "sa-east-1", Failed: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.primary.Client = softkms.New()
+			out, err := tt.primary.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("alias/jwt")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			material, _ := tt.primary.Key("alias/jwt")
+			replica := &downClient{Client: softkms.New(), err: tt.replicaErr}
+			replica.AddKey(replicaARN, material.Private)
+
+			var emf bytes.Buffer
+			metrics := NewFailoverMetrics("teste", &emf, MockClock(now))
+			var regions []string
+			loader := newTestLoader(tt.primary, now).WithFailover(FailoverConfig{
+				Clients:        func(region string) jwtkms.KMSClient { regions = append(regions, region); return replica },
+				AttemptTimeout: 50 * time.Millisecond,
+				Metrics:        metrics,
+			})
+			groups, _, err := loader.Load(ctx, &Config{Keys: map[string][]KeyEntry{
+				"jwt": {{KeyID: "alias/jwt", UseFrom: now.AddDate(0, -1, 0), Replicas: []string{replicaARN}}},
+			}})
+			if err != nil {
+				t.Fatalf("erro no carregamento: %v", err)
+			}
+			if len(regions) != 1 || regions[0] != "sa-east-1" {
+				t.Errorf("clientes criados para %v, esperado [sa-east-1]", regions)
+			}
+
+			key := groups["jwt"][0]
+			token := jwt.NewWithClaims(key.SigningMethod(), jwt.MapClaims{"sub": "teste"})
+			token.Header["kid"] = key.Kid()
+			signed, err := token.SignedString(key.WithContext(ctx))
+			if tt.wantErr != nil {
+				if err == nil || !errors.As(err, new(*types.InvalidKeyUsageException)) && !errors.Is(err, tt.wantErr) {
+					t.Errorf("esperado %T, obtido %v", tt.wantErr, err)
+				}
+			} else {
+				pub, _ := x509.ParsePKIXPublicKey(out.PublicKey)
+				parsed, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return pub, nil })
+				if err != nil || !parsed.Valid || parsed.Header["kid"] != key.Kid() {
+					t.Errorf("assinatura deveria verificar com a chave principal e manter o kid: %v", err)
+				}
+			}
+
+			counts := metrics.Counts()
+			if len(counts) != len(tt.wantCounts) {
+				t.Fatalf("contadores = %+v, esperado %+v", counts, tt.wantCounts)
+			}
+			for i := range counts {
+				if counts[i] != tt.wantCounts[i] {
+					t.Errorf("contador = %+v, esperado %+v", counts[i], tt.wantCounts[i])
+				}
+			}
+			if len(tt.wantCounts) > 0 {
+				var line map[string]interface{}
+				if err := json.Unmarshal(emf.Bytes(), &line); err != nil || line["_aws"] == nil || line["Region"] != "sa-east-1" {
+					t.Errorf("métrica EMF inesperada: %s", emf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestKeyLoader_FailoverReplicaInvalida(t *testing.T) {
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	loader := newTestLoader(softkms.New(), now).WithFailover(FailoverConfig{
+		Clients: func(string) jwtkms.KMSClient { return softkms.New() },
+	})
+	_, report, err := loader.Load(context.Background(), &Config{Keys: map[string][]KeyEntry{
+		"jwt": {{KeyID: "alias/jwt", UseFrom: now.AddDate(0, -1, 0), Replicas: []string{"alias/jwt-sa"}}},
+	}})
+	if !errors.Is(err, ErrInvalidReplicaARN) || report.Keys[0].Loaded {
+		t.Errorf("réplica sem ARN deveria impedir o carregamento, obtido %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package keymanager
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidClient              = errors.New("invalid client credentials")
+	ErrInvalidIntrospectionConfig = errors.New("invalid introspection config")
+)
+
+// Clientes autorizados a chamar /introspect (RFC 7662). Sem a seção, nenhum
+// cliente se autentica.
+type IntrospectionConfig struct {
+	Clients []IntrospectionClient `yaml:"clients"`
+}
+
+type IntrospectionClient struct {
+	ID           string `yaml:"client_id"`
+	SecretSHA256 string `yaml:"client_secret_sha256"` // SHA-256 do segredo em hex; o segredo não fica na configuração
+}
+
+// Confere client_id e client_secret contra todos os clientes, sem saída
+// antecipada, para que o tempo de resposta não revele quais ids existem
+func (c *IntrospectionConfig) Authenticate(id, secret string) error {
+	if c == nil || id == "" {
+		return ErrInvalidClient
+	}
+	idSum, secretSum := sha256.Sum256([]byte(id)), sha256.Sum256([]byte(secret))
+	given := []byte(hex.EncodeToString(secretSum[:]))
+	match := 0
+	for _, client := range c.Clients {
+		clientSum := sha256.Sum256([]byte(client.ID))
+		match |= subtle.ConstantTimeCompare(idSum[:], clientSum[:]) & subtle.ConstantTimeCompare(given, []byte(client.SecretSHA256))
+	}
+	if match != 1 {
+		return ErrInvalidClient
+	}
+	return nil
+}
+
+func (c *IntrospectionConfig) validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, client := range c.Clients {
+		if client.ID == "" {
+			errs = append(errs, fmt.Errorf("cliente %d sem client_id", i))
+		}
+		if seen[client.ID] {
+			errs = append(errs, fmt.Errorf("client_id %q duplicado", client.ID))
+		}
+		seen[client.ID] = true
+		if b, err := hex.DecodeString(client.SecretSHA256); err != nil || len(b) != sha256.Size {
+			errs = append(errs, fmt.Errorf("client_id %q: client_secret_sha256 deve ter 64 dígitos hex", client.ID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Valida a seção introspection do nível raiz e de cada issuer
+func (c *Config) validateIntrospection() error {
+	var errs []error
+	if c.Introspection != nil {
+		if err := c.Introspection.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidIntrospectionConfig, err))
+		}
+	}
+	for _, name := range c.IssuerNames() {
+		if issuer := c.Issuers[name]; issuer.Introspection != nil {
+			if err := issuer.Introspection.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("%w: issuer %s: %w", ErrInvalidIntrospectionConfig, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Resposta de introspecção (RFC 7662, seção 2.2): active e, para tokens
+// válidos, as claims do JWT. Tokens expirados, de chave revogada ou com kid
+// desconhecido voltam só com active false, sem o motivo.
+func (s *KeySet) Introspect(token string, now time.Time) map[string]interface{} {
+	result := s.VerifyJWT(token, "", now)
+	if !result.Valid {
+		return map[string]interface{}{"active": false}
+	}
+	resp := make(map[string]interface{}, len(result.Claims)+2)
+	for name, value := range result.Claims {
+		resp[name] = value
+	}
+	resp["active"] = true
+	if _, ok := resp["token_type"]; !ok {
+		resp["token_type"] = "Bearer"
+	}
+	return resp
+}
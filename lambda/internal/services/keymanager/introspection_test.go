@@ -0,0 +1,107 @@
+package keymanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestIntrospectionConfig_Authenticate(t *testing.T) {
+	conf := &IntrospectionConfig{Clients: []IntrospectionClient{{ID: "gateway", SecretSHA256: hashSecret("segredo-1")}}}
+	tests := []struct {
+		name       string
+		conf       *IntrospectionConfig
+		id, secret string
+		wantErr    bool
+	}{
+		{"credenciais corretas", conf, "gateway", "segredo-1", false},
+		{"segredo errado", conf, "gateway", "segredo-2", true},
+		{"cliente desconhecido", conf, "outro", "segredo-1", true},
+		{"sem client_id", conf, "", "segredo-1", true},
+		{"segredo de outro cliente", &IntrospectionConfig{Clients: append(conf.Clients, IntrospectionClient{ID: "outro", SecretSHA256: hashSecret("segredo-2")})}, "gateway", "segredo-2", true},
+		{"sem introspection", nil, "gateway", "segredo-1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.Authenticate(tt.id, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidClient) {
+				t.Errorf("esperado ErrInvalidClient, obtido %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Introspection(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"cliente válido", "introspection:\n  clients:\n    - client_id: gateway\n      client_secret_sha256: " + hashSecret("segredo-1"), false},
+		{"hash inválido", "introspection:\n  clients:\n    - client_id: gateway\n      client_secret_sha256: segredo-1", true},
+		{"client_id duplicado", "introspection:\n  clients:\n    - client_id: gateway\n      client_secret_sha256: " + hashSecret("a") +
+			"\n    - client_id: gateway\n      client_secret_sha256: " + hashSecret("b"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidIntrospectionConfig) {
+				t.Errorf("esperado ErrInvalidIntrospectionConfig, obtido %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySet_Introspect_CacheNaoConferido(t *testing.T) {
+	now := mustParse(t, "2025-03-01T12:00:00Z")
+	attacker := softHolder(t, softkms.New(), "alias/jwt")
+	forged := jwt.NewWithClaims(attacker.SigningMethod(), jwt.MapClaims{"iss": "https://ca.internal", "sub": "intruso", "exp": now.Add(time.Minute).Unix()})
+	forged.Header["kid"] = attacker.Kid()
+	token, err := forged.SignedString(attacker.WithContext(context.Background()))
+	if err != nil {
+		t.Fatalf("falha ao assinar: %v", err)
+	}
+
+	cached := NewCachedPublicKey("alias/jwt", attacker.PubKey, nil, now)
+	checked, err := newCacheCheckClient(softkms.New(), NewMemoryPublicKeyCache(), cached)
+	if err != nil {
+		t.Fatalf("erro ao criar cliente: %v", err)
+	}
+	key := NewKeyHolder(cached.Output(), jwtkms.NewKMSConfig(checked, "alias/jwt", false), KeyEntry{KeyID: "alias/jwt", ExpiresAt: now.Add(time.Hour)})
+	key.cacheCheck = checked
+	set := NewKeySet("ca.internal", map[string][]*KeyHolder{"jwt": {key}}, nil, nil)
+
+	if resp := set.Introspect(token, now); resp["active"] != false || len(resp) != 1 {
+		t.Errorf("token assinado por chave não conferida deveria ser inativo: %v", resp)
+	}
+}
+
+func TestKeySet_Discovery_Introspection(t *testing.T) {
+	set := NewKeySet("ca.internal", nil, nil, nil)
+	if doc, _ := set.Discovery(time.Now()); doc.IntrospectionEndpoint != "" {
+		t.Errorf("introspection_endpoint sem clientes: %s", doc.IntrospectionEndpoint)
+	}
+	set.intro = &IntrospectionConfig{}
+	if doc, _ := set.Discovery(time.Now()); doc.IntrospectionEndpoint != "https://ca.internal/introspect" {
+		t.Errorf("introspection_endpoint = %q", doc.IntrospectionEndpoint)
+	}
+}
@@ -1,27 +1,143 @@
 package keymanager
 
 import (
+	_ "embed"
 	"encoding/json"
-	"fmt"
+	"time"
 )
 
-type kidMap map[string]string
-type issuerConfig struct {
-	Issuer         string `json:"issuer"`
-	SigningKeys    kidMap `json:"signing_keys"`
-	DecriptionKeys kidMap `json:"decryption_keys"`
+// Estado de uma chave na linha do tempo de rotação
+type KeyStatus string
+
+const (
+	KeyStatusPending  KeyStatus = "pending"  // use_from ainda no futuro
+	KeyStatusActive   KeyStatus = "active"   // chave usada agora para assinar/cifrar
+	KeyStatusRetiring KeyStatus = "retiring" // substituída, mas ainda publicada até expirar
+	KeyStatusExpired  KeyStatus = "expired"
+	KeyStatusRevoked  KeyStatus = "revoked" // revogação emergencial via revoked_at
+)
+
+// Esquema JSON do documento retornado por IssuerConfig
+//
+//go:embed issuer_schema.json
+var issuerSchema []byte
+
+func IssuerSchema() []byte {
+	return issuerSchema
+}
+
+type IssuerKey struct {
+	Kid       string     `json:"kid"`
+	KeyID     string     `json:"key_id"`
+	ARN       string     `json:"arn"`
+	Alg       string     `json:"alg"`
+	Use       string     `json:"use"`
+	Status    KeyStatus  `json:"status"`
+	UseFrom   time.Time  `json:"use_from"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+type IssuerMetadata struct {
+	Issuer          string       `json:"issuer"`
+	GeneratedAt     time.Time    `json:"generated_at"`
+	SigningKeys     []IssuerKey  `json:"signing_keys"`
+	DecryptionKeys  []IssuerKey  `json:"decryption_keys"`
+	JWKSSigningKeys []IssuerKey  `json:"jwks_signing_keys"`
+	Revocations     []Revocation `json:"revocations"`
+}
+
+// Evento de revogação, para consumidores que mantêm cache de chaves
+type Revocation struct {
+	Kid       string    `json:"kid"`
+	KeyID     string    `json:"key_id"`
+	ARN       string    `json:"arn"`
+	Use       string    `json:"use"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Metadados do issuer: chaves jwt (assinatura), jose (decifragem) e jwks
+// (assinatura do JWKS), cada uma com seu estado no instante now
+func BuildIssuerMetadata(issuer string, jwtKeys, joseKeys, jwksKeys []*KeyHolder, now time.Time) (*IssuerMetadata, error) {
+	meta := &IssuerMetadata{Issuer: IssuerURL(issuer), GeneratedAt: now.UTC(), Revocations: []Revocation{}}
+
+	var err error
+	if meta.SigningKeys, err = issuerKeys(jwtKeys, GroupUses["jwt"], now); err != nil {
+		return nil, err
+	}
+	if meta.DecryptionKeys, err = issuerKeys(joseKeys, GroupUses["jose"], now); err != nil {
+		return nil, err
+	}
+	if meta.JWKSSigningKeys, err = issuerKeys(jwksKeys, GroupUses["jwks"], now); err != nil {
+		return nil, err
+	}
+
+	for _, group := range [][]IssuerKey{meta.SigningKeys, meta.DecryptionKeys, meta.JWKSSigningKeys} {
+		for _, k := range group {
+			if k.Status == KeyStatusRevoked {
+				meta.Revocations = append(meta.Revocations, Revocation{
+					Kid:       k.Kid,
+					KeyID:     k.KeyID,
+					ARN:       k.ARN,
+					Use:       k.Use,
+					RevokedAt: *k.RevokedAt,
+					Reason:    k.Reason,
+				})
+			}
+		}
+	}
+	return meta, nil
 }
 
-func buildIssuerConfig(signKeys []*KeyHolder, joseKey *KeyHolder) ([]byte, error) {
-	dks := make(kidMap, len(signKeys))
-	for i, v := range signKeys {
-		dks[v.Kid()] = signKeys[i].KeyId()
+func issuerKeys(keys []*KeyHolder, use string, now time.Time) ([]IssuerKey, error) {
+	active := GetActiveKey(keys, now)
+	out := make([]IssuerKey, 0, len(keys))
+	for _, key := range keys {
+		alg, _, err := jwkAlgorithm(key, use)
+		if err != nil {
+			return nil, err
+		}
+		issuerKey := IssuerKey{
+			Kid:       key.Kid(),
+			KeyID:     key.keyID,
+			ARN:       key.KeyId(),
+			Alg:       alg,
+			Use:       use,
+			Status:    statusAt(key, active, now),
+			UseFrom:   key.UseFrom,
+			ExpiresAt: key.ExpiresAt,
+		}
+		if key.RevokedBy(now) {
+			revokedAt := key.RevokedAt
+			issuerKey.RevokedAt = &revokedAt
+			issuerKey.Reason = key.Reason
+		}
+		out = append(out, issuerKey)
 	}
+	return out, nil
+}
+
+func statusAt(key, active *KeyHolder, now time.Time) KeyStatus {
+	switch {
+	case key.RevokedBy(now):
+		return KeyStatusRevoked
+	case !key.ExpiresAt.After(now):
+		return KeyStatusExpired
+	case key.UseFrom.After(now):
+		return KeyStatusPending
+	case key == active:
+		return KeyStatusActive
+	default:
+		return KeyStatusRetiring
+	}
+}
 
-	conf := &issuerConfig{
-		Issuer:         fmt.Sprintf("https://%s", "TESTE"),
-		SigningKeys:    kidMap{joseKey.Kid(): joseKey.KeyId()},
-		DecriptionKeys: dks,
+func buildIssuerConfig(issuer string, jwtKeys, joseKeys, jwksKeys []*KeyHolder, now time.Time) ([]byte, error) {
+	meta, err := BuildIssuerMetadata(issuer, jwtKeys, joseKeys, jwksKeys, now)
+	if err != nil {
+		return nil, err
 	}
-	return json.Marshal(conf)
+	return json.Marshal(meta)
 }
@@ -1,22 +1,127 @@
 package keymanager
 
 import (
-	"github.com/aws/aws-sdk-go-v2/service/kms"
-	"strings"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 )
 
-func TestBuildIssuerConfig(t *testing.T) {
-	jose := &KeyHolder{PubKey: &kms.GetPublicKeyOutput{KeyId: strPtr("jose-key")}}
-	sign := []*KeyHolder{
-		{PubKey: &kms.GetPublicKeyOutput{KeyId: strPtr("sig-1")}},
-		{PubKey: &kms.GetPublicKeyOutput{KeyId: strPtr("sig-2")}},
+func TestBuildIssuerMetadata(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	now := mustParse(t, "2025-01-10T00:00:00Z")
+
+	holder := func(arn, useFrom, expiresAt string) *KeyHolder {
+		return NewKeyHolder(&kms.GetPublicKeyOutput{PublicKey: pubDER, KeyId: strPtr(arn)}, nil, KeyEntry{
+			KeyID:     "alias/" + arn,
+			UseFrom:   mustParse(t, useFrom),
+			ExpiresAt: mustParse(t, expiresAt),
+		})
+	}
+
+	jwtKeys := []*KeyHolder{
+		holder("sig-expirada", "2024-01-01T00:00:00Z", "2025-01-01T00:00:00Z"),
+		holder("sig-saindo", "2024-12-01T00:00:00Z", "2025-02-01T00:00:00Z"),
+		holder("sig-ativa", "2025-01-05T00:00:00Z", "2026-01-01T00:00:00Z"),
+		holder("sig-futura", "2025-02-01T00:00:00Z", "2026-01-01T00:00:00Z"),
+	}
+	joseKeys := []*KeyHolder{holder("jose", "2024-01-01T00:00:00Z", "2026-01-01T00:00:00Z")}
+	jwksKeys := []*KeyHolder{holder("jwks", "2024-01-01T00:00:00Z", "2026-01-01T00:00:00Z")}
+
+	meta, err := BuildIssuerMetadata("ca.internal", jwtKeys, joseKeys, jwksKeys, now)
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if meta.Issuer != "https://ca.internal" {
+		t.Errorf("issuer inesperado: %s", meta.Issuer)
+	}
+
+	want := map[string]KeyStatus{
+		"sig-expirada": KeyStatusExpired,
+		"sig-saindo":   KeyStatusRetiring,
+		"sig-ativa":    KeyStatusActive,
+		"sig-futura":   KeyStatusPending,
+	}
+	for _, k := range meta.SigningKeys {
+		if k.Status != want[k.ARN] {
+			t.Errorf("%s: esperado estado %s, obtido %s", k.ARN, want[k.ARN], k.Status)
+		}
+		if k.Use != "sig" || k.Alg != "ES256" || k.KeyID != "alias/"+k.ARN {
+			t.Errorf("%s: metadados inesperados %+v", k.ARN, k)
+		}
+	}
+
+	if len(meta.DecryptionKeys) != 1 || meta.DecryptionKeys[0].ARN != "jose" || meta.DecryptionKeys[0].Alg != "ECDH-ES" {
+		t.Errorf("chaves de decifragem inesperadas: %+v", meta.DecryptionKeys)
 	}
-	out, err := buildIssuerConfig(sign, jose)
+	if len(meta.JWKSSigningKeys) != 1 || meta.JWKSSigningKeys[0].ARN != "jwks" {
+		t.Errorf("chaves do JWKS inesperadas: %+v", meta.JWKSSigningKeys)
+	}
+	if len(meta.Revocations) != 0 {
+		t.Errorf("esperado nenhuma revogação, obtido %+v", meta.Revocations)
+	}
+}
+
+func TestBuildIssuerMetadata_Revogacao(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	now := mustParse(t, "2025-01-10T00:00:00Z")
+
+	revoked := NewKeyHolder(&kms.GetPublicKeyOutput{PublicKey: pubDER, KeyId: strPtr("sig-comprometida")}, nil, KeyEntry{
+		KeyID:     "alias/sig-comprometida",
+		UseFrom:   mustParse(t, "2025-01-01T00:00:00Z"),
+		RevokedAt: mustParse(t, "2025-01-09T12:00:00Z"),
+		Reason:    "chave exposta em log",
+		ExpiresAt: mustParse(t, "2026-01-01T00:00:00Z"),
+	})
+
+	meta, err := BuildIssuerMetadata("ca.internal", []*KeyHolder{revoked}, nil, nil, now)
 	if err != nil {
 		t.Fatalf("erro inesperado: %v", err)
 	}
-	if !strings.Contains(string(out), "jose-key") {
-		t.Error("KID esperado não encontrado na saída")
+	if meta.SigningKeys[0].Status != KeyStatusRevoked || meta.SigningKeys[0].Reason != "chave exposta em log" {
+		t.Errorf("chave revogada com metadados inesperados: %+v", meta.SigningKeys[0])
+	}
+	if len(meta.Revocations) != 1 || meta.Revocations[0].ARN != "sig-comprometida" || !meta.Revocations[0].RevokedAt.Equal(revoked.RevokedAt) {
+		t.Errorf("evento de revogação inesperado: %+v", meta.Revocations)
+	}
+}
+
+func TestIssuerSchema_CobreODocumento(t *testing.T) {
+	var schema struct {
+		Required []string `json:"required"`
+		Defs     struct {
+			Key struct {
+				Required []string `json:"required"`
+			} `json:"key"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(IssuerSchema(), &schema); err != nil {
+		t.Fatalf("esquema inválido: %v", err)
+	}
+
+	raw, _ := json.Marshal(IssuerMetadata{SigningKeys: []IssuerKey{{}}})
+	var doc map[string]json.RawMessage
+	_ = json.Unmarshal(raw, &doc)
+	if len(doc) != len(schema.Required) {
+		t.Errorf("esquema exige %d campos, documento tem %d", len(schema.Required), len(doc))
+	}
+	for _, field := range schema.Required {
+		if _, ok := doc[field]; !ok {
+			t.Errorf("campo %s do esquema ausente no documento", field)
+		}
+	}
+
+	var keys []map[string]json.RawMessage
+	_ = json.Unmarshal(doc["signing_keys"], &keys)
+	for _, field := range schema.Defs.Key.Required {
+		if _, ok := keys[0][field]; !ok {
+			t.Errorf("campo %s da chave ausente no documento", field)
+		}
 	}
 }
@@ -5,7 +5,6 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"math/big"
@@ -18,19 +17,23 @@ var (
 	ErrConfiguredKeyNotSupported = errors.New("configured key not supported")
 	ErrInvalidKey                = errors.New("invalid public key")
 	ErrCouldNotSignKey           = errors.New("could not sign key")
+	ErrUnsupportedKeyUse         = errors.New("unsupported key use")
+	ErrNoActiveKey               = errors.New("no active key")
 )
 
 type JWK struct {
-	Kty string   `json:"kty"`
-	Kid string   `json:"kid"`
-	Use string   `json:"use"`
-	Alg string   `json:"alg"`
-	N   string   `json:"n,omitempty"`
-	E   string   `json:"e,omitempty"`
-	Crv string   `json:"crv,omitempty"`
-	X   string   `json:"x,omitempty"`
-	Y   string   `json:"y,omitempty"`
-	X5c []string `json:"x5c,omitempty"`
+	Kty     string   `json:"kty"`
+	Kid     string   `json:"kid"`
+	Use     string   `json:"use"`
+	Alg     string   `json:"alg"`
+	KeyOps  []string `json:"key_ops,omitempty"`
+	N       string   `json:"n,omitempty"`
+	E       string   `json:"e,omitempty"`
+	Crv     string   `json:"crv,omitempty"`
+	X       string   `json:"x,omitempty"`
+	Y       string   `json:"y,omitempty"`
+	X5c     []string `json:"x5c,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
 }
 
 type JWKS struct {
@@ -38,22 +41,31 @@ type JWKS struct {
 }
 
 type JWKSEntry struct {
-	key *KeyHolder
-	use string
+	key   *KeyHolder
+	use   string
+	chain [][]byte // certificados DER, folha primeiro
 }
 
 type JWKSConfig struct {
 	issuer            string
 	expireInHours     int
 	skewTimeInSeconds int
+	kid               string
 }
 
 func NewJWKSEntry(key *KeyHolder, use string) *JWKSEntry {
-	return &JWKSEntry{key, use}
+	return &JWKSEntry{key: key, use: use}
 }
 
 func NewJWKSConfig(issuer string, expireInHours int, skewTimeInSeconds int) *JWKSConfig {
-	return &JWKSConfig{issuer, expireInHours, skewTimeInSeconds}
+	return &JWKSConfig{issuer: issuer, expireInHours: expireInHours, skewTimeInSeconds: skewTimeInSeconds}
+}
+
+// Define o kid do assinante do JWKS, enviado no header do JWT
+func (c *JWKSConfig) WithKid(kid string) *JWKSConfig {
+	c2 := *c
+	c2.kid = kid
+	return &c2
 }
 
 func base64urlUInt(b *big.Int) string {
@@ -64,6 +76,15 @@ func base64urlInt(i int) string {
 	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i)).Bytes())
 }
 
+// Coordenadas EC com o tamanho fixo da curva (RFC 7518, seção 6.2.1.2)
+func base64urlCoord(b *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(b.FillBytes(make([]byte, size)))
+}
+
+func coordinateSize(pub *ecdsa.PublicKey) int {
+	return (pub.Curve.Params().BitSize + 7) / 8
+}
+
 func BuildJWKS(
 	entries []*JWKSEntry,
 	config *JWKSConfig,
@@ -93,6 +114,9 @@ func BuildJWKS(
 	}
 
 	token := jwt.NewWithClaims(signMethod, claims)
+	if config.kid != "" {
+		token.Header["kid"] = config.kid
+	}
 
 	signedJWT, err := token.SignedString(signer)
 	if err != nil {
@@ -111,40 +135,46 @@ func BuildJWKSet(entries []*JWKSEntry) (JWKS, error) {
 			return JWKS{}, fmt.Errorf("%w: %w", ErrInvalidKey, err)
 		}
 
-		pemBlock := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pair.key.PubKey.PublicKey})
-		cert := base64.StdEncoding.EncodeToString(pemBlock)
+		var x5c []string
+		var x5t string
+		for _, der := range pair.chain {
+			x5c = append(x5c, base64.StdEncoding.EncodeToString(der))
+		}
+		if len(pair.chain) > 0 {
+			x5t = certificateThumbprint(pair.chain[0])
+		}
+
+		alg, keyOps, err := jwkAlgorithm(pair.key, pair.use)
+		if err != nil {
+			return JWKS{}, err
+		}
 
 		switch pub := pubKey.(type) {
 		case *rsa.PublicKey:
 			keys = append(keys, JWK{
-				Kty: "RSA",
-				Kid: pair.key.Kid(),
-				Use: pair.use,
-				Alg: "RS256",
-				N:   base64urlUInt(pub.N),
-				E:   base64urlInt(pub.E),
-				X5c: []string{cert},
+				Kty:     "RSA",
+				Kid:     pair.key.Kid(),
+				Use:     pair.use,
+				Alg:     alg,
+				KeyOps:  keyOps,
+				N:       base64urlUInt(pub.N),
+				E:       base64urlInt(pub.E),
+				X5c:     x5c,
+				X5tS256: x5t,
 			})
 		case *ecdsa.PublicKey:
 			curve := pub.Curve.Params().Name
-			alg := map[string]string{
-				"P-256": "ES256",
-				"P-384": "ES384",
-				"P-521": "ES512",
-			}[curve]
-			if alg == "" {
-				return JWKS{}, fmt.Errorf("curva EC não suportada: %s", curve)
-			}
-
 			keys = append(keys, JWK{
-				Kty: "EC",
-				Kid: pair.key.Kid(),
-				Use: pair.use,
-				Alg: alg,
-				Crv: curve,
-				X:   base64urlUInt(pub.X),
-				Y:   base64urlUInt(pub.Y),
-				X5c: []string{cert},
+				Kty:     "EC",
+				Kid:     pair.key.Kid(),
+				Use:     pair.use,
+				Alg:     alg,
+				KeyOps:  keyOps,
+				Crv:     curve,
+				X:       base64urlCoord(pub.X, coordinateSize(pub)),
+				Y:       base64urlCoord(pub.Y, coordinateSize(pub)),
+				X5c:     x5c,
+				X5tS256: x5t,
 			})
 		default:
 			return JWKS{}, ErrConfiguredKeyNotSupported
@@ -5,7 +5,11 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/golang-jwt/jwt/v5"
 	"testing"
@@ -21,16 +25,22 @@ func TestBuildJWKSet(t *testing.T) {
 	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
 
+	// Gerar chave EC P-384
+	ec384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ec384DER, _ := x509.MarshalPKIXPublicKey(&ec384Key.PublicKey)
+
 	type args struct {
 		pubBytes []byte
 		use      string
 		kty      string
 		keyId    string
+		alg      string
 	}
 
 	tests := []struct {
 		name      string
 		args      args
+		wantAlg   string
 		wantError bool
 	}{
 		{
@@ -41,8 +51,42 @@ func TestBuildJWKSet(t *testing.T) {
 				kty:      "RSA",
 				keyId:    "aws::kms:/alias/rsa_1_Ok",
 			},
+			wantAlg:   "PS256",
+			wantError: false,
+		},
+		{
+			name: "Chave RSA com alg explícito",
+			args: args{
+				pubBytes: rsaDER,
+				use:      "sig",
+				kty:      "RSA",
+				keyId:    "aws::kms:/alias/rsa_rs512",
+				alg:      "RS512",
+			},
+			wantAlg:   "RS512",
+			wantError: false,
+		},
+		{
+			name: "Chave EC P-384 válida",
+			args: args{
+				pubBytes: ec384DER,
+				use:      "sig",
+				kty:      "EC",
+				keyId:    "aws::kms:/alias/ecdsa_384",
+			},
+			wantAlg:   "ES384",
 			wantError: false,
 		},
+		{
+			name: "alg incompatível com a chave",
+			args: args{
+				pubBytes: ec384DER,
+				use:      "sig",
+				keyId:    "aws::kms:/alias/ecdsa_384_bad",
+				alg:      "ES256",
+			},
+			wantError: true,
+		},
 		{
 			name: "Chave EC P-256 válida",
 			args: args{
@@ -51,8 +95,51 @@ func TestBuildJWKSet(t *testing.T) {
 				kty:      "EC",
 				keyId:    "aws::kms:/alias/ecdsa_1_Ok",
 			},
+			wantAlg:   "ECDH-ES",
+			wantError: false,
+		},
+		{
+			name: "Chave RSA de cifragem",
+			args: args{
+				pubBytes: rsaDER,
+				use:      "enc",
+				kty:      "RSA",
+				keyId:    "aws::kms:/alias/rsa_enc",
+			},
+			wantAlg:   "RSA-OAEP-256",
 			wantError: false,
 		},
+		{
+			name: "Chave RSA de cifragem com RSA-OAEP",
+			args: args{
+				pubBytes: rsaDER,
+				use:      "enc",
+				kty:      "RSA",
+				keyId:    "aws::kms:/alias/rsa_enc_oaep",
+				alg:      "RSA-OAEP",
+			},
+			wantAlg:   "RSA-OAEP",
+			wantError: false,
+		},
+		{
+			name: "Chave de cifragem com alg de assinatura",
+			args: args{
+				pubBytes: rsaDER,
+				use:      "enc",
+				keyId:    "aws::kms:/alias/rsa_enc_ps256",
+				alg:      "PS256",
+			},
+			wantError: true,
+		},
+		{
+			name: "Uso desconhecido",
+			args: args{
+				pubBytes: rsaDER,
+				use:      "wrap",
+				keyId:    "aws::kms:/alias/rsa_wrap",
+			},
+			wantError: true,
+		},
 		{
 			name: "Chave inválida (dados corrompidos)",
 			args: args{
@@ -69,6 +156,7 @@ func TestBuildJWKSet(t *testing.T) {
 			holder := &KeyHolder{
 				PubKey: &kms.GetPublicKeyOutput{PublicKey: tt.args.pubBytes, KeyId: &tt.args.keyId},
 				keyID:  tt.args.keyId,
+				alg:    tt.args.alg,
 			}
 			entry := &JWKSEntry{
 				key: holder,
@@ -83,10 +171,70 @@ func TestBuildJWKSet(t *testing.T) {
 			if err == nil && jwks.Keys[0].Kty != tt.args.kty {
 				t.Errorf("esperado tipo %s, obtido %s", tt.args.kty, jwks.Keys[0].Kty)
 			}
+			if err == nil && jwks.Keys[0].Alg != tt.wantAlg {
+				t.Errorf("esperado alg %s, obtido %s", tt.wantAlg, jwks.Keys[0].Alg)
+			}
+			if err == nil && len(jwks.Keys[0].KeyOps) == 0 {
+				t.Error("esperado key_ops preenchido")
+			}
 		})
 	}
 }
 
+func TestBuildJWKSet_KeyOpsPorUso(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	keyID := "alias/rsa"
+	holder := &KeyHolder{PubKey: &kms.GetPublicKeyOutput{PublicKey: rsaDER, KeyId: &keyID}}
+
+	jwks, err := BuildJWKSet([]*JWKSEntry{{key: holder, use: "sig"}, {key: holder, use: "enc"}})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if ops := jwks.Keys[0].KeyOps; len(ops) != 1 || ops[0] != "verify" {
+		t.Errorf("esperado key_ops [verify] para sig, obtido %v", ops)
+	}
+	if ops := jwks.Keys[1].KeyOps; len(ops) != 2 || ops[0] != "encrypt" || ops[1] != "wrapKey" {
+		t.Errorf("esperado key_ops [encrypt wrapKey] para enc, obtido %v", ops)
+	}
+}
+
+func TestBuildJWKSet_RejeitaUsoDesconhecido(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	keyID := "alias/ec"
+	holder := &KeyHolder{PubKey: &kms.GetPublicKeyOutput{PublicKey: ecDER, KeyId: &keyID}}
+
+	_, err := BuildJWKSet([]*JWKSEntry{{key: holder, use: "sign"}})
+	if !errors.Is(err, ErrUnsupportedKeyUse) {
+		t.Errorf("esperado ErrUnsupportedKeyUse, obtido %v", err)
+	}
+}
+
+func TestBuildJWKSet_KidRecomputavelPeloJWK(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	keyID := "alias/ec521"
+	holder := &KeyHolder{PubKey: &kms.GetPublicKeyOutput{PublicKey: ecDER, KeyId: &keyID}, kidStrategy: KidStrategyThumbprint}
+
+	jwks, err := BuildJWKSet([]*JWKSEntry{{key: holder, use: "sig"}})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	jwk := jwks.Keys[0]
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, _ := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if len(x) != 66 || len(y) != 66 {
+		t.Errorf("coordenadas P-521 devem ter 66 bytes, obtido x=%d y=%d", len(x), len(y))
+	}
+
+	canonical := fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y)
+	sum := sha256.Sum256([]byte(canonical))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); jwk.Kid != want {
+		t.Errorf("kid %s não corresponde ao thumbprint do JWK publicado %s", jwk.Kid, want)
+	}
+}
+
 func TestBuildJWKS_UsandoECDSA(t *testing.T) {
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -116,6 +264,7 @@ func TestBuildJWKS_UsandoECDSA(t *testing.T) {
 		issuer:            "https://test.issuer",
 		expireInHours:     6,
 		skewTimeInSeconds: 0,
+		kid:               "jwks-signer",
 	}
 
 	tokenStr, err := BuildJWKS([]*JWKSEntry{entry}, cfg, jwt.SigningMethodES256, priv)
@@ -129,12 +278,15 @@ func TestBuildJWKS_UsandoECDSA(t *testing.T) {
 		JWKS JWKS `json:"jwks"`
 		jwt.RegisteredClaims
 	}
-	_, err = parser.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+	token, err := parser.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
 		return &priv.PublicKey, nil
 	})
 	if err != nil {
 		t.Fatalf("erro ao parsear token: %v", err)
 	}
+	if token.Header["kid"] != "jwks-signer" {
+		t.Errorf("esperado kid do assinante no header, obtido %v", token.Header["kid"])
+	}
 
 	if len(claims.JWKS.Keys) == 0 {
 		t.Fatal("JWKS vazio no token")
@@ -48,11 +48,12 @@ func TestJWKSCurrent_ComRotacaoTemporal(t *testing.T) {
 		ExpiresAt: mustParse(t, "2026-01-01T00:00:00Z"),
 	}
 
-	// ✅ jwtKey2: só ativa depois de 1 dia (sig)
+	// ✅ jwtKey2: só ativa e publicada depois de 1 dia (sig)
 	jwtKey2 := &KeyHolder{
-		PubKey:    &kms.GetPublicKeyOutput{PublicKey: pubDER2, KeyId: &kid2},
-		UseFrom:   mustParse(t, "2025-01-02T00:00:00Z"),
-		ExpiresAt: mustParse(t, "2026-01-01T00:00:00Z"),
+		PubKey:      &kms.GetPublicKeyOutput{PublicKey: pubDER2, KeyId: &kid2},
+		UseFrom:     mustParse(t, "2025-01-02T00:00:00Z"),
+		PublishFrom: mustParse(t, "2025-01-02T00:00:00Z"),
+		ExpiresAt:   mustParse(t, "2026-01-01T00:00:00Z"),
 	}
 
 	// ✅ jwksSigner: ativa desde sempre
@@ -63,36 +64,39 @@ func TestJWKSCurrent_ComRotacaoTemporal(t *testing.T) {
 	}
 
 	// Criar instância manual de keyManager
+	store := &KeyStore{}
+	store.Store(NewKeySet("https://issuer.example", map[string][]*KeyHolder{
+		"jose": {joseKeyFuture, joseKeyNow},
+		"jwt":  {jwtKey1, jwtKey2},
+		"jwks": {jwksKey},
+	}, nil, nil))
 	k := &keyManager{
-		joseKeys:          []*KeyHolder{joseKeyFuture, joseKeyNow},
-		jwtKeys:           []*KeyHolder{jwtKey1, jwtKey2},
-		jwksKeys:          []*KeyHolder{jwksKey},
-		issuer:            "https://issuer.example",
+		keys:              store,
 		expireInHours:     12,
 		skewTimeInSeconds: 0,
 		clock:             myClock,
 	}
 
-	// ▶️ Etapa 1: agora = 2025-01-01 → apenas jwtKey1 deve estar visível, e joseKey ainda não ativa
-	entries, _ := k.currentKeys()
+	// ▶️ Etapa 1: agora = 2025-01-01 → apenas jwtKey1 deve estar visível, e só joseKeyNow ativa
+	entries, _ := currentKeys(k.keys.Current(), k.clock.Now())
 	jwks1, err := BuildJWKSet(entries)
 	if err != nil {
 		t.Fatalf("erro ao gerar jwks etapa 1: %v", err)
 	}
 	if len(jwks1.Keys) != 2 {
-		t.Errorf("esperado 1 sig + 1 enc (mesmo inativo), obtido %d", len(jwks1.Keys))
+		t.Errorf("esperado 1 sig + 1 enc, obtido %d", len(jwks1.Keys))
 	}
 	if countByUse(jwks1.Keys, "sig") != 1 {
 		t.Errorf("esperado 1 chave 'sig', obtido %d", countByUse(jwks1.Keys, "sig"))
 	}
-	if countByUse(jwks1.Keys, "enc") != 0 {
-		t.Errorf("esperado 0 chave 'enc' ativa, obtido %d", countByUse(jwks1.Keys, "enc"))
+	if countByUse(jwks1.Keys, "enc") != 1 {
+		t.Errorf("esperado 1 chave 'enc' ativa, obtido %d", countByUse(jwks1.Keys, "enc"))
 	}
 
 	// ▶️ Etapa 2: avançar para 2025-01-03 → todas as chaves devem aparecer
 	now = mustParse(t, "2025-01-03T00:00:00Z")
 	myClock.SetTime(now)
-	entries, _ = k.currentKeys()
+	entries, _ = currentKeys(k.keys.Current(), k.clock.Now())
 	jwks2, err := BuildJWKSet(entries)
 	if err != nil {
 		t.Fatalf("erro ao gerar jwks etapa 2: %v", err)
@@ -103,6 +107,20 @@ func TestJWKSCurrent_ComRotacaoTemporal(t *testing.T) {
 	if countByUse(jwks2.Keys, "enc") != 1 {
 		t.Errorf("esperado 1 chave 'enc' ativa, obtido %d", countByUse(jwks2.Keys, "enc"))
 	}
+
+	// ▶️ Etapa 3: jwtKey2 revogada → some do JWKS e jwtKey1 volta a assinar
+	jwtKey2.RevokedAt = now
+	entries, _ = currentKeys(k.keys.Current(), k.clock.Now())
+	jwks3, err := BuildJWKSet(entries)
+	if err != nil {
+		t.Fatalf("erro ao gerar jwks etapa 3: %v", err)
+	}
+	if countByUse(jwks3.Keys, "sig") != 1 {
+		t.Errorf("esperado 1 chave 'sig' após revogação, obtido %d", countByUse(jwks3.Keys, "sig"))
+	}
+	if active := k.keys.Current().Active("jwt", now); active != jwtKey1 {
+		t.Errorf("chave revogada não deveria assinar, ativa: %s", active.KeyId())
+	}
 }
 
 // utilitário para contar chaves por uso
@@ -2,8 +2,6 @@ package keymanager
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
 	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
@@ -12,11 +10,22 @@ import (
 
 // Estrutura que empacota uma chave do KMS
 type KeyHolder struct {
-	config    *jwtkms.Config
-	PubKey    *kms.GetPublicKeyOutput
-	keyID     string
-	UseFrom   time.Time
-	ExpiresAt time.Time
+	config      *jwtkms.Config
+	PubKey      *kms.GetPublicKeyOutput
+	keyID       string
+	alg         string
+	kid         string
+	kidStrategy KidStrategy
+	UseFrom     time.Time
+	PublishFrom time.Time
+	RetireAt    time.Time
+	RevokedAt   time.Time
+	Reason      string
+	ExpiresAt   time.Time
+
+	// Presente quando a chave pública veio do cache e ainda depende da
+	// conferência da primeira assinatura
+	cacheCheck *cacheCheckClient
 }
 
 // Métodos auxiliares para assinatura
@@ -25,36 +34,100 @@ func (k *KeyHolder) WithContext(ctx context.Context) *jwtkms.Config {
 }
 
 func (k *KeyHolder) SigningMethod() *jwtkms.KMSSigningMethod {
-	switch k.PubKey.KeySpec {
-	case types.KeySpecRsa2048, types.KeySpecRsa3072, types.KeySpecRsa4096:
-		return jwtkms.SigningMethodPS256
-	case types.KeySpecEccNistP256, types.KeySpecEccNistP384, types.KeySpecEccNistP521, types.KeySpecEccSecgP256k1:
-		return jwtkms.SigningMethodECDSA256
-	default:
+	alg, err := k.SigningAlgorithm()
+	if err != nil {
 		return nil
 	}
+	return alg.Method
+}
+
+// Algoritmo JWS da chave: o "alg" do YAML ou o padrão da spec
+func (k *KeyHolder) SigningAlgorithm() (*SigningAlgorithm, error) {
+	return ResolveSigningAlgorithm(k.alg, k.KeySpec())
+}
+
+// Algoritmo JWE da chave quando usada para cifragem ("enc")
+func (k *KeyHolder) EncryptionAlgorithm() (*EncryptionAlgorithm, error) {
+	return ResolveEncryptionAlgorithm(k.alg, k.KeySpec())
+}
+
+// Garante que a chave tem algoritmo compatível com o uso ("sig" ou "enc")
+func (k *KeyHolder) ValidateUse(use string) error {
+	_, _, err := jwkAlgorithm(k, use)
+	return err
+}
+
+// Spec informada pelo KMS ou, na ausência dela, deduzida da chave pública
+func (k *KeyHolder) KeySpec() types.KeySpec {
+	if k.PubKey.KeySpec != "" {
+		return k.PubKey.KeySpec
+	}
+	return keySpecFromDER(k.PubKey.PublicKey)
 }
 func (k *KeyHolder) KeyId() string {
 	return *k.PubKey.KeyId
 }
+
+// kid da chave; configurações inválidas são barradas no carregamento via ResolveKid
 func (k *KeyHolder) Kid() string {
-	raw := *k.PubKey.KeyId
+	kid, _ := k.ResolveKid()
+	return kid
+}
 
-	hash := sha256.Sum256([]byte(raw))
+func NewKeyHolder(pub *kms.GetPublicKeyOutput, cfg *jwtkms.Config, entry KeyEntry) *KeyHolder {
+	return &KeyHolder{
+		config:      cfg,
+		keyID:       entry.KeyID,
+		alg:         entry.Alg,
+		kid:         entry.Kid,
+		kidStrategy: entry.KidStrategy,
+		PubKey:      pub,
+		UseFrom:     entry.UseFrom,
+		PublishFrom: entry.PublishFrom,
+		RetireAt:    entry.RetireAt,
+		RevokedAt:   entry.RevokedAt,
+		Reason:      entry.Reason,
+		ExpiresAt:   entry.ExpiresAt,
+	}
+}
 
-	// base64url encoding, sem padding
-	encoded := base64.RawURLEncoding.EncodeToString(hash[:])
+// A chave pública veio do KMS ou já conferiu uma assinatura feita por ele
+func (k *KeyHolder) Trusted() bool {
+	return k.cacheCheck == nil || k.cacheCheck.verified.Load()
+}
 
-	// retorna apenas os primeiros 32 caracteres (opcional: reduzir tamanho mantendo unicidade razoável)
-	return encoded[:32]
+// Chave do cache cuja assinatura do KMS não conferiu
+func (k *KeyHolder) Rejected() bool {
+	return k.cacheCheck != nil && k.cacheCheck.failed.Load()
 }
 
-func NewKeyHolder(pub *kms.GetPublicKeyOutput, cfg *jwtkms.Config, entry KeyEntry) *KeyHolder {
-	return &KeyHolder{
-		config:    cfg,
-		keyID:     entry.KeyID,
-		PubKey:    pub,
-		UseFrom:   entry.UseFrom,
-		ExpiresAt: entry.ExpiresAt,
+// Confere a chave do cache com uma assinatura do KMS; sem efeito nas chaves
+// lidas do KMS, já conferidas ou já recusadas
+func (k *KeyHolder) Confirm(ctx context.Context) error {
+	if k.Trusted() || k.Rejected() {
+		return nil
+	}
+	alg, err := k.SigningAlgorithm()
+	if err != nil {
+		return err
 	}
+	return k.cacheCheck.confirm(ctx, alg.KMS)
+}
+
+func (k *KeyHolder) RevokedBy(now time.Time) bool {
+	return !k.RevokedAt.IsZero() && !now.Before(k.RevokedAt)
+}
+
+func (k *KeyHolder) RetiredBy(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// Pode ser escolhida para assinar/cifrar em now
+func (k *KeyHolder) UsableAt(now time.Time) bool {
+	return !k.UseFrom.After(now) && !k.RetiredBy(now) && !k.RevokedBy(now)
+}
+
+// Aparece no JWKS em now
+func (k *KeyHolder) PublishedAt(now time.Time) bool {
+	return !k.PublishFrom.After(now) && k.ExpiresAt.After(now) && !k.RevokedBy(now)
 }
@@ -70,15 +70,24 @@ func TestSigningMethod(t *testing.T) {
 	tests := []struct {
 		name string
 		spec types.KeySpec
+		alg  string
 		want *jwtkms.KMSSigningMethod
 	}{
-		{"RSA2048", types.KeySpecRsa2048, jwtkms.SigningMethodPS256},
-		{"ECC P256", types.KeySpecEccNistP256, jwtkms.SigningMethodECDSA256},
-		{"Unknown", types.KeySpec("Unknown"), nil},
+		{"RSA2048", types.KeySpecRsa2048, "", jwtkms.SigningMethodPS256},
+		{"ECC P256", types.KeySpecEccNistP256, "", jwtkms.SigningMethodECDSA256},
+		{"ECC P384", types.KeySpecEccNistP384, "", jwtkms.SigningMethodECDSA384},
+		{"ECC P521", types.KeySpecEccNistP521, "", jwtkms.SigningMethodECDSA512},
+		{"secp256k1 sem JWS", types.KeySpecEccSecgP256k1, "", nil},
+		{"RSA4096 com RS384", types.KeySpecRsa4096, "RS384", jwtkms.SigningMethodRS384},
+		{"RSA3072 com PS512", types.KeySpecRsa3072, "PS512", jwtkms.SigningMethodPS512},
+		{"P256 com ES384 incompatível", types.KeySpecEccNistP256, "ES384", nil},
+		{"RSA com ES256 incompatível", types.KeySpecRsa2048, "ES256", nil},
+		{"alg desconhecido", types.KeySpecRsa2048, "HS256", nil},
+		{"Unknown", types.KeySpec("Unknown"), "", nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			kw := &KeyHolder{PubKey: &kms.GetPublicKeyOutput{KeySpec: tt.spec}}
+			kw := &KeyHolder{PubKey: &kms.GetPublicKeyOutput{KeySpec: tt.spec}, alg: tt.alg}
 			got := kw.SigningMethod()
 			if got != tt.want {
 				t.Errorf("esperado %v, obtido %v", tt.want, got)
@@ -0,0 +1,302 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoKeySet = errors.New("no key set loaded")
+
+// Snapshot imutável das chaves de uma configuração. Quem obtém um KeySet no
+// início de uma requisição continua com ele mesmo que uma recarga troque o
+// snapshot corrente no meio do caminho.
+//
+// O snapshot raiz corresponde ao nível raiz do YAML e carrega também os
+// issuers de "issuers", cada um com seu próprio KeySet.
+type KeySet struct {
+	name     string // vazio no snapshot raiz
+	issuer   string
+	version  string // versão da configuração que originou o snapshot
+	groups   map[string][]*KeyHolder
+	certs    *CertificateIssuer
+	report   *LoadReport
+	tokens   TokenPolicy
+	profiles map[string]TokenProfile
+	authz    *AuthorizationConfig
+	verify   VerifyPolicy
+	intro    *IntrospectionConfig
+
+	tenants  map[string]*KeySet
+	prefixes map[string]string // prefixo de caminho → nome do issuer
+	hosts    map[string]string // host em minúsculas → nome do issuer
+}
+
+func NewKeySet(issuer string, groups map[string][]*KeyHolder, certs *CertificateIssuer, report *LoadReport) *KeySet {
+	copied := make(map[string][]*KeyHolder, len(groups))
+	for group, keys := range groups {
+		copied[group] = append([]*KeyHolder(nil), keys...)
+	}
+	return &KeySet{issuer: issuer, groups: copied, certs: certs, report: report}
+}
+
+func (s *KeySet) Issuer() string { return s.issuer }
+
+// Versão da configuração (Config.Version) carregada neste snapshot
+func (s *KeySet) Version() string { return s.version }
+
+// Nome do issuer em "issuers"; vazio no snapshot raiz
+func (s *KeySet) Name() string { return s.name }
+
+// KeySet de um issuer de "issuers"; nil se não existir
+func (s *KeySet) Tenant(name string) *KeySet { return s.tenants[name] }
+
+// Escolhe o issuer da requisição: primeiro pelo Host, depois pelo prefixo de
+// caminho mais longo. Retorna o caminho sem o prefixo; sem correspondência,
+// o próprio snapshot e o caminho original.
+func (s *KeySet) Route(host, path string) (*KeySet, string) {
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	if name, ok := s.hosts[strings.ToLower(host)]; ok {
+		return s.tenants[name], path
+	}
+
+	best := ""
+	for prefix := range s.prefixes {
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return s, path
+	}
+	rest := strings.TrimPrefix(path, best)
+	if rest == "" {
+		rest = "/"
+	}
+	return s.tenants[s.prefixes[best]], rest
+}
+
+// Chaves do grupo (jwt, jose ou jwks); o slice não deve ser alterado
+func (s *KeySet) Group(name string) []*KeyHolder { return s.groups[name] }
+
+// Emissor dos certificados x5c; nil quando "certificates" não está no YAML
+func (s *KeySet) Certificates() *CertificateIssuer { return s.certs }
+
+func (s *KeySet) Report() *LoadReport { return s.report }
+
+// Política das claims de /sign-jwt deste issuer
+func (s *KeySet) TokenPolicy() TokenPolicy { return s.tokens }
+
+// Regras de acesso às rotas de assinatura; nil quando não configuradas
+func (s *KeySet) Authorization() *AuthorizationConfig { return s.authz }
+
+// Clientes de /introspect; nil quando não configurados
+func (s *KeySet) Introspection() *IntrospectionConfig { return s.intro }
+
+// Perfil de token_profiles; ClaimError com ErrUnknownProfile se não existir
+func (s *KeySet) Profile(name string) (TokenProfile, error) {
+	profile, ok := s.profiles[name]
+	if !ok {
+		return TokenProfile{}, claimError(ErrUnknownProfile, "", "%q", name)
+	}
+	return profile, nil
+}
+
+// Chave ativa do grupo em now
+func (s *KeySet) Active(group string, now time.Time) *KeyHolder {
+	return GetActiveKey(s.groups[group], now)
+}
+
+// Confere pelo KMS as chaves jwt publicadas em now que vieram do cache, antes
+// de entrarem no JWKS ou na verificação. Cada chave é conferida uma vez; as que
+// falham ficam de fora (GetVisibleAt) até a próxima recarga.
+func (s *KeySet) ConfirmPublished(ctx context.Context, now time.Time) {
+	for _, key := range s.groups["jwt"] {
+		if key.PublishedAt(now) {
+			key.Confirm(ctx)
+		}
+	}
+}
+
+// Algum certificado x5c do snapshot ou dos issuers já deveria ser renovado;
+// a renovação acontece na próxima recarga
+func (s *KeySet) CertificatesDue(now time.Time) bool {
+	if s.certs != nil && s.certs.RenewalDue(now) {
+		return true
+	}
+	for _, tenant := range s.tenants {
+		if tenant.CertificatesDue(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Saúde do snapshot e, no raiz, de cada issuer de "issuers"; o status geral é
+// o pior entre eles
+func (s *KeySet) Health(now time.Time) Health {
+	if s.report == nil {
+		return Health{Status: HealthUnavailable}
+	}
+	health := s.report.Health(s.groups, now)
+	health.ConfigVersion = s.version
+	for name, tenant := range s.tenants {
+		if health.Issuers == nil {
+			health.Issuers = map[string]Health{}
+		}
+		th := tenant.Health(now)
+		health.Issuers[name] = th
+		if healthRank[th.Status] > healthRank[health.Status] {
+			health.Status = th.Status
+		}
+	}
+	return health
+}
+
+var healthRank = map[string]int{HealthOK: 0, HealthDegraded: 1, HealthUnavailable: 2}
+
+// Carrega as chaves do nível raiz e de cada issuer de "issuers" e monta o
+// snapshot. Só falhas de chaves necessárias impedem a criação; o relatório de
+// cada issuer fica disponível em Report
+func (l *KeyLoader) LoadKeySet(ctx context.Context, cfg *Config) (*KeySet, error) {
+	root, err := l.loadIssuer(ctx, "", cfg)
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, name := range cfg.IssuerNames() {
+		tenant, err := l.loadIssuer(ctx, name, cfg.Issuers[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", name, err))
+			continue
+		}
+		if root == nil {
+			continue
+		}
+		if root.tenants == nil {
+			root.tenants, root.prefixes, root.hosts = map[string]*KeySet{}, map[string]string{}, map[string]string{}
+		}
+		root.tenants[name] = tenant
+		root.prefixes[cfg.RoutePrefix(name)] = name
+		for _, host := range cfg.Issuers[name].Hosts {
+			root.hosts[strings.ToLower(host)] = name
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return root, nil
+}
+
+func (l *KeyLoader) loadIssuer(ctx context.Context, name string, cfg *Config) (*KeySet, error) {
+	groups, report, err := l.Load(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var certs *CertificateIssuer
+	if cfg.Certificates != nil {
+		certs = NewCertificateIssuer(l.client, *cfg.Certificates, l.clock).WithCache(l.certs)
+		entries := certificateEntries(groups, l.clock.Now())
+		if _, err := l.withRetry(ctx, func() error { return certs.Prepare(ctx, entries) }); err != nil {
+			return nil, fmt.Errorf("certificados: %w", err)
+		}
+	}
+	set := NewKeySet(cfg.Issuer, groups, certs, report)
+	set.name = name
+	set.version = cfg.Version
+	set.tokens, set.profiles, set.authz = cfg.TokenPolicy, cfg.Profiles, cfg.Authorization
+	set.verify, set.intro = cfg.VerifyPolicy, cfg.Introspection
+	return set, nil
+}
+
+// Chaves que podem entrar no JWKS durante a vida do snapshot: as de
+// assinatura do jwt e as de cifragem do jose ainda não expiradas nem revogadas
+func certificateEntries(groups map[string][]*KeyHolder, now time.Time) []*JWKSEntry {
+	var entries []*JWKSEntry
+	for _, group := range []string{"jwt", "jose"} {
+		for _, key := range groups[group] {
+			if key.ExpiresAt.After(now) && !key.RevokedBy(now) {
+				entries = append(entries, NewJWKSEntry(key, GroupUses[group]))
+			}
+		}
+	}
+	return entries
+}
+
+// Guarda o KeySet corrente e o troca atomicamente a cada recarga. Uma recarga
+// que falha mantém o snapshot anterior.
+type KeyStore struct {
+	current atomic.Value // *KeySet
+	load    func(ctx context.Context) (*KeySet, error)
+	ttl     time.Duration
+	clock   Clock
+
+	mu        sync.Mutex // serializa recargas
+	loadedAt  time.Time
+	lastError error
+}
+
+// ttl zero desativa a recarga por idade (ReloadIfStale)
+func NewKeyStore(load func(ctx context.Context) (*KeySet, error), ttl time.Duration, clock Clock) *KeyStore {
+	return &KeyStore{load: load, ttl: ttl, clock: clock}
+}
+
+// Snapshot corrente; nil antes do primeiro carregamento
+func (s *KeyStore) Current() *KeySet {
+	set, _ := s.current.Load().(*KeySet)
+	return set
+}
+
+// Substitui o snapshot diretamente, sem passar pelo carregamento
+func (s *KeyStore) Store(set *KeySet) {
+	s.current.Store(set)
+}
+
+func (s *KeyStore) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reload(ctx)
+}
+
+// Recarrega se o snapshot passou do ttl. Se outra recarga já está em curso,
+// segue com o snapshot atual em vez de esperar.
+func (s *KeyStore) ReloadIfStale(ctx context.Context) error {
+	if s.ttl <= 0 || !s.mu.TryLock() {
+		return nil
+	}
+	defer s.mu.Unlock()
+	if s.clock.Now().Sub(s.loadedAt) < s.ttl {
+		return nil
+	}
+	return s.reload(ctx)
+}
+
+func (s *KeyStore) reload(ctx context.Context) error {
+	if s.load == nil {
+		return ErrNoKeySet
+	}
+	// Tentativas que falham também contam para o ttl, para não refazer o
+	// carregamento a cada invocação enquanto o KMS estiver fora
+	s.loadedAt = s.clock.Now()
+	set, err := s.load(ctx)
+	s.lastError = err
+	if err != nil {
+		return err
+	}
+	s.current.Store(set)
+	return nil
+}
+
+// Erro da última recarga; nil se ela teve sucesso
+func (s *KeyStore) LastError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastError
+}
@@ -0,0 +1,125 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func TestKeyStore_Reload(t *testing.T) {
+	clock := MockClock(mustParse(t, "2025-03-01T00:00:00Z"))
+	var version int
+	var failNext bool
+	store := NewKeyStore(func(ctx context.Context) (*KeySet, error) {
+		if failNext {
+			return nil, errors.New("falha simulada")
+		}
+		version++
+		return NewKeySet(fmt.Sprintf("https://v%d.example", version), nil, nil, nil), nil
+	}, 10*time.Minute, clock)
+	ctx := context.Background()
+
+	if store.Current() != nil {
+		t.Fatal("esperado nenhum snapshot antes do primeiro carregamento")
+	}
+	if err := store.Reload(ctx); err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	inFlight := store.Current()
+
+	clock.Add(5 * time.Minute)
+	store.ReloadIfStale(ctx)
+	if store.Current() != inFlight {
+		t.Error("snapshot dentro do ttl não deveria ser recarregado")
+	}
+
+	clock.Add(6 * time.Minute)
+	store.ReloadIfStale(ctx)
+	if got := store.Current().Issuer(); got != "https://v2.example" {
+		t.Errorf("esperado snapshot recarregado após o ttl, obtido %s", got)
+	}
+	if inFlight.Issuer() != "https://v1.example" {
+		t.Error("snapshot obtido antes da recarga não deveria mudar")
+	}
+
+	failNext = true
+	clock.Add(11 * time.Minute)
+	if err := store.ReloadIfStale(ctx); err == nil {
+		t.Fatal("esperado erro da recarga")
+	}
+	if got := store.Current().Issuer(); got != "https://v2.example" {
+		t.Errorf("recarga com falha deveria manter o snapshot anterior, obtido %s", got)
+	}
+	if store.LastError() == nil {
+		t.Error("esperado erro da última recarga")
+	}
+}
+
+func TestKeyStore_LeiturasConcorrentes(t *testing.T) {
+	store := NewKeyStore(func(ctx context.Context) (*KeySet, error) {
+		return NewKeySet("https://issuer.example", map[string][]*KeyHolder{"jwt": {{keyID: "k"}}}, nil, nil), nil
+	}, 0, ReealClock())
+	ctx := context.Background()
+	store.Reload(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.Reload(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			if set := store.Current(); set == nil || len(set.Group("jwt")) != 1 {
+				t.Error("leitura concorrente deveria ver um snapshot completo")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestKeySet_Route(t *testing.T) {
+	conf := &Config{
+		Keys: map[string][]KeyEntry{"jwt": {{KeyID: "alias/raiz", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}}},
+		Issuers: map[string]*Config{
+			"a":     {Issuer: "a.ca.internal", Keys: map[string][]KeyEntry{"jwt": {{KeyID: "alias/a", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}}}},
+			"a-stg": {Issuer: "stg.ca.internal", PathPrefix: "/a/stg", Hosts: []string{"stg.ca.internal"}},
+		},
+	}
+	root, err := newTestLoader(softkms.New(), mustParse(t, "2025-03-01T00:00:00Z")).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+
+	tests := []struct {
+		host, path string
+		wantName   string
+		wantPath   string
+	}{
+		{"ca.internal", "/.well-known/jwks.json", "", "/.well-known/jwks.json"},
+		{"ca.internal", "/a/.well-known/jwks.json", "a", "/.well-known/jwks.json"},
+		{"ca.internal", "/a/stg/sign-jwt", "a-stg", "/sign-jwt"},
+		{"ca.internal", "/ab/sign-jwt", "", "/ab/sign-jwt"},
+		{"STG.ca.internal:8080", "/sign-jwt", "a-stg", "/sign-jwt"},
+		{"ca.internal", "/a", "a", "/"},
+	}
+	for _, tt := range tests {
+		set, path := root.Route(tt.host, tt.path)
+		if set.Name() != tt.wantName || path != tt.wantPath {
+			t.Errorf("%s%s: esperado %q %s, obtido %q %s", tt.host, tt.path, tt.wantName, tt.wantPath, set.Name(), path)
+		}
+	}
+
+	if got := root.Tenant("a").Active("jwt", mustParse(t, "2025-03-01T00:00:00Z")); got == nil || got.keyID != "alias/a" {
+		t.Errorf("issuer a deveria usar as próprias chaves, obtido %v", got)
+	}
+	if health := root.Health(mustParse(t, "2025-03-01T00:00:00Z")); len(health.Issuers) != 2 {
+		t.Errorf("esperado saúde de 2 issuers, obtido %v", health.Issuers)
+	}
+}
@@ -0,0 +1,93 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Estratégia de derivação do kid publicado no JWKS e nos headers dos JWTs
+type KidStrategy string
+
+const (
+	// RFC 7638: SHA-256 da representação canônica do JWK, recomputável por terceiros
+	KidStrategyThumbprint KidStrategy = "thumbprint"
+	// kid informado na entrada do YAML
+	KidStrategyExplicit KidStrategy = "explicit"
+	// SHA-256 do KeyId do KMS truncado em 32 caracteres (comportamento original)
+	KidStrategyLegacy KidStrategy = "legacy"
+)
+
+// Calcula o kid da chave conforme a estratégia configurada
+func (k *KeyHolder) ResolveKid() (string, error) {
+	strategy := k.kidStrategy
+	if strategy == "" {
+		strategy = KidStrategyLegacy
+		if k.kid != "" {
+			strategy = KidStrategyExplicit
+		}
+	}
+
+	switch strategy {
+	case KidStrategyThumbprint:
+		return Thumbprint(k.PubKey.PublicKey)
+	case KidStrategyExplicit:
+		if k.kid == "" {
+			return "", fmt.Errorf("chave %s: kid_strategy explicit exige o campo kid", k.keyID)
+		}
+		return k.kid, nil
+	case KidStrategyLegacy:
+		return legacyKid(*k.PubKey.KeyId), nil
+	default:
+		return "", fmt.Errorf("kid_strategy desconhecida: %s", strategy)
+	}
+}
+
+func legacyKid(keyID string) string {
+	hash := sha256.Sum256([]byte(keyID))
+
+	// base64url encoding, sem padding
+	encoded := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	// retorna apenas os primeiros 32 caracteres (opcional: reduzir tamanho mantendo unicidade razoável)
+	return encoded[:32]
+}
+
+// JWK thumbprint (RFC 7638) da chave pública DER, em base64url sem padding
+func Thumbprint(der []byte) (string, error) {
+	pubKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	// Membros obrigatórios em ordem lexicográfica, sem espaços
+	var canonical []byte
+	switch pub := pubKey.(type) {
+	case *rsa.PublicKey:
+		canonical, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{base64urlInt(pub.E), "RSA", base64urlUInt(pub.N)})
+	case *ecdsa.PublicKey:
+		size := coordinateSize(pub)
+		canonical, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{pub.Curve.Params().Name, "EC", base64urlCoord(pub.X, size), base64urlCoord(pub.Y, size)})
+	default:
+		return "", ErrConfiguredKeyNotSupported
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
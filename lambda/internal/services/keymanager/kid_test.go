@@ -0,0 +1,93 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+func TestThumbprint_RFC7638(t *testing.T) {
+	// Exemplo da seção 3.1 da RFC 7638
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	der, err := x509.MarshalPKIXPublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if err != nil {
+		t.Fatalf("erro ao serializar chave: %v", err)
+	}
+
+	got, err := Thumbprint(der)
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint inesperado: %s", got)
+	}
+}
+
+func TestResolveKid_Strategies(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	thumb, _ := Thumbprint(der)
+
+	byAlias := "alias/jwt-signer"
+	byARN := "arn:aws:kms:us-east-1:123456789012:key/abcd-1234"
+
+	tests := []struct {
+		name     string
+		keyID    string
+		kid      string
+		strategy KidStrategy
+		want     string
+		wantErr  bool
+	}{
+		{"thumbprint via alias", byAlias, "", KidStrategyThumbprint, thumb, false},
+		{"thumbprint via ARN", byARN, "", KidStrategyThumbprint, thumb, false},
+		{"explicit", byARN, "signer-2025", KidStrategyExplicit, "signer-2025", false},
+		{"kid sem estratégia implica explicit", byARN, "signer-2025", "", "signer-2025", false},
+		{"explicit sem kid", byARN, "", KidStrategyExplicit, "", true},
+		{"legacy", byARN, "", KidStrategyLegacy, legacyKid(byARN), false},
+		{"padrão é legacy", byARN, "", "", legacyKid(byARN), false},
+		{"estratégia desconhecida", byARN, "", KidStrategy("uuid"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyID := tt.keyID
+			kw := NewKeyHolder(&kms.GetPublicKeyOutput{KeyId: &keyID, PublicKey: der}, nil, KeyEntry{
+				KeyID:       tt.keyID,
+				Kid:         tt.kid,
+				KidStrategy: tt.strategy,
+			})
+			got, err := kw.ResolveKid()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("esperado erro=%v, obtido %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("esperado kid %s, obtido %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigGroupEntries_AplicaKidStrategy(t *testing.T) {
+	cfg := &Config{
+		KidStrategy: KidStrategyThumbprint,
+		Keys: map[string][]KeyEntry{"jwt": {
+			{KeyID: "k1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+			{KeyID: "k2", Kid: "fixo", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")},
+			{KeyID: "k3", KidStrategy: KidStrategyLegacy, UseFrom: mustParse(t, "2026-01-01T00:00:00Z")},
+		}},
+	}
+	entries := cfg.GroupEntries("jwt")
+	want := []KidStrategy{KidStrategyThumbprint, "", KidStrategyLegacy}
+	for i, w := range want {
+		if entries[i].KidStrategy != w {
+			t.Errorf("entrada %s: esperado %q, obtido %q", entries[i].KeyID, w, entries[i].KidStrategy)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+// Tentativas das chamadas ao KMS no carregamento, com backoff exponencial e
+// jitter total (espera aleatória entre zero e o teto da tentativa)
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	ceiling := p.BaseDelay << attempt
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Erros que não mudam com novas tentativas
+func isRetryable(err error) bool {
+	var (
+		notFound     *types.NotFoundException
+		disabled     *types.DisabledException
+		invalidState *types.KMSInvalidStateException
+		invalidArn   *types.InvalidArnException
+		usage        *types.InvalidKeyUsageException
+	)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrCachedKeyMismatch):
+		return false
+	case errors.As(err, &notFound), errors.As(err, &disabled), errors.As(err, &invalidState),
+		errors.As(err, &invalidArn), errors.As(err, &usage):
+		return false
+	}
+	return true
+}
+
+// Resultado do carregamento de uma entrada do YAML
+type KeyLoadStatus struct {
+	Group     string    `json:"group"`
+	KeyID     string    `json:"key_id"`
+	Loaded    bool      `json:"loaded"`
+	FromCache bool      `json:"from_cache,omitempty"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	UseFrom   time.Time `json:"use_from"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+}
+
+// Uma chave é necessária enquanto pode assinar ou ser publicada: falhas de
+// chaves futuras, expiradas ou revogadas não impedem a inicialização
+func (s KeyLoadStatus) RequiredAt(now time.Time) bool {
+	revoked := !s.RevokedAt.IsZero() && !now.Before(s.RevokedAt)
+	return !s.UseFrom.After(now) && s.ExpiresAt.After(now) && !revoked
+}
+
+type LoadReport struct {
+	LoadedAt time.Time       `json:"loaded_at"`
+	Keys     []KeyLoadStatus `json:"keys"`
+}
+
+// Chaves carregadas em paralelo no máximo
+const loadConcurrency = 8
+
+// Carrega as chaves dos grupos com retentativas, registrando o estado de cada uma
+type KeyLoader struct {
+	client   KeyClient
+	retry    RetryPolicy
+	clock    Clock
+	cache    PublicKeyCache
+	maxAge   time.Duration
+	certs    CertificateCache
+	failover FailoverConfig
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+func NewKeyLoader(client KeyClient, retry RetryPolicy, clock Clock) *KeyLoader {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 1
+	}
+	return &KeyLoader{client: client, retry: retry, clock: clock, maxAge: DefaultPublicKeyCacheMaxAge, sleep: sleepContext}
+}
+
+// Usa o cache para evitar GetPublicKey e DescribeKey nas chaves de assinatura.
+// Chaves de cifragem sempre vêm do KMS: sem assinatura não há como conferir o cache.
+func (l *KeyLoader) WithCache(cache PublicKeyCache) *KeyLoader {
+	l.cache = cache
+	return l
+}
+
+// Idade máxima das entradas do cache; zero mantém DefaultPublicKeyCacheMaxAge
+func (l *KeyLoader) WithCacheMaxAge(maxAge time.Duration) *KeyLoader {
+	if maxAge > 0 {
+		l.maxAge = maxAge
+	}
+	return l
+}
+
+// Certificados do x5c reaproveitados entre carregamentos; sem cache, cada
+// KeySet emite os seus e x5c muda a cada recarga
+func (l *KeyLoader) WithCertificateCache(cache CertificateCache) *KeyLoader {
+	l.certs = cache
+	return l
+}
+
+// Assinaturas de entradas com "replicas" passam a ir para as réplicas quando a
+// chave principal falha; sem Clients, "replicas" é ignorado
+func (l *KeyLoader) WithFailover(failover FailoverConfig) *KeyLoader {
+	l.failover = failover
+	return l
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Carrega e valida todos os grupos em paralelo. Só falhas de chaves necessárias
+// agora entram no *KeyValidationError; as demais ficam registradas no relatório.
+func (l *KeyLoader) Load(ctx context.Context, cfg *Config) (map[string][]*KeyHolder, *LoadReport, error) {
+	now := l.clock.Now()
+
+	type job struct {
+		group string
+		entry KeyEntry
+	}
+	type result struct {
+		key      *KeyHolder
+		status   KeyLoadStatus
+		problems []KeyProblem
+	}
+	var jobs []job
+	for _, group := range Groups {
+		for _, entry := range cfg.GroupEntries(group) {
+			jobs = append(jobs, job{group, entry})
+		}
+	}
+
+	// Resultados indexados pela posição no YAML, para manter a ordem dos grupos
+	results := make([]result, len(jobs))
+	slots := make(chan struct{}, loadConcurrency)
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j job) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			key, status, problems := l.loadKey(ctx, j.group, j.entry)
+			results[i] = result{key, status, problems}
+		}(i, j)
+	}
+	wg.Wait()
+
+	report := &LoadReport{LoadedAt: now}
+	groups := map[string][]*KeyHolder{}
+	var problems []KeyProblem
+	for i, r := range results {
+		status := r.status
+		status.Loaded = len(r.problems) == 0
+		if status.Loaded {
+			groups[jobs[i].group] = append(groups[jobs[i].group], r.key)
+		} else {
+			status.Error = newValidationError(r.problems).Error()
+			if status.RequiredAt(now) {
+				problems = append(problems, r.problems...)
+			}
+		}
+		report.Keys = append(report.Keys, status)
+	}
+	return groups, report, newValidationError(problems)
+}
+
+func (l *KeyLoader) loadKey(ctx context.Context, group string, entry KeyEntry) (*KeyHolder, KeyLoadStatus, []KeyProblem) {
+	status := KeyLoadStatus{
+		Group:     group,
+		KeyID:     entry.KeyID,
+		UseFrom:   entry.UseFrom,
+		ExpiresAt: entry.ExpiresAt,
+		RevokedAt: entry.RevokedAt,
+	}
+	problem := func(check string, err error) []KeyProblem {
+		return []KeyProblem{{Group: group, KeyID: entry.KeyID, Check: check, Err: err}}
+	}
+
+	var signingClient jwtkms.KMSClient = l.client
+	// Entrada recente do cache: nenhuma chamada ao KMS até a primeira assinatura
+	pubKey, md, checked := l.cachedPublicKey(ctx, group, entry)
+	if pubKey != nil {
+		status.FromCache = true
+		signingClient = checked
+	} else {
+		attempts, err := l.withRetry(ctx, func() (err error) {
+			pubKey, err = l.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(entry.KeyID)})
+			return err
+		})
+		status.Attempts += attempts
+		if err != nil {
+			return nil, status, problem("get_public_key", err)
+		}
+
+		var described *kms.DescribeKeyOutput
+		attempts, err = l.withRetry(ctx, func() (err error) {
+			described, err = l.client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(entry.KeyID)})
+			return err
+		})
+		status.Attempts += attempts
+		if err != nil {
+			return nil, status, problem("describe_key", err)
+		}
+		if described.KeyMetadata == nil {
+			return nil, status, problem("describe_key", ErrKeyMetadataMissing)
+		}
+		md = described.KeyMetadata
+	}
+
+	if len(entry.Replicas) > 0 && l.failover.Clients != nil {
+		wrapped, err := l.failover.wrap(signingClient, entry)
+		if err != nil {
+			return nil, status, problem("replicas", err)
+		}
+		signingClient = wrapped
+	}
+
+	key := NewKeyHolder(pubKey, jwtkms.NewKMSConfig(signingClient, entry.KeyID, false), entry)
+	key.cacheCheck = checked
+	problems := ValidateKey(group, key, md)
+	if _, err := key.ResolveKid(); err != nil {
+		problems = append(problems, problem("kid", err)...)
+	}
+	if len(problems) == 0 && l.cache != nil && !status.FromCache && GroupUses[group] == "sig" {
+		// Falha ao gravar só custa um GetPublicKey no próximo cold start
+		l.cache.Put(ctx, NewCachedPublicKey(entry.KeyID, pubKey, md, l.clock.Now()))
+	}
+	return key, status, problems
+}
+
+// Chave pública e metadados do cache e o cliente que confere a primeira
+// assinatura contra ela; nil quando não há cache, a chave não é de assinatura
+// ou a entrada é antiga ou inválida
+func (l *KeyLoader) cachedPublicKey(ctx context.Context, group string, entry KeyEntry) (*kms.GetPublicKeyOutput, *types.KeyMetadata, *cacheCheckClient) {
+	if l.cache == nil || GroupUses[group] != "sig" {
+		return nil, nil, nil
+	}
+	cached, err := l.cache.Get(ctx, entry.KeyID)
+	if err != nil || !cached.FreshAt(l.clock.Now(), l.maxAge) {
+		return nil, nil, nil
+	}
+	checked, err := newCacheCheckClient(l.client, l.cache, cached)
+	if err != nil {
+		l.cache.Delete(ctx, entry.KeyID)
+		return nil, nil, nil
+	}
+	return cached.Output(), cached.Metadata(), checked
+}
+
+// Executa fn até MaxAttempts vezes; retorna o número de chamadas feitas
+func (l *KeyLoader) withRetry(ctx context.Context, fn func() error) (int, error) {
+	var err error
+	for attempt := 0; attempt < l.retry.MaxAttempts; attempt++ {
+		if err = fn(); err == nil || !isRetryable(err) {
+			return attempt + 1, err
+		}
+		if attempt == l.retry.MaxAttempts-1 {
+			break
+		}
+		if sleepErr := l.sleep(ctx, l.retry.delay(attempt)); sleepErr != nil {
+			return attempt + 1, err
+		}
+	}
+	return l.retry.MaxAttempts, err
+}
+
+// Carrega com a política padrão e sem relatório, para quem só precisa das chaves
+func LoadKeyGroups(ctx context.Context, client KeyClient, cfg *Config) (map[string][]*KeyHolder, error) {
+	groups, _, err := NewKeyLoader(client, DefaultRetryPolicy, ReealClock()).Load(ctx, cfg)
+	return groups, err
+}
+
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// Estado das chaves; /health publica só Status e registra o resto no log
+type Health struct {
+	Status   string            `json:"status"`
+	Groups   map[string]string `json:"groups"` // kid da chave ativa de cada grupo, vazio se não houver
+	LoadedAt time.Time         `json:"loaded_at"`
+	Keys     []KeyLoadStatus   `json:"keys"`
+
+	ConfigVersion    string            `json:"config_version,omitempty"`
+	SigningFailovers []FailoverCount   `json:"signing_failovers,omitempty"` // desde o cold start
+	ReloadError      string            `json:"reload_error,omitempty"`      // última recarga falhou; o snapshot anterior segue em uso
+	Issuers          map[string]Health `json:"issuers,omitempty"`           // issuers de "issuers", no snapshot raiz
+}
+
+// Avalia o carregamento em now: indisponível se algum grupo configurado está sem
+// chave ativa ou se uma chave que falhou passou a ser necessária; degradado se
+// só falharam chaves que ainda não são usadas
+func (r *LoadReport) Health(groups map[string][]*KeyHolder, now time.Time) Health {
+	health := Health{Status: HealthOK, Groups: map[string]string{}, LoadedAt: r.LoadedAt, Keys: r.Keys}
+	configured := map[string]bool{}
+	for _, status := range r.Keys {
+		configured[status.Group] = true
+		if status.Loaded {
+			continue
+		}
+		if status.RequiredAt(now) {
+			health.Status = HealthUnavailable
+		} else if health.Status == HealthOK {
+			health.Status = HealthDegraded
+		}
+	}
+	for _, group := range Groups {
+		if !configured[group] {
+			continue
+		}
+		active := GetActiveKey(groups[group], now)
+		if active == nil {
+			health.Status = HealthUnavailable
+			health.Groups[group] = ""
+			continue
+		}
+		health.Groups[group] = active.Kid()
+	}
+	// Chave do cache recusada pelo KMS: a próxima recarga a lê de novo do KMS
+	for _, keys := range groups {
+		for _, key := range keys {
+			if key.Rejected() && health.Status == HealthOK {
+				health.Status = HealthDegraded
+			}
+		}
+	}
+	return health
+}
@@ -0,0 +1,149 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+// Cliente que falha as primeiras chamadas de GetPublicKey de cada chave
+type flakyClient struct {
+	*softkms.Client
+	failures map[string]int
+	err      error
+	calls    map[string]int
+	mu       sync.Mutex
+}
+
+func (c *flakyClient) GetPublicKey(ctx context.Context, in *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	keyID := aws.ToString(in.KeyId)
+	c.mu.Lock()
+	c.calls[keyID]++
+	fail := c.calls[keyID] <= c.failures[keyID]
+	c.mu.Unlock()
+	if fail {
+		return nil, c.err
+	}
+	return c.Client.GetPublicKey(ctx, in, optFns...)
+}
+
+func newTestLoader(client KeyClient, now time.Time) *KeyLoader {
+	loader := NewKeyLoader(client, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, MockClock(now))
+	loader.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return loader
+}
+
+func TestKeyLoader_Load(t *testing.T) {
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	conf := &Config{Keys: map[string][]KeyEntry{
+		"jwt":  {{KeyID: "alias/atual", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}, {KeyID: "alias/futura", UseFrom: mustParse(t, "2025-06-01T00:00:00Z")}},
+		"jwks": {{KeyID: "alias/jwks", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}},
+	}}
+	throttled := &types.KMSInternalException{Message: aws.String("throttled")}
+
+	tests := []struct {
+		name         string
+		failures     map[string]int
+		err          error
+		wantErrKeys  []string
+		wantLoaded   map[string]bool
+		wantAttempts map[string]int
+		wantHealth   string
+	}{
+		{
+			name:         "falha transitória é repetida",
+			failures:     map[string]int{"alias/atual": 2},
+			err:          throttled,
+			wantLoaded:   map[string]bool{"alias/atual": true, "alias/futura": true, "alias/jwks": true},
+			wantAttempts: map[string]int{"alias/atual": 4},
+			wantHealth:   HealthOK,
+		},
+		{
+			name:         "chave futura pode falhar",
+			failures:     map[string]int{"alias/futura": 10},
+			err:          throttled,
+			wantLoaded:   map[string]bool{"alias/atual": true, "alias/futura": false, "alias/jwks": true},
+			wantAttempts: map[string]int{"alias/futura": 3},
+			wantHealth:   HealthDegraded,
+		},
+		{
+			name:         "chave necessária impede o carregamento",
+			failures:     map[string]int{"alias/atual": 10},
+			err:          throttled,
+			wantErrKeys:  []string{"alias/atual"},
+			wantLoaded:   map[string]bool{"alias/atual": false},
+			wantAttempts: map[string]int{"alias/atual": 3},
+			wantHealth:   HealthUnavailable,
+		},
+		{
+			name:         "erro definitivo não é repetido",
+			failures:     map[string]int{"alias/futura": 10},
+			err:          &types.NotFoundException{Message: aws.String("not found")},
+			wantLoaded:   map[string]bool{"alias/futura": false},
+			wantAttempts: map[string]int{"alias/futura": 1},
+			wantHealth:   HealthDegraded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &flakyClient{Client: softkms.New(), failures: tt.failures, err: tt.err, calls: map[string]int{}}
+			groups, report, err := newTestLoader(client, now).Load(context.Background(), conf)
+
+			var verr *KeyValidationError
+			if len(tt.wantErrKeys) == 0 && err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if len(tt.wantErrKeys) > 0 {
+				if !errors.As(err, &verr) || len(verr.Problems) != len(tt.wantErrKeys) || verr.Problems[0].KeyID != tt.wantErrKeys[0] {
+					t.Fatalf("esperado erro para %v, obtido %v", tt.wantErrKeys, err)
+				}
+			}
+
+			statuses := map[string]KeyLoadStatus{}
+			for _, s := range report.Keys {
+				statuses[s.KeyID] = s
+			}
+			for keyID, loaded := range tt.wantLoaded {
+				if statuses[keyID].Loaded != loaded {
+					t.Errorf("%s: esperado loaded=%v, obtido %+v", keyID, loaded, statuses[keyID])
+				}
+			}
+			for keyID, attempts := range tt.wantAttempts {
+				if statuses[keyID].Attempts != attempts {
+					t.Errorf("%s: esperado %d tentativas, obtido %d", keyID, attempts, statuses[keyID].Attempts)
+				}
+			}
+			if got := report.Health(groups, now).Status; got != tt.wantHealth {
+				t.Errorf("esperado health %s, obtido %s", tt.wantHealth, got)
+			}
+		})
+	}
+}
+
+func TestLoadReport_HealthQuandoChaveFuturaVence(t *testing.T) {
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	conf := &Config{Keys: map[string][]KeyEntry{
+		"jwt": {{KeyID: "alias/atual", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}, {KeyID: "alias/futura", UseFrom: mustParse(t, "2025-06-01T00:00:00Z")}},
+	}}
+	client := &flakyClient{Client: softkms.New(), failures: map[string]int{"alias/futura": 10}, err: errors.New("falha simulada"), calls: map[string]int{}}
+
+	groups, report, err := newTestLoader(client, now).Load(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if got := report.Health(groups, now).Status; got != HealthDegraded {
+		t.Errorf("antes do use_from: esperado %s, obtido %s", HealthDegraded, got)
+	}
+	if got := report.Health(groups, mustParse(t, "2025-06-02T00:00:00Z")).Status; got != HealthUnavailable {
+		t.Errorf("depois do use_from: esperado %s, obtido %s", HealthUnavailable, got)
+	}
+}
@@ -0,0 +1,180 @@
+package keymanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownProfile      = errors.New("unknown token profile")
+	ErrUnknownClaim        = errors.New("claim not declared in profile")
+	ErrMissingClaim        = errors.New("required claim missing")
+	ErrClaimType           = errors.New("claim has wrong type")
+	ErrInvalidTokenProfile = errors.New("invalid token profile")
+)
+
+// Tipos aceitos em token_profiles.<nome>.claims.<claim>.type
+var claimTypes = []string{"string", "number", "integer", "boolean", "array", "object"}
+
+// Claim declarada num perfil
+type ClaimSpec struct {
+	Type     string `yaml:"type"`
+	Required bool   `yaml:"required"`
+}
+
+// Formato de token emitido por /sign-jwt?profile=<nome>. O chamador só envia as
+// claims declaradas; aud, exp e o header typ vêm do perfil.
+type TokenProfile struct {
+	Lifetime time.Duration        `yaml:"lifetime"` // exp = iat + lifetime; padrão: default_lifetime da token_policy
+	Audience []string             `yaml:"audience"` // aud do token; o chamador pode pedir um subconjunto
+	Claims   map[string]ClaimSpec `yaml:"claims"`
+	Type     string               `yaml:"typ"` // header typ, ex.: at+jwt; padrão JWT
+}
+
+// Política efetiva: lifetime do perfil fixa o exp padrão e o máximo, e a
+// audiência do perfil substitui a lista da política
+func (p TokenProfile) policy(base TokenPolicy) TokenPolicy {
+	base = base.withDefaults()
+	if p.Lifetime > 0 {
+		base.DefaultLifetime, base.MaxLifetime = p.Lifetime, p.Lifetime
+	}
+	if len(p.Audience) > 0 {
+		base.Audiences = p.Audience
+	}
+	return base
+}
+
+// Lê o corpo, confere as claims contra o perfil e completa as do servidor
+func (p TokenProfile) BuildClaims(base TokenPolicy, issuer string, payload []byte, now time.Time) (jwt.MapClaims, error) {
+	policy := p.policy(base)
+	claims, err := policy.ParseClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "aud" || slices.Contains(ReservedClaims, name) {
+			continue // conferidas por TokenPolicy.Apply
+		}
+		spec, ok := p.Claims[name]
+		if !ok {
+			return nil, claimError(ErrUnknownClaim, name, "não declarada no perfil")
+		}
+		if !hasClaimType(claims[name], spec.Type) {
+			return nil, claimError(ErrClaimType, name, "esperado %s", spec.Type)
+		}
+	}
+	required := make([]string, 0, len(p.Claims))
+	for name, spec := range p.Claims {
+		if _, ok := claims[name]; spec.Required && !ok {
+			required = append(required, name)
+		}
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		return nil, claimError(ErrMissingClaim, required[0], "obrigatória no perfil")
+	}
+
+	claims, err = policy.Apply(issuer, claims, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["aud"]; !ok && len(p.Audience) > 0 {
+		claims["aud"] = jwt.ClaimStrings(p.Audience)
+	}
+	return claims, nil
+}
+
+// Confere o tipo de um valor decodificado com UseNumber
+func hasClaimType(value interface{}, claimType string) bool {
+	switch claimType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		if _, err := n.Int64(); err == nil {
+			return true
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return false
+}
+
+func (p TokenProfile) validate(policy TokenPolicy) error {
+	policy = policy.withDefaults()
+	var errs []error
+	if p.Lifetime < 0 || p.Lifetime > policy.MaxLifetime {
+		errs = append(errs, fmt.Errorf("lifetime %s deve estar entre 0 e max_lifetime (%s)", p.Lifetime, policy.MaxLifetime))
+	}
+	if len(policy.Audiences) > 0 {
+		for _, aud := range p.Audience {
+			if !slices.Contains(policy.Audiences, aud) {
+				errs = append(errs, fmt.Errorf("audience %q fora de token_policy.audiences", aud))
+			}
+		}
+	}
+	for name, spec := range p.Claims {
+		if name == "aud" || slices.Contains(ReservedClaims, name) {
+			errs = append(errs, fmt.Errorf("claim %s é reservada", name))
+		}
+		if !slices.Contains(claimTypes, spec.Type) {
+			errs = append(errs, fmt.Errorf("claim %s: tipo %q desconhecido", name, spec.Type))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Valida os token_profiles do nível raiz e de cada issuer
+func (c *Config) validateProfiles() error {
+	var errs []error
+	check := func(prefix string, cfg *Config) {
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if name == DefaultProfile {
+				errs = append(errs, fmt.Errorf("%w: %s%s: nome reservado para a token_policy", ErrInvalidTokenProfile, prefix, name))
+				continue
+			}
+			if err := cfg.Profiles[name].validate(cfg.TokenPolicy); err != nil {
+				errs = append(errs, fmt.Errorf("%w: %s%s: %w", ErrInvalidTokenProfile, prefix, name, err))
+			}
+		}
+	}
+	check("", c)
+	for _, name := range c.IssuerNames() {
+		check("issuer "+name+": ", c.Issuers[name])
+	}
+	return errors.Join(errs...)
+}
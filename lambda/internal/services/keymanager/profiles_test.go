@@ -0,0 +1,121 @@
+package keymanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenProfile_BuildClaims(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	base := TokenPolicy{Audiences: []string{"api.interna", "parceiros"}}
+	profile := TokenProfile{
+		Lifetime: 5 * time.Minute,
+		Audience: []string{"api.interna"},
+		Claims: map[string]ClaimSpec{
+			"sub":    {Type: "string", Required: true},
+			"scope":  {Type: "array"},
+			"nivel":  {Type: "integer"},
+			"admin":  {Type: "boolean"},
+			"perfil": {Type: "object"},
+		},
+		Type: "at+jwt",
+	}
+
+	tests := []struct {
+		name     string
+		payload  string
+		wantErr  error
+		wantCode string
+	}{
+		{"claims declaradas", `{"sub":"svc-a","scope":["leitura"],"nivel":2,"admin":false,"perfil":{"area":"ti"}}`, nil, ""},
+		{"só as obrigatórias", `{"sub":"svc-a"}`, nil, ""},
+		{"claim não declarada", `{"sub":"svc-a","email":"a@b"}`, ErrUnknownClaim, "unknown_claim"},
+		{"obrigatória ausente", `{"scope":["leitura"]}`, ErrMissingClaim, "missing_claim"},
+		{"tipo errado", `{"sub":42}`, ErrClaimType, "invalid_claim_type"},
+		{"inteiro com fração", `{"sub":"svc-a","nivel":1.5}`, ErrClaimType, "invalid_claim_type"},
+		{"audiência fora do perfil", `{"sub":"svc-a","aud":"parceiros"}`, ErrAudienceNotAllowed, "audience_not_allowed"},
+		{"reservada continua proibida", `{"sub":"svc-a","exp":1740830700}`, ErrReservedClaim, "reserved_claim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := profile.BuildClaims(base, "ca.internal", []byte(tt.payload), now)
+			if tt.wantErr != nil {
+				var claimErr *ClaimError
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &claimErr) || claimErr.Code != tt.wantCode {
+					t.Fatalf("esperado %v (%s), obtido %v", tt.wantErr, tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if claims["exp"] != now.Add(5*time.Minute).Unix() || claims["iss"] != "https://ca.internal" {
+				t.Errorf("claims do servidor inesperadas: %v", claims)
+			}
+			if aud, ok := claims["aud"].(jwt.ClaimStrings); !ok || len(aud) != 1 || aud[0] != "api.interna" {
+				t.Errorf("aud = %v, esperado a audiência do perfil", claims["aud"])
+			}
+		})
+	}
+}
+
+func TestLoadConfig_TokenProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"perfis válidos", `
+token_policy:
+  audiences: [api.interna, parceiros]
+token_profiles:
+  service-to-service:
+    lifetime: 10m
+    audience: [api.interna]
+    typ: at+jwt
+    claims:
+      sub: {type: string, required: true}
+      scope: {type: array}
+  partner-passport:
+    audience: [parceiros]`, false},
+		{"lifetime acima do máximo", `
+token_profiles:
+  short-lived-admin:
+    lifetime: 2h`, true},
+		{"audiência fora da política", `
+token_policy:
+  audiences: [api.interna]
+token_profiles:
+  partner-passport:
+    audience: [parceiros]`, true},
+		{"claim reservada", `
+token_profiles:
+  service-to-service:
+    claims:
+      exp: {type: number}`, true},
+		{"tipo desconhecido no issuer", `
+issuers:
+  produto-a:
+    token_profiles:
+      service-to-service:
+        claims:
+          sub: {type: texto}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTokenProfile) {
+				t.Errorf("esperado ErrInvalidTokenProfile, obtido %v", err)
+			}
+			if err == nil && cfg.Profiles["partner-passport"].Audience[0] != "parceiros" {
+				t.Errorf("audience = %v, esperado [parceiros]", cfg.Profiles["partner-passport"].Audience)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package keymanager
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+var (
+	ErrCacheMiss         = errors.New("public key not cached")
+	ErrCachedKeyMismatch = errors.New("cached public key does not match KMS signature")
+)
+
+// Campos do GetPublicKeyOutput e do DescribeKey usados pelo serviço, guardados
+// entre cold starts
+type CachedPublicKey struct {
+	KeyID                  string                            `json:"key_id"` // KeyId do YAML
+	ARN                    string                            `json:"arn"`
+	KeySpec                types.KeySpec                     `json:"key_spec"`
+	KeyUsage               types.KeyUsageType                `json:"key_usage"`
+	PublicKey              []byte                            `json:"public_key"`
+	SigningAlgorithms      []types.SigningAlgorithmSpec      `json:"signing_algorithms,omitempty"`
+	EncryptionAlgorithms   []types.EncryptionAlgorithmSpec   `json:"encryption_algorithms,omitempty"`
+	KeyAgreementAlgorithms []types.KeyAgreementAlgorithmSpec `json:"key_agreement_algorithms,omitempty"`
+	KeyState               types.KeyState                    `json:"key_state,omitempty"` // vazio em entradas sem DescribeKey
+	CachedAt               time.Time                         `json:"cached_at"`
+}
+
+// md pode ser nil; a entrada então nunca é considerada recente
+func NewCachedPublicKey(keyID string, out *kms.GetPublicKeyOutput, md *types.KeyMetadata, now time.Time) *CachedPublicKey {
+	key := &CachedPublicKey{
+		KeyID:                  keyID,
+		ARN:                    aws.ToString(out.KeyId),
+		KeySpec:                out.KeySpec,
+		KeyUsage:               out.KeyUsage,
+		PublicKey:              out.PublicKey,
+		SigningAlgorithms:      out.SigningAlgorithms,
+		EncryptionAlgorithms:   out.EncryptionAlgorithms,
+		KeyAgreementAlgorithms: out.KeyAgreementAlgorithms,
+		CachedAt:               now,
+	}
+	if md != nil {
+		key.KeyState = md.KeyState
+	}
+	return key
+}
+
+// Entrada com metadados e gravada há menos de maxAge: dispensa GetPublicKey e
+// DescribeKey no carregamento
+func (c *CachedPublicKey) FreshAt(now time.Time, maxAge time.Duration) bool {
+	return c.KeyState != "" && now.Sub(c.CachedAt) < maxAge
+}
+
+// Metadados guardados, no formato do DescribeKey, para a validação da chave
+func (c *CachedPublicKey) Metadata() *types.KeyMetadata {
+	return &types.KeyMetadata{
+		KeyId:                  aws.String(c.ARN),
+		Arn:                    aws.String(c.ARN),
+		KeyState:               c.KeyState,
+		Enabled:                c.KeyState == types.KeyStateEnabled,
+		KeySpec:                c.KeySpec,
+		KeyUsage:               c.KeyUsage,
+		SigningAlgorithms:      c.SigningAlgorithms,
+		EncryptionAlgorithms:   c.EncryptionAlgorithms,
+		KeyAgreementAlgorithms: c.KeyAgreementAlgorithms,
+	}
+}
+
+func (c *CachedPublicKey) Output() *kms.GetPublicKeyOutput {
+	return &kms.GetPublicKeyOutput{
+		KeyId:                  aws.String(c.ARN),
+		KeySpec:                c.KeySpec,
+		KeyUsage:               c.KeyUsage,
+		PublicKey:              c.PublicKey,
+		SigningAlgorithms:      c.SigningAlgorithms,
+		EncryptionAlgorithms:   c.EncryptionAlgorithms,
+		KeyAgreementAlgorithms: c.KeyAgreementAlgorithms,
+	}
+}
+
+// Armazenamento das chaves públicas por KeyId do YAML. Get retorna ErrCacheMiss
+// quando a chave não está guardada; adaptadores para S3 ou DynamoDB só
+// precisam implementar estes três métodos.
+type PublicKeyCache interface {
+	Get(ctx context.Context, keyID string) (*CachedPublicKey, error)
+	Put(ctx context.Context, key *CachedPublicKey) error
+	Delete(ctx context.Context, keyID string) error
+}
+
+// Idade máxima padrão de uma entrada do cache; depois dela a chave volta a ser
+// lida do KMS, o que também atualiza o estado (desativada, agendada para remoção)
+const DefaultPublicKeyCacheMaxAge = time.Hour
+
+// Configuração do cache no YAML
+type PublicKeyCacheConfig struct {
+	Backend string        `yaml:"backend"` // "memory" ou "file"
+	Dir     string        `yaml:"dir"`     // diretório do backend file
+	MaxAge  time.Duration `yaml:"max_age"` // ex.: 6h; padrão DefaultPublicKeyCacheMaxAge
+}
+
+func NewPublicKeyCache(cfg PublicKeyCacheConfig) (PublicKeyCache, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemoryPublicKeyCache(), nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, errors.New("cache de chaves públicas em arquivo exige dir")
+		}
+		return NewFilePublicKeyCache(cfg.Dir), nil
+	default:
+		return nil, fmt.Errorf("backend de cache de chaves públicas desconhecido: %s", cfg.Backend)
+	}
+}
+
+type MemoryPublicKeyCache struct {
+	mu   sync.RWMutex
+	keys map[string]*CachedPublicKey
+}
+
+func NewMemoryPublicKeyCache() *MemoryPublicKeyCache {
+	return &MemoryPublicKeyCache{keys: map[string]*CachedPublicKey{}}
+}
+
+func (c *MemoryPublicKeyCache) Get(ctx context.Context, keyID string) (*CachedPublicKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[keyID]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return key, nil
+}
+
+func (c *MemoryPublicKeyCache) Put(ctx context.Context, key *CachedPublicKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[key.KeyID] = key
+	return nil
+}
+
+func (c *MemoryPublicKeyCache) Delete(ctx context.Context, keyID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, keyID)
+	return nil
+}
+
+// Um arquivo JSON por chave, nomeado pelo SHA-256 do KeyId (aliases e ARNs
+// têm ":" e "/")
+type FilePublicKeyCache struct {
+	dir string
+}
+
+func NewFilePublicKeyCache(dir string) *FilePublicKeyCache {
+	return &FilePublicKeyCache{dir: dir}
+}
+
+func (c *FilePublicKeyCache) path(keyID string) string {
+	sum := sha256.Sum256([]byte(keyID))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *FilePublicKeyCache) Get(ctx context.Context, keyID string) (*CachedPublicKey, error) {
+	data, err := os.ReadFile(c.path(keyID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key CachedPublicKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("cache de %s corrompido: %w", keyID, err)
+	}
+	if key.KeyID != keyID {
+		return nil, ErrCacheMiss
+	}
+	return &key, nil
+}
+
+// Grava em arquivo temporário e renomeia, para leitores concorrentes não verem
+// um JSON pela metade
+func (c *FilePublicKeyCache) Put(ctx context.Context, key *CachedPublicKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".pubkey-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key.KeyID))
+}
+
+func (c *FilePublicKeyCache) Delete(ctx context.Context, keyID string) error {
+	err := os.Remove(c.path(keyID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Cliente usado por chaves carregadas do cache: a primeira assinatura do KMS é
+// conferida contra a chave pública guardada antes de ser entregue. Se não
+// conferir, a entrada é removida do cache e a chave passa a recusar qualquer
+// assinatura até a próxima recarga. A conferência acontece no primeiro uso da
+// chave ativa ou, para publicação, em KeyHolder.Confirm.
+type cacheCheckClient struct {
+	KeyClient
+	cache    PublicKeyCache
+	keyID    string
+	pub      crypto.PublicKey
+	verified atomic.Bool
+	failed   atomic.Bool
+}
+
+func newCacheCheckClient(client KeyClient, cache PublicKeyCache, cached *CachedPublicKey) (*cacheCheckClient, error) {
+	pub, err := x509.ParsePKIXPublicKey(cached.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("chave pública em cache inválida: %w", err)
+	}
+	return &cacheCheckClient{KeyClient: client, cache: cache, keyID: cached.KeyID, pub: pub}, nil
+}
+
+func (c *cacheCheckClient) Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	if c.failed.Load() {
+		return nil, fmt.Errorf("%w: %s", ErrCachedKeyMismatch, c.keyID)
+	}
+	out, err := c.KeyClient.Sign(ctx, in, optFns...)
+	if err != nil || c.verified.Load() {
+		return out, err
+	}
+	if err := verifyDigest(c.pub, in.SigningAlgorithm, in.Message, out.Signature); err != nil {
+		c.failed.Store(true)
+		c.cache.Delete(ctx, c.keyID)
+		return nil, fmt.Errorf("%w: %s: %v", ErrCachedKeyMismatch, c.keyID, err)
+	}
+	c.verified.Store(true)
+	return out, nil
+}
+
+// Assina um digest aleatório pelo KMS para conferir a chave do cache antes de
+// publicá-la ou usá-la na verificação; não chama o KMS se já conferida
+func (c *cacheCheckClient) confirm(ctx context.Context, algo types.SigningAlgorithmSpec) error {
+	if c.verified.Load() {
+		return nil
+	}
+	digest := make([]byte, digestHash(algo).Size())
+	rand.Read(digest)
+	_, err := c.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(c.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: algo,
+	})
+	return err
+}
+
+func digestHash(algo types.SigningAlgorithmSpec) crypto.Hash {
+	switch {
+	case strings.HasSuffix(string(algo), "SHA_384"):
+		return crypto.SHA384
+	case strings.HasSuffix(string(algo), "SHA_512"):
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+// Confere uma assinatura do KMS sobre um digest (MessageType DIGEST)
+func verifyDigest(pub crypto.PublicKey, algo types.SigningAlgorithmSpec, digest, sig []byte) error {
+	hash := digestHash(algo)
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return errors.New("assinatura ECDSA inválida")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if strings.HasPrefix(string(algo), "RSASSA_PSS") {
+			return rsa.VerifyPSS(key, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, sig)
+	default:
+		return fmt.Errorf("tipo de chave não suportado: %T", pub)
+	}
+}
@@ -0,0 +1,292 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func TestPublicKeyCache_Backends(t *testing.T) {
+	caches := map[string]PublicKeyCache{
+		"memory": NewMemoryPublicKeyCache(),
+		"file":   NewFilePublicKeyCache(t.TempDir()),
+	}
+	ctx := context.Background()
+	client := softkms.New()
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			keyID := "arn:aws:kms:us-east-1:111122223333:alias/jwt"
+			if _, err := cache.Get(ctx, keyID); !errors.Is(err, ErrCacheMiss) {
+				t.Fatalf("esperado ErrCacheMiss, obtido %v", err)
+			}
+
+			pub := softHolder(t, client, "alias/jwt").PubKey
+			if err := cache.Put(ctx, NewCachedPublicKey(keyID, pub, &types.KeyMetadata{KeyState: types.KeyStateEnabled}, time.Now())); err != nil {
+				t.Fatalf("erro ao gravar: %v", err)
+			}
+			got, err := cache.Get(ctx, keyID)
+			if err != nil {
+				t.Fatalf("erro ao ler: %v", err)
+			}
+			out := got.Output()
+			if string(out.PublicKey) != string(pub.PublicKey) || out.KeySpec != pub.KeySpec || *out.KeyId != *pub.KeyId || got.KeyState != types.KeyStateEnabled {
+				t.Errorf("entrada lida difere da gravada: %+v", got)
+			}
+
+			if err := cache.Delete(ctx, keyID); err != nil {
+				t.Fatalf("erro ao remover: %v", err)
+			}
+			if _, err := cache.Get(ctx, keyID); !errors.Is(err, ErrCacheMiss) {
+				t.Errorf("esperado ErrCacheMiss após remoção, obtido %v", err)
+			}
+		})
+	}
+}
+
+// Conta as chamadas ao KMS por operação
+type countingClient struct {
+	*softkms.Client
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newCountingClient(client *softkms.Client) *countingClient {
+	return &countingClient{Client: client, calls: map[string]int{}}
+}
+
+func (c *countingClient) count(op string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[op]++
+}
+
+func (c *countingClient) GetPublicKey(ctx context.Context, in *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	c.count("GetPublicKey")
+	return c.Client.GetPublicKey(ctx, in, optFns...)
+}
+
+func (c *countingClient) DescribeKey(ctx context.Context, in *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	c.count("DescribeKey")
+	return c.Client.DescribeKey(ctx, in, optFns...)
+}
+
+func (c *countingClient) Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	c.count("Sign")
+	return c.Client.Sign(ctx, in, optFns...)
+}
+
+func TestKeyLoader_Cache(t *testing.T) {
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	conf := &Config{Keys: map[string][]KeyEntry{
+		"jwt":  {{KeyID: "alias/jwt", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}},
+		"jwks": {{KeyID: "alias/jwks", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}},
+	}}
+	ctx := context.Background()
+	enabled := &types.KeyMetadata{KeyState: types.KeyStateEnabled}
+
+	sign := func(key *KeyHolder) error {
+		_, err := jwt.NewWithClaims(key.SigningMethod(), jwt.MapClaims{"sub": "teste"}).SignedString(key.WithContext(ctx))
+		return err
+	}
+
+	t.Run("entrada recente dispensa o KMS até o primeiro uso", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		soft := softkms.New()
+		if _, _, err := newTestLoader(soft, now).WithCache(cache).Load(ctx, conf); err != nil {
+			t.Fatalf("erro no primeiro carregamento: %v", err)
+		}
+		if cached, err := cache.Get(ctx, "alias/jwt"); err != nil || cached.KeyState != types.KeyStateEnabled {
+			t.Fatalf("cache deveria guardar o estado do DescribeKey, obtido %+v (%v)", cached, err)
+		}
+
+		client := newCountingClient(soft)
+		groups, report, err := newTestLoader(client, now.Add(30*time.Minute)).WithCache(cache).Load(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro no segundo carregamento: %v", err)
+		}
+		if len(client.calls) != 0 {
+			t.Errorf("esperado nenhuma chamada ao KMS com cache recente, obtido %v", client.calls)
+		}
+		for _, status := range report.Keys {
+			if !status.FromCache {
+				t.Errorf("%s deveria vir do cache", status.KeyID)
+			}
+		}
+
+		key := groups["jwt"][0]
+		if key.Trusted() {
+			t.Error("chave do cache não deveria estar conferida antes do primeiro uso")
+		}
+		if err := sign(key); err != nil {
+			t.Fatalf("erro ao assinar: %v", err)
+		}
+		if !key.Trusted() || client.calls["Sign"] != 1 {
+			t.Errorf("primeira assinatura deveria conferir a chave, chamadas %v", client.calls)
+		}
+	})
+
+	t.Run("entrada antiga volta ao KMS", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		soft := softkms.New()
+		if _, _, err := newTestLoader(soft, now).WithCache(cache).Load(ctx, conf); err != nil {
+			t.Fatalf("erro no primeiro carregamento: %v", err)
+		}
+
+		client := newCountingClient(soft)
+		later := now.Add(DefaultPublicKeyCacheMaxAge)
+		_, report, err := newTestLoader(client, later).WithCache(cache).Load(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro no segundo carregamento: %v", err)
+		}
+		if client.calls["GetPublicKey"] != 2 || client.calls["DescribeKey"] != 2 {
+			t.Errorf("esperado GetPublicKey e DescribeKey por chave, obtido %v", client.calls)
+		}
+		for _, status := range report.Keys {
+			if status.FromCache {
+				t.Errorf("%s não deveria vir do cache", status.KeyID)
+			}
+		}
+		if cached, _ := cache.Get(ctx, "alias/jwt"); !cached.CachedAt.Equal(later) {
+			t.Errorf("entrada deveria ser regravada em %s, obtido %s", later, cached.CachedAt)
+		}
+
+		// max_age maior mantém a mesma entrada
+		client = newCountingClient(soft)
+		if _, _, err := newTestLoader(client, later).WithCache(cache).WithCacheMaxAge(24*time.Hour).Load(ctx, conf); err != nil {
+			t.Fatalf("erro no terceiro carregamento: %v", err)
+		}
+		if len(client.calls) != 0 {
+			t.Errorf("esperado nenhuma chamada com max_age de 24h, obtido %v", client.calls)
+		}
+	})
+
+	t.Run("entrada sem metadados volta ao KMS", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		soft := softkms.New()
+		cache.Put(ctx, NewCachedPublicKey("alias/jwt", softHolder(t, soft, "alias/jwt").PubKey, nil, now))
+
+		client := newCountingClient(soft)
+		if _, _, err := newTestLoader(client, now).WithCache(cache).Load(ctx, conf); err != nil {
+			t.Fatalf("erro no carregamento: %v", err)
+		}
+		if client.calls["DescribeKey"] != 2 {
+			t.Errorf("esperado DescribeKey por chave, obtido %v", client.calls)
+		}
+	})
+
+	t.Run("estado guardado no cache é validado", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		soft := softkms.New()
+		cache.Put(ctx, NewCachedPublicKey("alias/jwt", softHolder(t, soft, "alias/jwt").PubKey, &types.KeyMetadata{KeyState: types.KeyStateDisabled}, now))
+
+		_, report, err := newTestLoader(soft, now).WithCache(cache).Load(ctx, conf)
+		if !errors.Is(err, ErrKeyNotEnabled) {
+			t.Errorf("esperado ErrKeyNotEnabled, obtido %v", err)
+		}
+		for _, status := range report.Keys {
+			if status.KeyID == "alias/jwt" && status.Loaded {
+				t.Error("chave desativada no cache não deveria ser carregada")
+			}
+		}
+	})
+
+	t.Run("cache adulterado é recusado e removido", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		soft := softkms.New()
+		real := softHolder(t, soft, "alias/jwt")
+		tampered := softHolder(t, softkms.New(), "alias/jwt").PubKey
+		cache.Put(ctx, NewCachedPublicKey("alias/jwt", tampered, enabled, now))
+
+		client := newCountingClient(soft)
+		set, err := newTestLoader(client, now).WithCache(cache).LoadKeySet(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro no carregamento: %v", err)
+		}
+		key := set.Group("jwt")[0]
+		err = sign(key)
+		if !errors.Is(err, ErrCachedKeyMismatch) {
+			t.Fatalf("esperado ErrCachedKeyMismatch, obtido %v", err)
+		}
+		if isRetryable(err) {
+			t.Error("divergência do cache não deveria ser repetida")
+		}
+		if _, err := cache.Get(ctx, "alias/jwt"); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("entrada adulterada deveria sair do cache, obtido %v", err)
+		}
+		if err := sign(key); !errors.Is(err, ErrCachedKeyMismatch) || client.calls["Sign"] != 1 {
+			t.Errorf("chave recusada não deveria voltar ao KMS, obtido %v (%v)", err, client.calls)
+		}
+
+		set.ConfirmPublished(ctx, now)
+		if jwks, _ := BuildJWKSet(PublishedEntries(set.Group("jwt"), nil, now)); len(jwks.Keys) != 0 {
+			t.Errorf("chave recusada não deveria ser publicada, obtido %+v", jwks.Keys)
+		}
+		if health := set.Health(now); health.Status != HealthDegraded {
+			t.Errorf("esperado degraded com chave recusada, obtido %s", health.Status)
+		}
+
+		reloaded, err := newTestLoader(soft, now).WithCache(cache).LoadKeySet(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro na recarga: %v", err)
+		}
+		if got, err := cache.Get(ctx, "alias/jwt"); err != nil || string(got.PublicKey) != string(real.PubKey.PublicKey) {
+			t.Error("cache deveria voltar a ter a chave do KMS")
+		}
+		if err := sign(reloaded.Group("jwt")[0]); err != nil {
+			t.Errorf("chave recarregada do KMS deveria assinar, obtido %v", err)
+		}
+	})
+
+	t.Run("chaves publicadas são conferidas antes do JWKS", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		soft := softkms.New()
+		real := softHolder(t, soft, "alias/jwt")
+		cache.Put(ctx, NewCachedPublicKey("alias/jwt", real.PubKey, enabled, now))
+		cache.Put(ctx, NewCachedPublicKey("alias/jwks", softHolder(t, soft, "alias/jwks").PubKey, enabled, now))
+
+		client := newCountingClient(soft)
+		set, err := newTestLoader(client, now).WithCache(cache).LoadKeySet(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro no carregamento: %v", err)
+		}
+		if visible := GetVisibleAt(set.Group("jwt"), now); len(visible) != 0 {
+			t.Error("chave não conferida não deveria ser publicada")
+		}
+		set.ConfirmPublished(ctx, now)
+		set.ConfirmPublished(ctx, now)
+		if client.calls["Sign"] != 1 {
+			t.Errorf("esperado uma assinatura de conferência, obtido %v", client.calls)
+		}
+		jwks, err := BuildJWKSet(PublishedEntries(set.Group("jwt"), nil, now))
+		if err != nil {
+			t.Fatalf("erro ao montar JWKS: %v", err)
+		}
+		if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != real.Kid() {
+			t.Errorf("JWKS deveria publicar a chave conferida (%s), obtido %+v", real.Kid(), jwks.Keys)
+		}
+	})
+
+	t.Run("chave do cache não conferida fica fora do JWKS", func(t *testing.T) {
+		soft := softkms.New()
+		cached := NewCachedPublicKey("alias/jwt", softHolder(t, soft, "alias/jwt").PubKey, nil, now)
+		checked, err := newCacheCheckClient(soft, NewMemoryPublicKeyCache(), cached)
+		if err != nil {
+			t.Fatalf("erro ao criar cliente: %v", err)
+		}
+		key := NewKeyHolder(cached.Output(), jwtkms.NewKMSConfig(checked, "alias/jwt", false), KeyEntry{KeyID: "alias/jwt", ExpiresAt: now.Add(time.Hour)})
+		key.cacheCheck = checked
+		if visible := GetVisibleAt([]*KeyHolder{key}, now); len(visible) != 0 {
+			t.Errorf("chave não conferida não deveria ser publicada")
+		}
+	})
+}
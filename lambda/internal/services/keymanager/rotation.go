@@ -0,0 +1,160 @@
+package keymanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrDuplicateKeyID   = errors.New("duplicate key_id in group")
+	ErrDuplicateUseFrom = errors.New("duplicate use_from in group")
+	ErrMissingUseFrom   = errors.New("use_from is required")
+	ErrKeyAgeExceeded   = errors.New("key exceeds max_key_age_days before its successor")
+	ErrUnknownGroup     = errors.New("unknown key group")
+)
+
+// Política de rotação de um grupo. Em rotation_policy, campos zerados herdam
+// de expires_policy.
+type RotationPolicy struct {
+	OverlapDays       int `yaml:"overlap_days"`         // a chave anterior segue publicada após a próxima entrar em uso
+	MaxKeyAgeDays     int `yaml:"max_key_age_days"`     // deixa de assinar após N dias de uso; 0 = sem limite
+	PublishLeadDays   int `yaml:"publish_lead_days"`    // publica N dias antes do use_from quando publish_from não está na entrada
+	LastKeyExpiryDays int `yaml:"last_key_expiry_days"` // expiração da chave mais recente; padrão 10 anos
+
+	// Rotação automática (kmsrotate), só para grupos com max_key_age_days
+	RotateLeadDays int    `yaml:"rotate_lead_days"` // cria a sucessora N dias antes da aposentadoria; padrão publish_lead_days ou 7
+	AliasPrefix    string `yaml:"alias_prefix"`     // prefixo do alias das chaves criadas; padrão alias/lambda-ca
+}
+
+func (p RotationPolicy) inherit(base RotationPolicy) RotationPolicy {
+	if p.OverlapDays == 0 {
+		p.OverlapDays = base.OverlapDays
+	}
+	if p.MaxKeyAgeDays == 0 {
+		p.MaxKeyAgeDays = base.MaxKeyAgeDays
+	}
+	if p.PublishLeadDays == 0 {
+		p.PublishLeadDays = base.PublishLeadDays
+	}
+	if p.LastKeyExpiryDays == 0 {
+		p.LastKeyExpiryDays = base.LastKeyExpiryDays
+	}
+	if p.RotateLeadDays == 0 {
+		p.RotateLeadDays = base.RotateLeadDays
+	}
+	if p.AliasPrefix == "" {
+		p.AliasPrefix = base.AliasPrefix
+	}
+	return p
+}
+
+// Política efetiva do grupo
+func (c *Config) Policy(group string) RotationPolicy {
+	return c.RotationPolicies[group].inherit(c.ExpiresPolicy)
+}
+
+// Ordena por use_from e calcula expires_at, retire_at e publish_from conforme
+// a política. Não altera o slice recebido.
+//
+// Cada chave expira overlap_days depois do use_from da seguinte; a mais
+// recente, last_key_expiry_days (padrão: 10 anos) depois do próprio use_from. Com
+// max_key_age_days, a chave deixa de assinar ao atingir essa idade (ou em
+// retire_extended_until, se depois) e expira overlap_days depois disso, se for antes.
+func ApplyRotationPolicy(entries []KeyEntry, policy RotationPolicy) []KeyEntry {
+	sorted := append([]KeyEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].UseFrom.Before(sorted[j].UseFrom) })
+
+	for i := range sorted {
+		entry := &sorted[i]
+		if i < len(sorted)-1 {
+			entry.ExpiresAt = sorted[i+1].UseFrom.AddDate(0, 0, policy.OverlapDays)
+		} else if policy.LastKeyExpiryDays > 0 {
+			entry.ExpiresAt = entry.UseFrom.AddDate(0, 0, policy.LastKeyExpiryDays)
+		} else {
+			entry.ExpiresAt = entry.UseFrom.AddDate(10, 0, 0)
+		}
+
+		if policy.MaxKeyAgeDays > 0 {
+			retire := entry.UseFrom.AddDate(0, 0, policy.MaxKeyAgeDays)
+			if entry.RetireExtendedUntil.After(retire) {
+				retire = entry.RetireExtendedUntil
+			}
+			if entry.RetireAt.IsZero() || retire.Before(entry.RetireAt) {
+				entry.RetireAt = retire
+			}
+			if limit := retire.AddDate(0, 0, policy.OverlapDays); limit.Before(entry.ExpiresAt) {
+				entry.ExpiresAt = limit
+			}
+		}
+		if entry.PublishFrom.IsZero() && policy.PublishLeadDays > 0 {
+			entry.PublishFrom = entry.UseFrom.AddDate(0, 0, -policy.PublishLeadDays)
+		}
+	}
+	return sorted
+}
+
+// Confere as entradas de um grupo: key_id e use_from únicos, use_from
+// presente e, com max_key_age_days, sucessora em uso antes da chave atingir a
+// idade máxima
+func ValidateGroupEntries(group string, entries []KeyEntry, policy RotationPolicy) error {
+	var errs []error
+	fail := func(err error, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %w: %s", group, err, fmt.Sprintf(format, args...)))
+	}
+
+	keyIDs := map[string]bool{}
+	useFroms := map[time.Time]string{}
+	for _, entry := range entries {
+		if keyIDs[entry.KeyID] {
+			fail(ErrDuplicateKeyID, "%s", entry.KeyID)
+		}
+		keyIDs[entry.KeyID] = true
+
+		if entry.UseFrom.IsZero() {
+			fail(ErrMissingUseFrom, "%s", entry.KeyID)
+			continue
+		}
+		if other, ok := useFroms[entry.UseFrom.UTC()]; ok {
+			fail(ErrDuplicateUseFrom, "%s e %s em %s", other, entry.KeyID, entry.UseFrom.Format(time.RFC3339))
+		}
+		useFroms[entry.UseFrom.UTC()] = entry.KeyID
+	}
+
+	if policy.MaxKeyAgeDays > 0 {
+		sorted := ApplyRotationPolicy(entries, policy)
+		for i := 0; i < len(sorted)-1; i++ {
+			current, next := sorted[i], sorted[i+1]
+			if current.RetireAt.Before(next.UseFrom) && current.RevokedAt.IsZero() {
+				fail(ErrKeyAgeExceeded, "%s deixa de assinar em %s, %s só entra em uso em %s",
+					current.KeyID, current.RetireAt.Format(time.RFC3339), next.KeyID, next.UseFrom.Format(time.RFC3339))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Valida os grupos do nível raiz e de cada issuer
+func (c *Config) validateKeys() error {
+	var errs []error
+	for group := range c.Keys {
+		if _, ok := GroupUses[group]; !ok {
+			errs = append(errs, fmt.Errorf("%w: keys.%s", ErrUnknownGroup, group))
+		}
+	}
+	for group := range c.RotationPolicies {
+		if _, ok := GroupUses[group]; !ok {
+			errs = append(errs, fmt.Errorf("%w: rotation_policy.%s", ErrUnknownGroup, group))
+		}
+	}
+	for _, group := range Groups {
+		errs = append(errs, ValidateGroupEntries(group, c.Keys[group], c.Policy(group)))
+	}
+	for _, name := range c.IssuerNames() {
+		if err := c.Issuers[name].validateKeys(); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
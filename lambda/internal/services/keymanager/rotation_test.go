@@ -0,0 +1,140 @@
+package keymanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestApplyRotationPolicy(t *testing.T) {
+	entries := []KeyEntry{
+		{KeyID: "k2", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")},
+		{KeyID: "k1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+	}
+
+	tests := []struct {
+		name        string
+		policy      RotationPolicy
+		wantExpires []string
+		wantRetire  []string
+		wantPublish []string
+	}{
+		{
+			name:        "ordena e aplica overlap",
+			policy:      RotationPolicy{OverlapDays: 30},
+			wantExpires: []string{"2025-01-31T00:00:00Z", "2035-01-01T00:00:00Z"},
+		},
+		{
+			name:        "expiração da última chave",
+			policy:      RotationPolicy{OverlapDays: 30, LastKeyExpiryDays: 400},
+			wantExpires: []string{"2025-01-31T00:00:00Z", "2026-02-05T00:00:00Z"},
+		},
+		{
+			name:        "idade máxima aposenta e antecipa a expiração",
+			policy:      RotationPolicy{OverlapDays: 10, MaxKeyAgeDays: 300},
+			wantExpires: []string{"2024-11-06T00:00:00Z", "2025-11-07T00:00:00Z"},
+			wantRetire:  []string{"2024-10-27T00:00:00Z", "2025-10-28T00:00:00Z"},
+		},
+		{
+			name:        "antecedência de publicação",
+			policy:      RotationPolicy{PublishLeadDays: 7},
+			wantExpires: []string{"2025-01-01T00:00:00Z", "2035-01-01T00:00:00Z"},
+			wantPublish: []string{"2023-12-25T00:00:00Z", "2024-12-25T00:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyRotationPolicy(entries, tt.policy)
+			if got[0].KeyID != "k1" || entries[0].KeyID != "k2" {
+				t.Fatal("entradas deveriam ser ordenadas numa cópia")
+			}
+			check := func(field string, want []string, value func(KeyEntry) string) {
+				for i, w := range want {
+					if v := value(got[i]); v != w {
+						t.Errorf("%s %s: esperado %s, obtido %s", got[i].KeyID, field, w, v)
+					}
+				}
+			}
+			check("expires_at", tt.wantExpires, func(e KeyEntry) string { return e.ExpiresAt.Format("2006-01-02T15:04:05Z07:00") })
+			check("retire_at", tt.wantRetire, func(e KeyEntry) string { return e.RetireAt.Format("2006-01-02T15:04:05Z07:00") })
+			check("publish_from", tt.wantPublish, func(e KeyEntry) string { return e.PublishFrom.Format("2006-01-02T15:04:05Z07:00") })
+		})
+	}
+}
+
+func TestValidateGroupEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []KeyEntry
+		policy  RotationPolicy
+		want    error
+	}{
+		{"válidas", []KeyEntry{
+			{KeyID: "k1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+			{KeyID: "k2", UseFrom: mustParse(t, "2024-06-01T00:00:00Z")},
+		}, RotationPolicy{MaxKeyAgeDays: 365}, nil},
+		{"key_id repetido", []KeyEntry{
+			{KeyID: "k1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+			{KeyID: "k1", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")},
+		}, RotationPolicy{}, ErrDuplicateKeyID},
+		{"use_from repetido", []KeyEntry{
+			{KeyID: "k1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+			{KeyID: "k2", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+		}, RotationPolicy{}, ErrDuplicateUseFrom},
+		{"use_from ausente", []KeyEntry{{KeyID: "k1"}}, RotationPolicy{}, ErrMissingUseFrom},
+		{"sucessora depois da idade máxima", []KeyEntry{
+			{KeyID: "k1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+			{KeyID: "k2", UseFrom: mustParse(t, "2025-06-01T00:00:00Z")},
+		}, RotationPolicy{MaxKeyAgeDays: 365}, ErrKeyAgeExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGroupEntries("jwt", tt.entries, tt.policy)
+			if tt.want == nil && err != nil {
+				t.Errorf("erro inesperado: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("esperado %v, obtido %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_RotationPolicy(t *testing.T) {
+	path := t.TempDir() + "/kms-keys.yaml"
+	os.WriteFile(path, []byte(`
+expires_policy:
+  overlap_days: 30
+rotation_policy:
+  jwks:
+    overlap_days: 1
+    max_key_age_days: 400
+keys:
+  jwt:
+    - key_id: alias/jwt
+      use_from: "2024-01-01T00:00:00Z"
+  jwks:
+    - key_id: alias/jwks
+      use_from: "2024-01-01T00:00:00Z"`), 0644)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("erro ao carregar: %v", err)
+	}
+	if p := cfg.Policy("jwks"); p.OverlapDays != 1 || p.MaxKeyAgeDays != 400 {
+		t.Errorf("política do jwks inesperada: %+v", p)
+	}
+	if p := cfg.Policy("jwt"); p.OverlapDays != 30 || p.MaxKeyAgeDays != 0 {
+		t.Errorf("jwt deveria herdar expires_policy: %+v", p)
+	}
+
+	os.WriteFile(path, []byte(`
+rotation_policy:
+  jwe:
+    overlap_days: 1`), 0644)
+	if _, err := LoadConfig(path); !errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("esperado ErrUnknownGroup, obtido %v", err)
+	}
+}
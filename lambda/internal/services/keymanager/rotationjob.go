@@ -0,0 +1,505 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Operações do KMS usadas pela rotação automática; kms.Client e softkms.Client
+// implementam todas
+type RotationClient interface {
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+	CreateKey(ctx context.Context, params *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error)
+	CreateAlias(ctx context.Context, params *kms.CreateAliasInput, optFns ...func(*kms.Options)) (*kms.CreateAliasOutput, error)
+	ReplicateKey(ctx context.Context, params *kms.ReplicateKeyInput, optFns ...func(*kms.Options)) (*kms.ReplicateKeyOutput, error)
+}
+
+const (
+	defaultRotateLeadDays = 7
+	defaultAliasPrefix    = "alias/lambda-ca"
+)
+
+func (p RotationPolicy) rotateLead() int {
+	switch {
+	case p.RotateLeadDays > 0:
+		return p.RotateLeadDays
+	case p.PublishLeadDays > 0:
+		return p.PublishLeadDays
+	}
+	return defaultRotateLeadDays
+}
+
+// Sucessora que a rotação precisa criar num grupo
+type RotationStep struct {
+	Issuer      string // nome em "issuers"; vazio no nível raiz
+	Group       string
+	Previous    KeyEntry  // chave mais recente do grupo, com a política aplicada
+	UseFrom     time.Time // aposentadoria da anterior, ou publish_lead_days à frente se ela já passou
+	PublishFrom time.Time // publish_lead_days antes do use_from, nunca antes da execução
+	Alias       string    // alias da chave nova, usado como key_id
+
+	// A anterior já se aposentou: segue assinando até o use_from da nova
+	// (retire_extended_until), para o grupo não ficar sem chave ativa
+	ExtendPrevious bool
+}
+
+func (s RotationStep) String() string {
+	if s.Issuer == "" {
+		return s.Group
+	}
+	return s.Issuer + "." + s.Group
+}
+
+// Entrada do YAML da chave nova: mesmo alg e kid_strategy da anterior, exceto
+// explicit, que dependeria de um kid escolhido à mão. replicas são os ARNs das
+// réplicas da chave nova, nas regiões das réplicas da anterior.
+func (s RotationStep) Successor(replicas []string) KeyEntry {
+	entry := KeyEntry{KeyID: s.Alias, Alg: s.Previous.Alg, UseFrom: s.UseFrom, PublishFrom: s.PublishFrom, Replicas: replicas}
+	if s.Previous.KidStrategy != KidStrategyExplicit {
+		entry.KidStrategy = s.Previous.KidStrategy
+	}
+	return entry
+}
+
+// Grupos cuja chave mais recente não revogada atinge max_key_age_days em menos
+// de rotate_lead_days. A sucessora entra em uso quando a anterior se aposenta;
+// se a rotação atrasou e esse instante já passou, ela só assina
+// publish_lead_days depois da execução, para que os verificadores a vejam no
+// JWKS antes do primeiro token, e a anterior é prorrogada até lá.
+func PlanRotations(cfg *Config, now time.Time) []RotationStep {
+	steps := planIssuerRotations("", cfg, now)
+	for _, name := range cfg.IssuerNames() {
+		steps = append(steps, planIssuerRotations(name, cfg.Issuers[name], now)...)
+	}
+	return steps
+}
+
+func planIssuerRotations(issuer string, cfg *Config, now time.Time) []RotationStep {
+	var steps []RotationStep
+	for _, group := range Groups {
+		policy := cfg.Policy(group)
+		if policy.MaxKeyAgeDays <= 0 {
+			continue
+		}
+		var newest *KeyEntry
+		entries := ApplyRotationPolicy(cfg.Keys[group], policy)
+		for i := range entries {
+			if entries[i].RevokedAt.IsZero() {
+				newest = &entries[i]
+			}
+		}
+		if newest == nil || now.AddDate(0, 0, policy.rotateLead()).Before(newest.RetireAt) {
+			continue
+		}
+
+		lead := policy.PublishLeadDays
+		useFrom := newest.RetireAt
+		if earliest := now.AddDate(0, 0, lead); useFrom.Before(earliest) {
+			useFrom = earliest
+		}
+		useFrom = useFrom.UTC().Truncate(time.Second)
+		publishFrom := useFrom.AddDate(0, 0, -lead)
+		if publishFrom.Before(now) {
+			publishFrom = now.UTC().Truncate(time.Second)
+		}
+		prefix := policy.AliasPrefix
+		if prefix == "" {
+			prefix = defaultAliasPrefix
+			if issuer != "" {
+				prefix += "/" + issuer
+			}
+		}
+		steps = append(steps, RotationStep{
+			Issuer:      issuer,
+			Group:       group,
+			Previous:    *newest,
+			UseFrom:     useFrom,
+			PublishFrom: publishFrom,
+			Alias:       fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(prefix, "/"), group, useFrom.Format("20060102")),
+
+			ExtendPrevious: newest.RetireAt.Before(useFrom),
+		})
+	}
+	return steps
+}
+
+// Registro de auditoria de uma rotação, gravado como uma linha JSON
+type RotationRecord struct {
+	Event         string    `json:"event"`
+	At            time.Time `json:"at"`
+	Source        string    `json:"config_source"`
+	ConfigVersion string    `json:"config_version"` // versão sobre a qual a entrada foi gravada
+	Issuer        string    `json:"issuer,omitempty"`
+	Group         string    `json:"group"`
+	PreviousKeyID string    `json:"previous_key_id"`
+	KeyID         string    `json:"key_id"` // alias criado, usado como key_id no YAML
+	KeyARN        string    `json:"key_arn,omitempty"`
+	KeySpec       string    `json:"key_spec,omitempty"`
+	KeyUsage      string    `json:"key_usage,omitempty"`
+	Replicas      []string  `json:"replicas,omitempty"` // ARNs das réplicas da chave nova
+	UseFrom       time.Time `json:"use_from"`
+	PublishFrom   time.Time `json:"publish_from"`
+	Reused        bool      `json:"reused,omitempty"`            // alias criado por uma execução anterior que não gravou a configuração
+	Extended      bool      `json:"previous_extended,omitempty"` // anterior prorrogada até use_from (retire_extended_until)
+	DryRun        bool      `json:"dry_run,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type RotationResult struct {
+	ConfigVersion string
+	Records       []RotationRecord
+}
+
+// Cria no KMS as chaves devidas pela política de rotação e acrescenta as
+// entradas na origem da configuração
+type RotationJob struct {
+	client RotationClient
+	source ConfigWriter
+	clock  Clock
+	audit  io.Writer
+	dryRun bool
+}
+
+// A origem precisa aceitar gravação (ConfigWriter)
+func NewRotationJob(client RotationClient, source ConfigSource, clock Clock) (*RotationJob, error) {
+	writer, ok := source.(ConfigWriter)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", source, ErrReadOnlyConfig)
+	}
+	return &RotationJob{client: client, source: writer, clock: clock}, nil
+}
+
+// Destino dos registros de auditoria, uma linha JSON por rotação
+func (j *RotationJob) WithAudit(w io.Writer) *RotationJob {
+	j.audit = w
+	return j
+}
+
+// Só planeja e valida: não cria chaves nem grava a configuração
+func (j *RotationJob) WithDryRun() *RotationJob {
+	j.dryRun = true
+	return j
+}
+
+// Uma falha num grupo não impede os demais: as entradas das chaves criadas são
+// gravadas juntas numa única escrita, condicionada à versão lida
+func (j *RotationJob) Run(ctx context.Context) (*RotationResult, error) {
+	data, version, err := j.source.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseVersioned(data, version)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", j.source, err)
+	}
+
+	now := j.clock.Now()
+	result := &RotationResult{ConfigVersion: version}
+	var errs []error
+	updated, appended := data, 0
+	for _, step := range PlanRotations(cfg, now) {
+		record := RotationRecord{
+			Event:         "kms_key_rotation",
+			At:            now,
+			Source:        j.source.String(),
+			ConfigVersion: version,
+			Issuer:        step.Issuer,
+			Group:         step.Group,
+			PreviousKeyID: step.Previous.KeyID,
+			KeyID:         step.Alias,
+			UseFrom:       step.UseFrom,
+			PublishFrom:   step.PublishFrom,
+			Extended:      step.ExtendPrevious,
+			DryRun:        j.dryRun,
+		}
+		err := j.createKey(ctx, step, &record)
+		if err == nil {
+			updated, err = appendKeyEntry(updated, step.Issuer, step.Group, step.Successor(record.Replicas))
+		}
+		if err == nil && step.ExtendPrevious {
+			updated, err = extendRetirement(updated, step.Issuer, step.Group, step.Previous.KeyID, step.UseFrom)
+		}
+		if err != nil {
+			record.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", step, err))
+		} else {
+			appended++
+		}
+		result.Records = append(result.Records, record)
+	}
+
+	if appended > 0 {
+		err := j.save(ctx, updated, version)
+		if err != nil {
+			errs = append(errs, err)
+			for i := range result.Records {
+				if result.Records[i].Error == "" {
+					result.Records[i].Error = "configuração não gravada: " + err.Error()
+				}
+			}
+		}
+	}
+	j.emit(result.Records)
+	return result, errors.Join(errs...)
+}
+
+// Mesma spec, uso e réplicas da chave anterior: com replicas, a sucessora é
+// multirregião e replicada nas mesmas regiões
+func (j *RotationJob) createKey(ctx context.Context, step RotationStep, record *RotationRecord) error {
+	described, err := j.client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(step.Previous.KeyID)})
+	if err != nil {
+		return err
+	}
+	previous := described.KeyMetadata
+	if previous == nil {
+		return ErrKeyMetadataMissing
+	}
+	record.KeySpec, record.KeyUsage = string(previous.KeySpec), string(previous.KeyUsage)
+	regions, err := replicaRegions(step.Previous.Replicas)
+	if err != nil {
+		return err
+	}
+	multiRegion := aws.ToBool(previous.MultiRegion) || len(regions) > 0
+
+	// Se uma execução anterior criou a chave e falhou ao gravar a configuração,
+	// o alias já existe: reaproveita em vez de criar outra chave
+	var key *types.KeyMetadata
+	existing, err := j.client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(step.Alias)})
+	var notFound *types.NotFoundException
+	switch {
+	case err == nil:
+		key = existing.KeyMetadata
+		if err := reuseKey(key, previous, multiRegion, record); err != nil {
+			return err
+		}
+	case !errors.As(err, &notFound):
+		return err
+	case j.dryRun:
+		return nil
+	default:
+		created, err := j.client.CreateKey(ctx, &kms.CreateKeyInput{
+			KeySpec:     previous.KeySpec,
+			KeyUsage:    previous.KeyUsage,
+			MultiRegion: aws.Bool(multiRegion),
+			Description: aws.String(fmt.Sprintf("lambda-ca %s, sucessora de %s", step, step.Previous.KeyID)),
+		})
+		if err != nil {
+			return err
+		}
+		if key = created.KeyMetadata; key == nil {
+			return ErrKeyMetadataMissing
+		}
+		record.KeyARN = aws.ToString(key.Arn)
+		if _, err := j.client.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String(step.Alias), TargetKeyId: key.KeyId}); err != nil {
+			return err
+		}
+	}
+
+	record.Replicas, err = j.replicate(ctx, key, regions)
+	return err
+}
+
+// A chave do alias existente precisa ter a spec e o uso da anterior
+func reuseKey(existing, previous *types.KeyMetadata, multiRegion bool, record *RotationRecord) error {
+	if existing == nil {
+		return ErrKeyMetadataMissing
+	}
+	if existing.KeySpec != previous.KeySpec || existing.KeyUsage != previous.KeyUsage {
+		return fmt.Errorf("alias %s já existe com %s/%s, esperado %s/%s", record.KeyID,
+			existing.KeySpec, existing.KeyUsage, previous.KeySpec, previous.KeyUsage)
+	}
+	if multiRegion && !aws.ToBool(existing.MultiRegion) {
+		return fmt.Errorf("alias %s já existe numa chave que não é multirregião", record.KeyID)
+	}
+	record.KeyARN, record.Reused = aws.ToString(existing.Arn), true
+	return nil
+}
+
+// Regiões das réplicas da chave anterior, na ordem de failover
+func replicaRegions(replicas []string) ([]string, error) {
+	regions := make([]string, 0, len(replicas))
+	for _, arn := range replicas {
+		region, err := ReplicaRegion(arn)
+		if err != nil {
+			return nil, err
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// ARNs das réplicas da chave em cada região, criando só as que ainda não
+// existem; a simulação lista apenas as existentes
+func (j *RotationJob) replicate(ctx context.Context, key *types.KeyMetadata, regions []string) ([]string, error) {
+	existing := map[string]string{}
+	if mrc := key.MultiRegionConfiguration; mrc != nil {
+		for _, replica := range mrc.ReplicaKeys {
+			existing[aws.ToString(replica.Region)] = aws.ToString(replica.Arn)
+		}
+	}
+
+	var arns []string
+	for _, region := range regions {
+		arn, ok := existing[region]
+		if !ok {
+			if j.dryRun {
+				continue
+			}
+			out, err := j.client.ReplicateKey(ctx, &kms.ReplicateKeyInput{KeyId: key.KeyId, ReplicaRegion: aws.String(region)})
+			if err != nil {
+				return arns, fmt.Errorf("réplica em %s: %w", region, err)
+			}
+			if out.ReplicaKeyMetadata == nil {
+				return arns, ErrKeyMetadataMissing
+			}
+			arn = aws.ToString(out.ReplicaKeyMetadata.Arn)
+		}
+		arns = append(arns, arn)
+	}
+	return arns, nil
+}
+
+// Valida o resultado como o carregamento faria antes de gravar
+func (j *RotationJob) save(ctx context.Context, data []byte, version string) error {
+	if _, err := ParseConfig(data); err != nil {
+		return fmt.Errorf("configuração resultante inválida: %w", err)
+	}
+	if j.dryRun {
+		return nil
+	}
+	return j.source.Write(ctx, data, version)
+}
+
+func (j *RotationJob) emit(records []RotationRecord) {
+	if j.audit == nil {
+		return
+	}
+	enc := json.NewEncoder(j.audit)
+	for _, record := range records {
+		enc.Encode(record)
+	}
+}
+
+// Acrescenta a entrada em keys.<grupo> (ou issuers.<nome>.keys.<grupo>)
+// editando a árvore do YAML, para preservar comentários e a ordem dos campos
+func appendKeyEntry(data []byte, issuer, group string, entry KeyEntry) ([]byte, error) {
+	return editKeyGroup(data, issuer, group, func(node *yaml.Node) error {
+		var item yaml.Node
+		if err := item.Encode(entry); err != nil {
+			return err
+		}
+		if node.Style&yaml.FlowStyle != 0 {
+			jsonStyle(&item)
+		}
+		node.Content = append(node.Content, &item)
+		return nil
+	})
+}
+
+// Grava retire_extended_until na entrada keyID do grupo, substituindo o valor
+// anterior se houver
+func extendRetirement(data []byte, issuer, group, keyID string, until time.Time) ([]byte, error) {
+	return editKeyGroup(data, issuer, group, func(node *yaml.Node) error {
+		for _, item := range node.Content {
+			if id := mappingValue(item, "key_id"); id == nil || id.Value != keyID {
+				continue
+			}
+			var value yaml.Node
+			if err := value.Encode(until.UTC()); err != nil {
+				return err
+			}
+			if item.Style&yaml.FlowStyle != 0 {
+				jsonStyle(&value)
+			}
+			if current := mappingValue(item, "retire_extended_until"); current != nil {
+				*current = value
+				return nil
+			}
+			var key yaml.Node
+			key.Encode("retire_extended_until")
+			if item.Style&yaml.FlowStyle != 0 {
+				jsonStyle(&key)
+			}
+			item.Content = append(item.Content, &key, &value)
+			return nil
+		}
+		return fmt.Errorf("%s não encontrada em %s", keyID, group)
+	})
+}
+
+// Aplica edit à lista keys.<grupo> (ou issuers.<nome>.keys.<grupo>) e
+// serializa o documento de volta
+func editKeyGroup(data []byte, issuer, group string, edit func(node *yaml.Node) error) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, ErrEmptyConfig
+	}
+
+	path := []string{"keys", group}
+	if issuer != "" {
+		path = append([]string{"issuers", issuer}, path...)
+	}
+	node := doc.Content[0]
+	for _, key := range path {
+		if node = mappingValue(node, key); node == nil {
+			return nil, fmt.Errorf("%s não encontrado na configuração", strings.Join(path, "."))
+		}
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s não é uma lista", strings.Join(path, "."))
+	}
+	if err := edit(node); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Configurações em JSON continuam JSON: entradas novas em estilo flow com
+// todos os escalares entre aspas
+func jsonStyle(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		node.Style = yaml.FlowStyle
+	case yaml.ScalarNode:
+		node.Style, node.Tag = yaml.DoubleQuotedStyle, "!!str"
+	}
+	for _, child := range node.Content {
+		jsonStyle(child)
+	}
+}
@@ -0,0 +1,390 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func TestPlanRotations(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.AddDate(0, 0, n) }
+	policy := map[string]RotationPolicy{"jwt": {MaxKeyAgeDays: 90, OverlapDays: 7}}
+
+	tests := []struct {
+		name      string
+		cfg       *Config
+		wantAlias []string
+		wantUse   time.Time
+	}{
+		{"sem max_key_age_days", &Config{Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/a", UseFrom: days(-300)}},
+		}}, nil, time.Time{}},
+		{"longe da aposentadoria", &Config{RotationPolicies: policy, Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/a", UseFrom: days(-30)}},
+		}}, nil, time.Time{}},
+		{"dentro do prazo padrão de 7 dias", &Config{RotationPolicies: policy, Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/a", UseFrom: days(-85)}},
+		}}, []string{"alias/lambda-ca/jwt/20250606"}, days(5)},
+		{"sucessora já configurada", &Config{RotationPolicies: policy, Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/b", UseFrom: days(5)}, {KeyID: "alias/a", UseFrom: days(-85)}},
+		}}, nil, time.Time{}},
+		{"chave revogada não conta como sucessora", &Config{RotationPolicies: policy, Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/a", UseFrom: days(-85)}, {KeyID: "alias/b", UseFrom: days(-1), RevokedAt: days(-1)}},
+		}}, []string{"alias/lambda-ca/jwt/20250606"}, days(5)},
+		{"rotate_lead_days e alias_prefix", &Config{
+			RotationPolicies: map[string]RotationPolicy{"jwks": {MaxKeyAgeDays: 90, RotateLeadDays: 30, AliasPrefix: "alias/passport/"}},
+			Keys:             map[string][]KeyEntry{"jwks": {{KeyID: "alias/a", UseFrom: days(-70)}}},
+		}, []string{"alias/passport/jwks/20250621"}, days(20)},
+		{"atrasada sem publish_lead_days entra em uso na execução", &Config{RotationPolicies: policy, Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/a", UseFrom: days(-100)}},
+		}}, []string{"alias/lambda-ca/jwt/20250601"}, days(0)},
+		{"atrasada espera publish_lead_days", &Config{
+			RotationPolicies: map[string]RotationPolicy{"jwt": {MaxKeyAgeDays: 90, PublishLeadDays: 3}},
+			Keys:             map[string][]KeyEntry{"jwt": {{KeyID: "alias/a", UseFrom: days(-100)}}},
+		}, []string{"alias/lambda-ca/jwt/20250604"}, days(3)},
+		{"issuer usa o nome no alias", &Config{Issuers: map[string]*Config{"produto-a": {RotationPolicies: policy, Keys: map[string][]KeyEntry{
+			"jwt": {{KeyID: "alias/a", UseFrom: days(-88)}},
+		}}}}, []string{"alias/lambda-ca/produto-a/jwt/20250603"}, days(2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := PlanRotations(tt.cfg, now)
+			if len(steps) != len(tt.wantAlias) {
+				t.Fatalf("esperado %d rotações, obtido %+v", len(tt.wantAlias), steps)
+			}
+			for i, step := range steps {
+				if step.Alias != tt.wantAlias[i] || !step.UseFrom.Equal(tt.wantUse) {
+					t.Errorf("rotação = %s em %s, esperado %s em %s", step.Alias, step.UseFrom, tt.wantAlias[i], tt.wantUse)
+				}
+				if step.PublishFrom.After(step.UseFrom) || step.PublishFrom.Before(now) {
+					t.Errorf("publish_from = %s, esperado entre %s e %s", step.PublishFrom, now, step.UseFrom)
+				}
+				if step.Previous.KeyID != "alias/a" {
+					t.Errorf("chave anterior = %s, esperado alias/a", step.Previous.KeyID)
+				}
+			}
+		})
+	}
+}
+
+const rotationYAML = `# chaves da CA
+issuer: ca.internal
+rotation_policy:
+  jwt:
+    max_key_age_days: 90
+    overlap_days: 7
+keys:
+  jwt:
+    # chave de lançamento
+    - key_id: alias/jwt-inicial
+      alg: ES256
+      use_from: %s
+  jose:
+    - key_id: alias/jose
+      use_from: 2024-01-01T00:00:00Z
+`
+
+func newRotationFixture(t *testing.T, now time.Time) (*softkms.Client, *FileSource) {
+	client := softkms.New(softkms.WithStrictKeys())
+	ctx := context.Background()
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{KeySpec: types.KeySpecEccNistP256, KeyUsage: types.KeyUsageTypeSignVerify})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String("alias/jwt-inicial"), TargetKeyId: created.KeyMetadata.KeyId})
+
+	path := t.TempDir() + "/kms-keys.yaml"
+	data := strings.Replace(rotationYAML, "%s", now.AddDate(0, 0, -85).Format(time.RFC3339), 1)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return client, &FileSource{Path: path}
+}
+
+func TestRotationJob_Run(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	client, source := newRotationFixture(t, now)
+
+	var audit bytes.Buffer
+	job, err := NewRotationJob(client, source, MockClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := job.WithAudit(&audit).Run(ctx)
+	if err != nil {
+		t.Fatalf("erro na rotação: %v", err)
+	}
+	if len(result.Records) != 1 {
+		t.Fatalf("esperada uma rotação, obtido %+v", result.Records)
+	}
+
+	var record RotationRecord
+	if err := json.Unmarshal(audit.Bytes(), &record); err != nil {
+		t.Fatalf("auditoria deveria ser uma linha JSON: %q", audit.String())
+	}
+	if record.KeyID != "alias/lambda-ca/jwt/20250606" || record.PreviousKeyID != "alias/jwt-inicial" ||
+		record.KeySpec != "ECC_NIST_P256" || record.KeyARN == "" || record.ConfigVersion != result.ConfigVersion {
+		t.Errorf("registro de auditoria inesperado: %+v", record)
+	}
+
+	described, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(record.KeyID)})
+	if err != nil || described.KeyMetadata.KeyUsage != types.KeyUsageTypeSignVerify {
+		t.Fatalf("alias novo deveria apontar para chave de assinatura: %v", err)
+	}
+
+	data, _ := os.ReadFile(source.Path)
+	if !strings.Contains(string(data), "# chave de lançamento") {
+		t.Errorf("comentários deveriam ser preservados:\n%s", data)
+	}
+	cfg, err := source.Load(ctx)
+	if err != nil {
+		t.Fatalf("configuração gravada inválida: %v", err)
+	}
+	entries := cfg.Keys["jwt"]
+	if len(entries) != 2 || entries[1].KeyID != record.KeyID || entries[1].Alg != "ES256" || !entries[1].UseFrom.Equal(record.UseFrom) {
+		t.Errorf("entrada nova inesperada: %+v", entries)
+	}
+
+	// Com a sucessora configurada não há nada a fazer
+	again, err := job.Run(ctx)
+	if err != nil || len(again.Records) != 0 {
+		t.Errorf("segunda execução deveria ser vazia, obtido %+v (%v)", again.Records, err)
+	}
+}
+
+func TestRotationJob_AposAposentadoria(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	client, source := newRotationFixture(t, now)
+	data, _ := os.ReadFile(source.Path)
+	data = []byte(strings.Replace(string(data), "overlap_days: 7", "overlap_days: 7\n    publish_lead_days: 2", 1))
+	if err := os.WriteFile(source.Path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A anterior se aposentou em 06/06; o job só roda dez dias depois
+	late := now.AddDate(0, 0, 10)
+	job, err := NewRotationJob(client, source, MockClock(late))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := job.Run(ctx)
+	if err != nil {
+		t.Fatalf("erro na rotação: %v", err)
+	}
+	record := result.Records[0]
+	if !record.UseFrom.Equal(late.AddDate(0, 0, 2)) || !record.PublishFrom.Equal(late) {
+		t.Errorf("esperado use_from %s e publish_from %s, obtido %s e %s", late.AddDate(0, 0, 2), late, record.UseFrom, record.PublishFrom)
+	}
+
+	cfg, err := source.Load(ctx)
+	if err != nil {
+		t.Fatalf("configuração gravada inválida: %v", err)
+	}
+	entries := cfg.GroupEntries("jwt")
+	successor := entries[len(entries)-1]
+	if successor.KeyID != record.KeyID || !successor.PublishFrom.Equal(late) {
+		t.Fatalf("entrada nova inesperada: %+v", successor)
+	}
+	if !successor.PublishFrom.Before(successor.UseFrom) {
+		t.Errorf("sucessora deveria ser publicada antes de assinar: %+v", successor)
+	}
+
+	// A anterior segue assinando até a sucessora entrar em uso
+	previous := entries[0]
+	if !record.Extended || !previous.RetireExtendedUntil.Equal(successor.UseFrom) || !previous.RetireAt.Equal(successor.UseFrom) {
+		t.Errorf("anterior deveria ser prorrogada até %s: %+v", successor.UseFrom, previous)
+	}
+	holder := NewKeyHolder(&kms.GetPublicKeyOutput{}, nil, previous)
+	if !holder.UsableAt(late) || !holder.UsableAt(successor.UseFrom.Add(-time.Second)) || holder.UsableAt(successor.UseFrom) {
+		t.Errorf("anterior deveria assinar até %s: %+v", successor.UseFrom, previous)
+	}
+}
+
+func TestRotationJob_DryRun(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	client, source := newRotationFixture(t, now)
+	before, _ := os.ReadFile(source.Path)
+
+	job, _ := NewRotationJob(client, source, MockClock(now))
+	result, err := job.WithDryRun().Run(ctx)
+	if err != nil || len(result.Records) != 1 || !result.Records[0].DryRun {
+		t.Fatalf("esperada uma rotação simulada, obtido %+v (%v)", result, err)
+	}
+	if after, _ := os.ReadFile(source.Path); !bytes.Equal(before, after) {
+		t.Error("simulação não deveria gravar a configuração")
+	}
+	if _, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(result.Records[0].KeyID)}); err == nil {
+		t.Error("simulação não deveria criar chaves")
+	}
+}
+
+// Origem cuja primeira gravação falha
+type failingWriter struct {
+	*FileSource
+	failures int
+}
+
+func (w *failingWriter) Write(ctx context.Context, data []byte, version string) error {
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("falha simulada na gravação")
+	}
+	return w.FileSource.Write(ctx, data, version)
+}
+
+func TestRotationJob_RerunAposFalhaNaGravacao(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	client, file := newRotationFixture(t, now)
+	source := &failingWriter{FileSource: file, failures: 1}
+
+	job, _ := NewRotationJob(client, source, MockClock(now))
+	first, err := job.Run(ctx)
+	if err == nil || len(first.Records) != 1 || first.Records[0].KeyARN == "" {
+		t.Fatalf("primeira execução deveria criar a chave e falhar ao gravar, obtido %+v (%v)", first, err)
+	}
+
+	second, err := job.Run(ctx)
+	if err != nil || len(second.Records) != 1 {
+		t.Fatalf("segunda execução deveria concluir a rotação, obtido %+v (%v)", second, err)
+	}
+	record := second.Records[0]
+	if !record.Reused || record.KeyARN != first.Records[0].KeyARN {
+		t.Errorf("deveria reaproveitar a chave %s, obtido %+v", first.Records[0].KeyARN, record)
+	}
+	cfg, err := file.Load(ctx)
+	if err != nil || len(cfg.Keys["jwt"]) != 2 || cfg.Keys["jwt"][1].KeyID != record.KeyID {
+		t.Errorf("configuração deveria ter a sucessora: %+v (%v)", cfg, err)
+	}
+
+	// Alias ocupado por uma chave de outra spec não é reaproveitado
+	other, otherFile := newRotationFixture(t, now)
+	created, _ := other.CreateKey(ctx, &kms.CreateKeyInput{KeySpec: types.KeySpecRsa2048, KeyUsage: types.KeyUsageTypeSignVerify})
+	other.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String(record.KeyID), TargetKeyId: created.KeyMetadata.KeyId})
+	job, _ = NewRotationJob(other, otherFile, MockClock(now))
+	if _, err := job.Run(ctx); err == nil || !strings.Contains(err.Error(), "já existe") {
+		t.Errorf("esperado erro de alias com spec diferente, obtido %v", err)
+	}
+}
+
+// Cliente cuja primeira réplica na região informada falha
+type failingReplica struct {
+	*softkms.Client
+	region string
+}
+
+func (c *failingReplica) ReplicateKey(ctx context.Context, in *kms.ReplicateKeyInput, optFns ...func(*kms.Options)) (*kms.ReplicateKeyOutput, error) {
+	if aws.ToString(in.ReplicaRegion) == c.region {
+		c.region = ""
+		return nil, errors.New("falha simulada na réplica")
+	}
+	return c.Client.ReplicateKey(ctx, in, optFns...)
+}
+
+func TestRotationJob_Replicas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	client := softkms.New(softkms.WithStrictKeys())
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec: types.KeySpecEccNistP256, KeyUsage: types.KeyUsageTypeSignVerify, MultiRegion: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String("alias/jwt-inicial"), TargetKeyId: created.KeyMetadata.KeyId})
+	var replicas []string
+	for _, region := range []string{"sa-east-1", "us-west-2"} {
+		out, err := client.ReplicateKey(ctx, &kms.ReplicateKeyInput{KeyId: created.KeyMetadata.KeyId, ReplicaRegion: aws.String(region)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, aws.ToString(out.ReplicaKeyMetadata.Arn))
+	}
+
+	source := &FileSource{Path: t.TempDir() + "/kms-keys.yaml"}
+	data := fmt.Sprintf(`issuer: ca.internal
+rotation_policy:
+  jwt:
+    max_key_age_days: 90
+keys:
+  jwt:
+    - key_id: alias/jwt-inicial
+      use_from: %s
+      replicas: [%s]
+`, now.AddDate(0, 0, -85).Format(time.RFC3339), strings.Join(replicas, ", "))
+	if err := os.WriteFile(source.Path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A réplica em us-west-2 falha na primeira execução; a segunda reaproveita
+	// a chave e a réplica já criadas e cria só a que faltou
+	job, _ := NewRotationJob(&failingReplica{Client: client, region: "us-west-2"}, source, MockClock(now))
+	first, err := job.Run(ctx)
+	if err == nil || len(first.Records) != 1 || len(first.Records[0].Replicas) != 1 {
+		t.Fatalf("primeira execução deveria falhar na segunda réplica, obtido %+v (%v)", first, err)
+	}
+	second, err := job.Run(ctx)
+	if err != nil || len(second.Records) != 1 {
+		t.Fatalf("segunda execução deveria concluir a rotação, obtido %+v (%v)", second, err)
+	}
+	record := second.Records[0]
+	if !record.Reused || len(record.Replicas) != 2 || record.Replicas[0] != first.Records[0].Replicas[0] {
+		t.Fatalf("réplicas inesperadas: %+v", record)
+	}
+	for i, region := range []string{"sa-east-1", "us-west-2"} {
+		if got, _ := ReplicaRegion(record.Replicas[i]); got != region {
+			t.Errorf("réplica %d na região %s, esperado %s", i, got, region)
+		}
+	}
+
+	described, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(record.KeyID)})
+	if err != nil || !aws.ToBool(described.KeyMetadata.MultiRegion) || len(described.KeyMetadata.MultiRegionConfiguration.ReplicaKeys) != 2 {
+		t.Errorf("sucessora deveria ser multirregião com 2 réplicas: %+v (%v)", described, err)
+	}
+	cfg, err := source.Load(ctx)
+	if err != nil {
+		t.Fatalf("configuração gravada inválida: %v", err)
+	}
+	if entries := cfg.Keys["jwt"]; len(entries) != 2 || !slices.Equal(entries[1].Replicas, record.Replicas) {
+		t.Errorf("entrada nova deveria listar as réplicas %v: %+v", record.Replicas, entries)
+	}
+}
+
+func TestAppendKeyEntry_JSON(t *testing.T) {
+	data := []byte(`{"issuer":"ca.internal","keys":{"jwt":[{"key_id":"alias/a","use_from":"2024-01-01T00:00:00Z"}]}}`)
+	entry := KeyEntry{KeyID: "alias/b", UseFrom: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}
+
+	updated, err := appendKeyEntry(data, "", "jwt", entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Keys map[string][]map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(updated, &doc); err != nil {
+		t.Fatalf("configuração em JSON deveria continuar JSON: %v\n%s", err, updated)
+	}
+	if got := doc.Keys["jwt"]; len(got) != 2 || got[1]["key_id"] != "alias/b" || got[1]["use_from"] != "2024-04-01T00:00:00Z" {
+		t.Errorf("entrada nova inesperada: %v", got)
+	}
+
+	if _, err := appendKeyEntry(data, "produto-a", "jwt", entry); err == nil {
+		t.Error("esperado erro para issuer ausente")
+	}
+}
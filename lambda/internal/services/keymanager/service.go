@@ -2,19 +2,16 @@ package keymanager
 
 import (
 	"context"
+	"encoding/json"
 	"encoding/pem"
-	"github.com/aws/aws-sdk-go-v2/service/kms"
-	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+	"fmt"
 
 	"lambda-ca-kms/internal/entities/services"
 	"time"
 )
 
 type keyManager struct {
-	jwtKeys           []*KeyHolder
-	joseKeys          []*KeyHolder
-	jwksKeys          []*KeyHolder
-	issuer            string
+	keys              *KeyStore
 	expireInHours     int
 	skewTimeInSeconds int
 	clock             Clock
@@ -22,83 +19,136 @@ type keyManager struct {
 
 var _ services.KeyManager = (*keyManager)(nil)
 
+// Snapshot usado do início ao fim de cada chamada
+func (k *keyManager) snapshot() (*KeySet, error) {
+	set := k.keys.Current()
+	if set == nil {
+		return nil, ErrNoKeySet
+	}
+	return set, nil
+}
+
 func (k *keyManager) JWKSCurrent(ctx context.Context) (string, error) {
-	signKeys, jwksSigner := k.currentKeys()
+	set, err := k.snapshot()
+	if err != nil {
+		return "", err
+	}
+	now := k.clock.Now()
+	set.ConfirmPublished(ctx, now)
+	signKeys, jwksSigner := currentKeys(set, now)
+	if jwksSigner == nil {
+		return "", fmt.Errorf("%w: jwks", ErrNoActiveKey)
+	}
+	if certs := set.Certificates(); certs != nil {
+		certs.Attach(signKeys)
+	}
 	return BuildJWKS(signKeys, &JWKSConfig{
-		issuer:            k.issuer,
+		issuer:            set.Issuer(),
 		expireInHours:     k.expireInHours,
 		skewTimeInSeconds: k.skewTimeInSeconds,
+		kid:               jwksSigner.Kid(),
 	}, jwksSigner.SigningMethod(), jwksSigner.WithContext(ctx))
 
 }
 
-func (k *keyManager) currentKeys() ([]*JWKSEntry, *KeyHolder) {
-	visibleKeys := GetVisibleAt(k.jwtKeys, k.clock.Now())
-	entries := make([]*JWKSEntry, len(visibleKeys)+1)
-	entries[0] = &JWKSEntry{GetActiveKey(k.joseKeys, k.clock.Now()), "enc"}
-	for i := range GetVisibleAt(visibleKeys, k.clock.Now()) {
-		entries[i+1] = &JWKSEntry{visibleKeys[i], "sig"}
-	}
-	jwksSigner := GetActiveKey(k.jwksKeys, k.clock.Now())
-	return entries, jwksSigner
+func currentKeys(set *KeySet, now time.Time) ([]*JWKSEntry, *KeyHolder) {
+	return PublishedEntries(set.Group("jwt"), set.Group("jose"), now), set.Active("jwks", now)
 }
 
-func (k *keyManager) JWKSPublicKey(ctx context.Context) ([]byte, error) {
-	out := GetActiveKey(k.jwksKeys, k.clock.Now()).PubKey
-	pemBlock := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: out.PublicKey})
-	return pemBlock, nil
+// Regras de visibilidade do JWKS, assinado ou não: todas as chaves de
+// assinatura ainda válidas e a chave de cifragem ativa, se houver
+func PublishedEntries(sigKeys, encKeys []*KeyHolder, now time.Time) []*JWKSEntry {
+	var entries []*JWKSEntry
+	if enc := GetActiveKey(encKeys, now); enc != nil {
+		entries = append(entries, NewJWKSEntry(enc, "enc"))
+	}
+	for _, key := range GetVisibleAt(sigKeys, now) {
+		entries = append(entries, NewJWKSEntry(key, "sig"))
+	}
+	return entries
 }
 
-func (k *keyManager) IssuerConfig(ctx context.Context) ([]byte, error) {
-	return buildIssuerConfig(
-		GetVisibleAt(k.jwtKeys, k.clock.Now()),
-		GetActiveKey(k.jwksKeys, k.clock.Now()))
+// JWKS sem assinatura ({"keys":[...]}), para verificadores OIDC/JOSE padrão
+func (k *keyManager) JWKSet(ctx context.Context) ([]byte, error) {
+	set, err := k.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	now := k.clock.Now()
+	set.ConfirmPublished(ctx, now)
+	entries, _ := currentKeys(set, now)
+	if certs := set.Certificates(); certs != nil {
+		certs.Attach(entries)
+	}
+	jwks, err := BuildJWKSet(entries)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jwks)
 }
 
-func NewKeyManager(ctx context.Context, kmsClient *kms.Client, cfg *Config) (*keyManager, error) {
-	jwtKeyGroup, err := fillKeyGroup(ctx, kmsClient, ApplyExpirationPolicy(cfg.Keys["jwt"], cfg.ExpiresPolicy.OverlapDays))
+func (k *keyManager) Discovery(ctx context.Context) ([]byte, error) {
+	set, err := k.snapshot()
 	if err != nil {
 		return nil, err
 	}
-	joseKeyGroup, err := fillKeyGroup(ctx, kmsClient, ApplyExpirationPolicy(cfg.Keys["jose"], cfg.ExpiresPolicy.OverlapDays))
+	now := k.clock.Now()
+	set.ConfirmPublished(ctx, now)
+	doc, err := set.Discovery(now)
 	if err != nil {
 		return nil, err
 	}
-	jwksKeyGroup, err := fillKeyGroup(ctx, kmsClient, ApplyExpirationPolicy(cfg.Keys["jwks"], cfg.ExpiresPolicy.OverlapDays))
+	return json.Marshal(doc)
+}
+
+func (k *keyManager) JWKSPublicKey(ctx context.Context) ([]byte, error) {
+	set, err := k.snapshot()
 	if err != nil {
 		return nil, err
 	}
-	km := &keyManager{
-		jwtKeys:  jwtKeyGroup,
-		joseKeys: joseKeyGroup,
-		jwksKeys: jwksKeyGroup,
-		clock:    ReealClock(),
+	signer := set.Active("jwks", k.clock.Now())
+	if signer == nil {
+		return nil, fmt.Errorf("%w: jwks", ErrNoActiveKey)
 	}
-	return km, nil
+	out := signer.PubKey
+	pemBlock := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: out.PublicKey})
+	return pemBlock, nil
 }
 
-func fillKeyGroup(ctx context.Context, client jwtkms.KMSClient, entries []KeyEntry) ([]*KeyHolder, error) {
-	keyGroup := []*KeyHolder{}
-	for _, entry := range entries {
-		pubKey, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
-			KeyId: &entry.KeyID,
-		})
-		if err != nil {
-			return nil, err
-		}
-		cfg := jwtkms.NewKMSConfig(client, entry.KeyID, false)
+func (k *keyManager) IssuerConfig(ctx context.Context) ([]byte, error) {
+	set, err := k.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return buildIssuerConfig(set.Issuer(), set.Group("jwt"), set.Group("jose"), set.Group("jwks"), k.clock.Now())
+}
 
-		kw := NewKeyHolder(pubKey, cfg, entry)
-		keyGroup = append(keyGroup, kw)
+// Recarrega cfg a cada reloadTTL (zero desativa), sem interromper chamadas em curso
+func NewKeyManager(ctx context.Context, kmsClient KeyClient, cfg *Config, reloadTTL time.Duration) (*keyManager, error) {
+	clock := ReealClock()
+	loader := NewKeyLoader(kmsClient, DefaultRetryPolicy, clock).WithCertificateCache(NewMemoryCertificateCache())
+	store := NewKeyStore(func(ctx context.Context) (*KeySet, error) {
+		return loader.LoadKeySet(ctx, cfg)
+	}, reloadTTL, clock)
+	if err := store.Reload(ctx); err != nil {
+		return nil, err
 	}
-	return keyGroup, nil
+	return &keyManager{keys: store, clock: clock}, nil
 }
 
-// Recupera a chave ativa no momento
+// Uso publicado no JWKS para cada grupo de chaves do YAML
+var GroupUses = map[string]string{
+	"jwt":  "sig",
+	"jose": "enc",
+	"jwks": "sig",
+}
+
+// Recupera a chave ativa no momento; chaves aposentadas (retire_at) ou
+// revogadas nunca são escolhidas para assinar
 func GetActiveKey(keys []*KeyHolder, now time.Time) *KeyHolder {
 	var active *KeyHolder
 	for _, k := range keys {
-		if (k.UseFrom.Before(now) || k.UseFrom.Equal(now)) &&
+		if k.UsableAt(now) &&
 			(active == nil || k.UseFrom.After(active.UseFrom)) {
 			active = k
 		}
@@ -106,41 +156,90 @@ func GetActiveKey(keys []*KeyHolder, now time.Time) *KeyHolder {
 	return active
 }
 
-// Recupera todas as chaves ainda válidas
+// Recupera todas as chaves publicadas e ainda válidas; chaves revogadas saem
+// do JWKS imediatamente e chaves do cache só entram depois de conferidas
+// (KeySet.ConfirmPublished)
 func GetVisibleAt(keys []*KeyHolder, now time.Time) []*KeyHolder {
 	var visible []*KeyHolder
 	for _, k := range keys {
-		if k.ExpiresAt.After(now) {
+		if k.PublishedAt(now) && k.Trusted() {
 			visible = append(visible, k)
 		}
 	}
 	return visible
 }
 
+// Política só com overlap_days, mantida para quem chama com o valor global
 func ApplyExpirationPolicy(entries []KeyEntry, overlapDays int) []KeyEntry {
-	if len(entries) == 0 {
-		return entries
-	}
-	for i := 0; i < len(entries)-1; i++ {
-		nextUse := entries[i+1].UseFrom
-		entries[i].ExpiresAt = nextUse.AddDate(0, 0, overlapDays)
-	}
-	entries[len(entries)-1].ExpiresAt = entries[len(entries)-1].UseFrom.AddDate(10, 0, 0) // default: 10 anos
-	return entries
+	return ApplyRotationPolicy(entries, RotationPolicy{OverlapDays: overlapDays})
 }
 
 // Representa uma entrada de chave no YAML
 type KeyEntry struct {
-	KeyID     string    `yaml:"key_id"`
-	UseFrom   time.Time `yaml:"use_from"`
-	ExpiresAt time.Time `yaml:"-"` // calculado automaticamente
+	KeyID       string      `yaml:"key_id"`
+	Alg         string      `yaml:"alg,omitempty"` // opcional: ES256, PS384, RS512...
+	Kid         string      `yaml:"kid,omitempty"` // usado com kid_strategy explicit
+	KidStrategy KidStrategy `yaml:"kid_strategy,omitempty"`
+	UseFrom     time.Time   `yaml:"use_from"`
+	PublishFrom time.Time   `yaml:"publish_from,omitempty"` // padrão: publicada desde o carregamento
+	RetireAt    time.Time   `yaml:"retire_at,omitempty"`    // deixa de assinar, mas segue publicada até expirar
+	RevokedAt   time.Time   `yaml:"revoked_at,omitempty"`   // revogação emergencial: sai do JWKS e não assina
+	Reason      string      `yaml:"reason,omitempty"`       // motivo da revogação
+	Replicas    []string    `yaml:"replicas,omitempty"`     // ARNs das réplicas multirregião, em ordem de failover
+	ExpiresAt   time.Time   `yaml:"-"`                      // calculado automaticamente
+
+	// Prorroga max_key_age_days até a sucessora entrar em uso; gravado pela
+	// rotação automática quando ela roda depois da aposentadoria
+	RetireExtendedUntil time.Time `yaml:"retire_extended_until,omitempty"`
 }
 
 // Configuração do YAML
 type Config struct {
-	Issuer        string                `yaml:"issuer"`
-	Keys          map[string][]KeyEntry `yaml:"keys"`
-	ExpiresPolicy struct {
-		OverlapDays int `yaml:"overlap_days"`
-	} `yaml:"expires_policy"`
+	Issuer           string                    `yaml:"issuer"`
+	KMSBackend       string                    `yaml:"kms_backend"`  // "aws" (padrão) ou "software"
+	KidStrategy      KidStrategy               `yaml:"kid_strategy"` // padrão das entradas: thumbprint, explicit ou legacy
+	SoftwareKMS      SoftwareKMSConfig         `yaml:"software_kms"`
+	Certificates     *CertificateConfig        `yaml:"certificates"`      // ausente: JWKS sem x5c
+	PubKeyCache      *PublicKeyCacheConfig     `yaml:"public_key_cache"`  // ausente: GetPublicKey a cada carregamento
+	CertStore        string                    `yaml:"certificate_store"` // s3://bucket/prefixo; ausente: backend de public_key_cache
+	Keys             map[string][]KeyEntry     `yaml:"keys"`
+	ExpiresPolicy    RotationPolicy            `yaml:"expires_policy"`  // padrão de todos os grupos
+	RotationPolicies map[string]RotationPolicy `yaml:"rotation_policy"` // por grupo (jwt, jose, jwks)
+	TokenPolicy      TokenPolicy               `yaml:"token_policy"`    // claims aceitas em /sign-jwt
+	Profiles         map[string]TokenProfile   `yaml:"token_profiles"`  // formatos de token por nome (/sign-jwt?profile=)
+	Authorization    *AuthorizationConfig      `yaml:"authorization"`   // ausente: assinatura aberta a qualquer chamador
+	VerifyPolicy     VerifyPolicy              `yaml:"verify_policy"`   // regras de /verify-jwt e /introspect
+	Introspection    *IntrospectionConfig      `yaml:"introspection"`   // clientes de /introspect; ausente: nenhum
+
+	// Issuers adicionais da mesma implantação, por nome. Cada um tem issuer,
+	// chaves, política de expiração e certificados próprios; backend do KMS,
+	// cache de chaves públicas e certificate_store são sempre os do nível raiz.
+	Issuers map[string]*Config `yaml:"issuers"`
+
+	// Roteamento de um issuer de "issuers": requisições com o Host listado ou
+	// sob o prefixo de caminho (padrão "/<nome>") usam as chaves dele
+	Hosts      []string `yaml:"hosts"`
+	PathPrefix string   `yaml:"path_prefix"`
+
+	// Versão do conteúdo lido, preenchida pela ConfigSource
+	Version string `yaml:"-"`
+}
+
+// Entradas do grupo com a política de expiração e a kid_strategy padrão aplicadas
+func (c *Config) GroupEntries(group string) []KeyEntry {
+	entries := ApplyRotationPolicy(c.Keys[group], c.Policy(group))
+	for i := range entries {
+		if entries[i].KidStrategy == "" && entries[i].Kid == "" {
+			entries[i].KidStrategy = c.KidStrategy
+		}
+	}
+	return entries
+}
+
+// Chaves locais usadas quando kms_backend é "software"
+type SoftwareKMSConfig struct {
+	KeyDir         string            `yaml:"key_dir"`
+	DefaultKeySpec string            `yaml:"default_key_spec"`
+	KeySpecs       map[string]string `yaml:"key_specs"`  // KeyId -> spec do KMS (ex.: RSA_2048)
+	KeyUsages      map[string]string `yaml:"key_usages"` // KeyId -> KeyUsage (padrão do jose deduzido da spec)
 }
@@ -1,6 +1,7 @@
 package keymanager
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -35,6 +36,81 @@ func TestGetSignerAtAndVisible(t *testing.T) {
 	})
 }
 
+func TestGetActiveKey_CicloDeVida(t *testing.T) {
+	now := mustParse(t, "2025-03-01T00:00:00Z")
+	until := mustParse(t, "2026-01-01T00:00:00Z")
+
+	tests := []struct {
+		name        string
+		keys        []*KeyHolder
+		wantActive  string
+		wantVisible []string
+	}{
+		{
+			name: "publish_from antecipa só a publicação",
+			keys: []*KeyHolder{
+				{keyID: "atual", UseFrom: mustParse(t, "2025-01-01T00:00:00Z"), ExpiresAt: until},
+				{keyID: "proxima", UseFrom: mustParse(t, "2025-04-01T00:00:00Z"), PublishFrom: mustParse(t, "2025-02-15T00:00:00Z"), ExpiresAt: until},
+				{keyID: "depois", UseFrom: mustParse(t, "2025-06-01T00:00:00Z"), PublishFrom: mustParse(t, "2025-05-15T00:00:00Z"), ExpiresAt: until},
+			},
+			wantActive:  "atual",
+			wantVisible: []string{"atual", "proxima"},
+		},
+		{
+			name: "retire_at deixa de assinar mas segue publicada",
+			keys: []*KeyHolder{
+				{keyID: "antiga", UseFrom: mustParse(t, "2024-01-01T00:00:00Z"), ExpiresAt: until},
+				{keyID: "aposentada", UseFrom: mustParse(t, "2025-01-01T00:00:00Z"), RetireAt: mustParse(t, "2025-02-01T00:00:00Z"), ExpiresAt: until},
+			},
+			wantActive:  "antiga",
+			wantVisible: []string{"antiga", "aposentada"},
+		},
+		{
+			name: "revoked_at remove do JWKS e da assinatura",
+			keys: []*KeyHolder{
+				{keyID: "antiga", UseFrom: mustParse(t, "2024-01-01T00:00:00Z"), ExpiresAt: until},
+				{keyID: "comprometida", UseFrom: mustParse(t, "2025-01-01T00:00:00Z"), RevokedAt: mustParse(t, "2025-02-20T00:00:00Z"), ExpiresAt: until},
+			},
+			wantActive:  "antiga",
+			wantVisible: []string{"antiga"},
+		},
+		{
+			name: "revogação futura ainda não vale",
+			keys: []*KeyHolder{
+				{keyID: "atual", UseFrom: mustParse(t, "2025-01-01T00:00:00Z"), RevokedAt: mustParse(t, "2025-04-01T00:00:00Z"), ExpiresAt: until},
+			},
+			wantActive:  "atual",
+			wantVisible: []string{"atual"},
+		},
+		{
+			name: "todas revogadas",
+			keys: []*KeyHolder{
+				{keyID: "comprometida", UseFrom: mustParse(t, "2025-01-01T00:00:00Z"), RevokedAt: mustParse(t, "2025-02-20T00:00:00Z"), ExpiresAt: until},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active := GetActiveKey(tt.keys, now)
+			switch {
+			case tt.wantActive == "" && active != nil:
+				t.Errorf("esperado nenhuma chave ativa, obtido %s", active.keyID)
+			case tt.wantActive != "" && (active == nil || active.keyID != tt.wantActive):
+				t.Errorf("esperado ativa %s, obtido %v", tt.wantActive, active)
+			}
+
+			var visible []string
+			for _, k := range GetVisibleAt(tt.keys, now) {
+				visible = append(visible, k.keyID)
+			}
+			if fmt.Sprint(visible) != fmt.Sprint(tt.wantVisible) {
+				t.Errorf("esperado visíveis %v, obtido %v", tt.wantVisible, visible)
+			}
+		})
+	}
+}
+
 func TestApplyExpirationPolicy(t *testing.T) {
 	t.Run("Política aplicada corretamente", func(t *testing.T) {
 		entries := []KeyEntry{
@@ -0,0 +1,143 @@
+package keymanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// Grupos de chaves na ordem em que são exibidos
+var Groups = []string{"jwt", "jose", "jwks"}
+
+// Estado de um grupo em um instante da linha do tempo
+type GroupState struct {
+	Active    string   // KeyId da chave ativa; vazio se não houver
+	Published []string // KeyIds visíveis no JWKS
+}
+
+// Instante em que alguma chave muda de estado
+type Transition struct {
+	At     time.Time
+	Groups map[string]GroupState
+}
+
+type TimelineWarning struct {
+	At      time.Time
+	Group   string
+	Message string
+}
+
+func (w TimelineWarning) String() string {
+	return fmt.Sprintf("%s [%s] %s", w.At.Format(time.RFC3339), w.Group, w.Message)
+}
+
+type Timeline struct {
+	Transitions []Transition
+	Warnings    []TimelineWarning
+}
+
+// Simula a rotação das chaves do YAML entre from e to, avançando um FakeClock
+// por cada transição. tokenTTL é o tempo de vida dos tokens emitidos: a chave
+// substituída precisa continuar publicada por pelo menos esse tempo.
+func PlanTimeline(cfg *Config, from, to time.Time, tokenTTL time.Duration) *Timeline {
+	groups := map[string][]*KeyHolder{}
+	for _, group := range Groups {
+		for _, entry := range cfg.GroupEntries(group) {
+			keyID := entry.KeyID
+			groups[group] = append(groups[group], NewKeyHolder(&kms.GetPublicKeyOutput{KeyId: &keyID}, nil, entry))
+		}
+	}
+
+	clock := MockClock(from)
+	timeline := &Timeline{}
+	previous := map[string]*KeyHolder{}
+
+	for _, at := range transitionTimes(groups, from, to) {
+		clock.SetTime(at)
+		now := clock.Now()
+		transition := Transition{At: now, Groups: map[string]GroupState{}}
+
+		for _, group := range Groups {
+			keys := groups[group]
+			active := GetActiveKey(keys, now)
+
+			state := GroupState{}
+			for _, k := range GetVisibleAt(keys, now) {
+				state.Published = append(state.Published, k.keyID)
+			}
+			if active != nil {
+				state.Active = active.keyID
+			}
+			transition.Groups[group] = state
+
+			timeline.Warnings = append(timeline.Warnings, checkGroup(group, active, previous[group], now, tokenTTL)...)
+			previous[group] = active
+		}
+		timeline.Transitions = append(timeline.Transitions, transition)
+	}
+	return timeline
+}
+
+func checkGroup(group string, active, previous *KeyHolder, now time.Time, tokenTTL time.Duration) []TimelineWarning {
+	var warnings []TimelineWarning
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, TimelineWarning{At: now, Group: group, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if active == nil {
+		warn("nenhuma chave ativa")
+		return warnings
+	}
+	if group == "jwks" && !active.ExpiresAt.After(now) {
+		warn("assinante do JWKS %s expirado desde %s", active.keyID, active.ExpiresAt.Format(time.RFC3339))
+	}
+	if !active.PublishedAt(now) && group != "jwks" {
+		warn("chave ativa %s não está publicada no JWKS", active.keyID)
+	}
+
+	// Tokens assinados pela chave anterior até agora precisam ser verificáveis até now+tokenTTL
+	if group == "jwt" && previous != nil && previous != active {
+		until := publishedUntil(previous)
+		if until.Before(now.Add(tokenTTL)) {
+			warn("sobreposição de %s entre %s e %s é menor que a vida do token (%s)",
+				until.Sub(now), previous.keyID, active.keyID, tokenTTL)
+		}
+	}
+	return warnings
+}
+
+// Fim da publicação: expiração ou revogação, o que vier antes
+func publishedUntil(k *KeyHolder) time.Time {
+	if !k.RevokedAt.IsZero() && k.RevokedAt.Before(k.ExpiresAt) {
+		return k.RevokedAt
+	}
+	return k.ExpiresAt
+}
+
+func transitionTimes(groups map[string][]*KeyHolder, from, to time.Time) []time.Time {
+	from = from.UTC()
+	seen := map[time.Time]bool{from: true}
+	times := []time.Time{from}
+	add := func(t time.Time) {
+		t = t.UTC()
+		if t.IsZero() || t.Before(from) || t.After(to) || seen[t] {
+			return
+		}
+		seen[t] = true
+		times = append(times, t)
+	}
+
+	for _, keys := range groups {
+		for _, k := range keys {
+			add(k.UseFrom)
+			add(k.PublishFrom)
+			add(k.RetireAt)
+			add(k.RevokedAt)
+			add(k.ExpiresAt)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
@@ -0,0 +1,110 @@
+package keymanager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanTimeline(t *testing.T) {
+	entry := func(keyID, useFrom string) KeyEntry {
+		return KeyEntry{KeyID: keyID, UseFrom: mustParse(t, useFrom)}
+	}
+
+	tests := []struct {
+		name         string
+		keys         map[string][]KeyEntry
+		overlapDays  int
+		wantWarnings []string
+	}{
+		{
+			name: "rotação saudável",
+			keys: map[string][]KeyEntry{
+				"jwt":  {entry("jwt-1", "2024-01-01T00:00:00Z"), entry("jwt-2", "2025-03-01T00:00:00Z")},
+				"jose": {entry("jose-1", "2024-01-01T00:00:00Z")},
+				"jwks": {entry("jwks-1", "2024-01-01T00:00:00Z")},
+			},
+			overlapDays: 30,
+		},
+		{
+			name: "grupo sem chave ativa no início",
+			keys: map[string][]KeyEntry{
+				"jwt":  {entry("jwt-1", "2025-02-01T00:00:00Z")},
+				"jose": {entry("jose-1", "2024-01-01T00:00:00Z")},
+				"jwks": {entry("jwks-1", "2024-01-01T00:00:00Z")},
+			},
+			overlapDays:  30,
+			wantWarnings: []string{"[jwt] nenhuma chave ativa"},
+		},
+		{
+			name: "sobreposição menor que a vida do token",
+			keys: map[string][]KeyEntry{
+				"jwt":  {entry("jwt-1", "2024-01-01T00:00:00Z"), entry("jwt-2", "2025-03-01T00:00:00Z")},
+				"jose": {entry("jose-1", "2024-01-01T00:00:00Z")},
+				"jwks": {entry("jwks-1", "2024-01-01T00:00:00Z")},
+			},
+			wantWarnings: []string{"[jwt] sobreposição de 0s entre jwt-1 e jwt-2"},
+		},
+		{
+			name: "assinante do JWKS expirado",
+			keys: map[string][]KeyEntry{
+				"jwt":  {entry("jwt-1", "2024-01-01T00:00:00Z")},
+				"jose": {entry("jose-1", "2024-01-01T00:00:00Z")},
+				"jwks": {entry("jwks-1", "2015-01-01T00:00:00Z")},
+			},
+			wantWarnings: []string{"[jwks] assinante do JWKS jwks-1 expirado"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Keys: tt.keys}
+			cfg.ExpiresPolicy.OverlapDays = tt.overlapDays
+
+			timeline := PlanTimeline(cfg, mustParse(t, "2025-01-01T00:00:00Z"), mustParse(t, "2025-12-31T00:00:00Z"), 12*time.Hour)
+			if len(timeline.Transitions) == 0 {
+				t.Fatal("esperado ao menos a transição inicial")
+			}
+
+			var got []string
+			for _, w := range timeline.Warnings {
+				got = append(got, w.String())
+			}
+			if len(got) != len(tt.wantWarnings) {
+				t.Fatalf("esperado %d alertas, obtido %v", len(tt.wantWarnings), got)
+			}
+			for i, want := range tt.wantWarnings {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("alerta %q não contém %q", got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanTimeline_Transicoes(t *testing.T) {
+	cfg := &Config{Keys: map[string][]KeyEntry{
+		"jwt": {
+			{KeyID: "jwt-1", UseFrom: mustParse(t, "2024-01-01T00:00:00Z")},
+			{KeyID: "jwt-2", UseFrom: mustParse(t, "2025-03-01T00:00:00Z"), PublishFrom: mustParse(t, "2025-02-01T00:00:00Z")},
+		},
+	}}
+	cfg.ExpiresPolicy.OverlapDays = 10
+
+	timeline := PlanTimeline(cfg, mustParse(t, "2025-01-01T00:00:00Z"), mustParse(t, "2025-06-01T00:00:00Z"), time.Hour)
+
+	var got []string
+	for _, tr := range timeline.Transitions {
+		state := tr.Groups["jwt"]
+		got = append(got, tr.At.Format("2006-01-02")+" "+state.Active+" "+strings.Join(state.Published, ","))
+	}
+	want := []string{
+		"2025-01-01 jwt-1 jwt-1",
+		"2025-02-01 jwt-1 jwt-1,jwt-2",
+		"2025-03-01 jwt-2 jwt-1,jwt-2",
+		"2025-03-11 jwt-2 jwt-2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("linha do tempo inesperada:\n%s\nesperado:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
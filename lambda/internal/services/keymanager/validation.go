@@ -0,0 +1,145 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+// Cliente do KMS usado no carregamento: o que o jwtkms precisa para assinar,
+// mais DescribeKey para validar os metadados da chave
+type KeyClient interface {
+	jwtkms.KMSClient
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+}
+
+var (
+	ErrKeyNotEnabled      = errors.New("key not enabled")
+	ErrKeyUsageMismatch   = errors.New("key usage does not match group")
+	ErrAlgorithmNotOnKey  = errors.New("algorithm not offered by key")
+	ErrKeyMetadataMissing = errors.New("key metadata unavailable")
+)
+
+// Verificação que falhou para uma entrada do YAML
+type KeyProblem struct {
+	Group string
+	KeyID string
+	Check string // get_public_key, describe_key, key_state, key_usage, algorithm, kid
+	Err   error
+}
+
+func (p KeyProblem) Error() string {
+	return fmt.Sprintf("%s/%s [%s]: %v", p.Group, p.KeyID, p.Check, p.Err)
+}
+
+func (p KeyProblem) Unwrap() error {
+	return p.Err
+}
+
+// Relatório agregado: todas as chaves são validadas antes de falhar
+type KeyValidationError struct {
+	Problems []KeyProblem
+}
+
+func (e *KeyValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("%d problema(s) nas chaves configuradas:", len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *KeyValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
+
+// nil quando não há problemas, para uso direto como error
+func newValidationError(problems []KeyProblem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &KeyValidationError{Problems: problems}
+}
+
+// Confere estado, KeyUsage e algoritmos da chave contra a finalidade do grupo
+func ValidateKey(group string, key *KeyHolder, md *types.KeyMetadata) []KeyProblem {
+	var problems []KeyProblem
+	add := func(check string, err error) {
+		problems = append(problems, KeyProblem{Group: group, KeyID: key.keyID, Check: check, Err: err})
+	}
+
+	if md.KeyState != types.KeyStateEnabled {
+		add("key_state", fmt.Errorf("%w: estado %s", ErrKeyNotEnabled, md.KeyState))
+	}
+
+	usage := md.KeyUsage
+	if usage == "" {
+		usage = key.PubKey.KeyUsage
+	}
+
+	switch use := GroupUses[group]; use {
+	case "sig":
+		alg, err := key.SigningAlgorithm()
+		if err != nil {
+			add("algorithm", err)
+			break
+		}
+		if usage != types.KeyUsageTypeSignVerify {
+			add("key_usage", fmt.Errorf("%w: %s exige %s, chave é %s", ErrKeyUsageMismatch, group, types.KeyUsageTypeSignVerify, usage))
+			break
+		}
+		offered := key.PubKey.SigningAlgorithms
+		if len(offered) == 0 {
+			offered = md.SigningAlgorithms
+		}
+		if !slices.Contains(offered, alg.KMS) {
+			add("algorithm", fmt.Errorf("%w: %s (%s) não está em %v", ErrAlgorithmNotOnKey, alg.Name, alg.KMS, offered))
+		}
+	case "enc":
+		alg, err := key.EncryptionAlgorithm()
+		if err != nil {
+			add("algorithm", err)
+			break
+		}
+		// ECDH-ES não passa pelo Decrypt: no KMS a chave precisa ser KEY_AGREEMENT
+		if alg.KMS == "" {
+			if usage != types.KeyUsageTypeKeyAgreement {
+				add("key_usage", fmt.Errorf("%w: %s exige %s, chave é %s", ErrKeyUsageMismatch, alg.Name, types.KeyUsageTypeKeyAgreement, usage))
+				break
+			}
+			offered := key.PubKey.KeyAgreementAlgorithms
+			if len(offered) == 0 {
+				offered = md.KeyAgreementAlgorithms
+			}
+			if !slices.Contains(offered, types.KeyAgreementAlgorithmSpecEcdh) {
+				add("algorithm", fmt.Errorf("%w: %s exige ECDH, chave oferece %v", ErrAlgorithmNotOnKey, alg.Name, offered))
+			}
+			break
+		}
+		if usage != types.KeyUsageTypeEncryptDecrypt {
+			add("key_usage", fmt.Errorf("%w: %s exige %s, chave é %s", ErrKeyUsageMismatch, alg.Name, types.KeyUsageTypeEncryptDecrypt, usage))
+			break
+		}
+		offered := key.PubKey.EncryptionAlgorithms
+		if len(offered) == 0 {
+			offered = md.EncryptionAlgorithms
+		}
+		if !slices.Contains(offered, alg.KMS) {
+			add("algorithm", fmt.Errorf("%w: %s (%s) não está em %v", ErrAlgorithmNotOnKey, alg.Name, alg.KMS, offered))
+		}
+	default:
+		add("key_usage", fmt.Errorf("%w: grupo %q", ErrUnsupportedKeyUse, group))
+	}
+	return problems
+}
@@ -0,0 +1,86 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func TestValidateKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	signEC := &types.KeyMetadata{
+		KeyState:          types.KeyStateEnabled,
+		KeyUsage:          types.KeyUsageTypeSignVerify,
+		SigningAlgorithms: []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256},
+	}
+	signRSAOnlyPKCS1 := &types.KeyMetadata{
+		KeyState:          types.KeyStateEnabled,
+		KeyUsage:          types.KeyUsageTypeSignVerify,
+		SigningAlgorithms: []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecRsassaPkcs1V15Sha256},
+	}
+	encRSA := &types.KeyMetadata{
+		KeyState:             types.KeyStateEnabled,
+		KeyUsage:             types.KeyUsageTypeEncryptDecrypt,
+		EncryptionAlgorithms: []types.EncryptionAlgorithmSpec{types.EncryptionAlgorithmSpecRsaesOaepSha256},
+	}
+	agreeEC := &types.KeyMetadata{
+		KeyState:               types.KeyStateEnabled,
+		KeyUsage:               types.KeyUsageTypeKeyAgreement,
+		KeyAgreementAlgorithms: []types.KeyAgreementAlgorithmSpec{types.KeyAgreementAlgorithmSpecEcdh},
+	}
+	disabled := *signEC
+	disabled.KeyState = types.KeyStatePendingDeletion
+
+	tests := []struct {
+		name       string
+		group      string
+		der        []byte
+		alg        string
+		md         *types.KeyMetadata
+		wantChecks []string
+		wantErr    error
+	}{
+		{"jwt EC válida", "jwt", ecDER, "", signEC, nil, nil},
+		{"jwks desabilitada", "jwks", ecDER, "", &disabled, []string{"key_state"}, ErrKeyNotEnabled},
+		{"jose com chave de assinatura", "jose", rsaDER, "", signRSAOnlyPKCS1, []string{"key_usage"}, ErrKeyUsageMismatch},
+		{"jwt com chave de cifragem", "jwt", rsaDER, "", encRSA, []string{"key_usage"}, ErrKeyUsageMismatch},
+		{"jwt PS256 sem PSS na chave", "jwt", rsaDER, "", signRSAOnlyPKCS1, []string{"algorithm"}, ErrAlgorithmNotOnKey},
+		{"jwt RS256 explícito", "jwt", rsaDER, "RS256", signRSAOnlyPKCS1, nil, nil},
+		{"jose RSA-OAEP-256", "jose", rsaDER, "", encRSA, nil, nil},
+		{"jose RSA-OAEP sem SHA-1 na chave", "jose", rsaDER, "RSA-OAEP", encRSA, []string{"algorithm"}, ErrAlgorithmNotOnKey},
+		{"jose ECDH-ES com KEY_AGREEMENT", "jose", ecDER, "", agreeEC, nil, nil},
+		{"jose ECDH-ES com SIGN_VERIFY", "jose", ecDER, "", signEC, []string{"key_usage"}, ErrKeyUsageMismatch},
+		{"jwt com alg incompatível", "jwt", ecDER, "PS256", signEC, []string{"algorithm"}, ErrConfiguredKeyNotSupported},
+		{"grupo desconhecido", "outro", ecDER, "", signEC, []string{"key_usage"}, ErrUnsupportedKeyUse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := NewKeyHolder(&kms.GetPublicKeyOutput{PublicKey: tt.der, KeyId: strPtr("k")}, nil, KeyEntry{KeyID: "k", Alg: tt.alg})
+			problems := ValidateKey(tt.group, key, tt.md)
+
+			var checks []string
+			for _, p := range problems {
+				checks = append(checks, p.Check)
+			}
+			if strings.Join(checks, ",") != strings.Join(tt.wantChecks, ",") {
+				t.Fatalf("esperado problemas %v, obtido %v", tt.wantChecks, problems)
+			}
+			if tt.wantErr != nil && !errors.Is(newValidationError(problems), tt.wantErr) {
+				t.Errorf("esperado erro %v no relatório, obtido %v", tt.wantErr, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package keymanager
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKid          = errors.New("token kid not in published key set")
+	ErrAlgNotAllowed       = errors.New("token alg not allowed")
+	ErrInvalidVerifyPolicy = errors.New("invalid verify policy")
+)
+
+// Política de /verify-jwt
+type VerifyPolicy struct {
+	Algorithms []string      `yaml:"algorithms"` // alg aceitos; vazio: os das chaves publicadas
+	Audiences  []string      `yaml:"audiences"`  // aud exigida quando o chamador não informa uma
+	Leeway     time.Duration `yaml:"leeway"`     // tolerância de relógio para exp e nbf
+}
+
+func (p VerifyPolicy) validate() error {
+	for _, alg := range p.Algorithms {
+		if _, ok := LookupSigningAlgorithm(alg); !ok {
+			return fmt.Errorf("%w: algoritmo desconhecido %q", ErrInvalidVerifyPolicy, alg)
+		}
+	}
+	if p.Leeway < 0 {
+		return fmt.Errorf("%w: leeway negativo", ErrInvalidVerifyPolicy)
+	}
+	return nil
+}
+
+// Valida a verify_policy do nível raiz e de cada issuer
+func (c *Config) validateVerifyPolicies() error {
+	var errs []error
+	if err := c.VerifyPolicy.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range c.IssuerNames() {
+		if err := c.Issuers[name].VerifyPolicy.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Resultado da verificação; Error é o código da falha e Reason o detalhe
+type VerifyResult struct {
+	Valid  bool          `json:"valid"`
+	Kid    string        `json:"kid,omitempty"`
+	Alg    string        `json:"alg,omitempty"`
+	Claims jwt.MapClaims `json:"claims,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// Código da falha, do mais específico ao mais genérico
+var verifyErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrUnknownKid, "unknown_kid"},
+	{ErrAlgNotAllowed, "alg_not_allowed"},
+	{jwt.ErrTokenMalformed, "malformed"},
+	{jwt.ErrTokenSignatureInvalid, "invalid_signature"},
+	{jwt.ErrTokenRequiredClaimMissing, "missing_claim"},
+	{jwt.ErrTokenExpired, "expired"},
+	{jwt.ErrTokenNotValidYet, "not_yet_valid"},
+	{jwt.ErrTokenInvalidIssuer, "invalid_issuer"},
+	{jwt.ErrTokenInvalidAudience, "invalid_audience"},
+}
+
+func verifyErrorCode(err error) string {
+	for _, c := range verifyErrorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return "invalid_token"
+}
+
+// Verifica o token com as chaves jwt publicadas em now (GetVisibleAt), sem
+// chamar o KMS. audience vazio usa verify_policy.audiences; sem nenhuma das
+// duas, aud não é conferida.
+func (s *KeySet) VerifyJWT(token, audience string, now time.Time) VerifyResult {
+	var result VerifyResult
+	keys := GetVisibleAt(s.Group("jwt"), now)
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		result.Kid, _ = t.Header["kid"].(string)
+		result.Alg = t.Method.Alg()
+		if result.Kid == "" {
+			return nil, fmt.Errorf("%w: token sem kid", ErrUnknownKid)
+		}
+		i := slices.IndexFunc(keys, func(k *KeyHolder) bool { return k.Kid() == result.Kid })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKid, result.Kid)
+		}
+		key := keys[i]
+		if !key.Trusted() {
+			// GetVisibleAt já descarta; conferido de novo por ser a base da verificação
+			return nil, fmt.Errorf("%w: %s: chave do cache não conferida pelo KMS", ErrUnknownKid, result.Kid)
+		}
+		alg, err := key.SigningAlgorithm()
+		if err != nil {
+			return nil, err
+		}
+		if alg.Name != result.Alg || !s.verifyAllows(keys, result.Alg) {
+			return nil, fmt.Errorf("%w: %s", ErrAlgNotAllowed, result.Alg)
+		}
+		return x509.ParsePKIXPublicKey(key.PubKey.PublicKey)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithTimeFunc(func() time.Time { return now }),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(s.verify.Leeway),
+	}
+	if s.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(IssuerURL(s.issuer)))
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, keyFunc, opts...)
+	if err == nil {
+		err = s.checkVerifyAudience(claims, audience)
+	}
+	if err != nil {
+		result.Error, result.Reason = verifyErrorCode(err), err.Error()
+		return result
+	}
+	result.Valid, result.Claims = true, claims
+	return result
+}
+
+// alg na lista da verify_policy ou, sem ela, usado por alguma chave publicada
+func (s *KeySet) verifyAllows(keys []*KeyHolder, alg string) bool {
+	if len(s.verify.Algorithms) > 0 {
+		return slices.Contains(s.verify.Algorithms, alg)
+	}
+	return slices.ContainsFunc(keys, func(k *KeyHolder) bool {
+		a, err := k.SigningAlgorithm()
+		return err == nil && a.Name == alg
+	})
+}
+
+// O token precisa conter a audiência pedida ou uma das da verify_policy
+func (s *KeySet) checkVerifyAudience(claims jwt.MapClaims, audience string) error {
+	expected := s.verify.Audiences
+	if audience != "" {
+		expected = []string{audience}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+	aud, _ := claims.GetAudience()
+	for _, a := range aud {
+		if slices.Contains(expected, a) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: esperado um de %v", jwt.ErrTokenInvalidAudience, expected)
+}
@@ -0,0 +1,158 @@
+package keymanager
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func TestKeySet_VerifyJWT(t *testing.T) {
+	now := mustParse(t, "2025-03-01T12:00:00Z")
+	client := softkms.New(
+		softkms.WithKeySpec("alias/atual", types.KeySpecEccNistP256),
+		softkms.WithKeySpec("alias/revogada", types.KeySpecEccNistP256),
+		softkms.WithKeySpec("alias/fora", types.KeySpecEccNistP256),
+	)
+	conf := &Config{
+		Issuer:       "ca.internal",
+		VerifyPolicy: VerifyPolicy{Audiences: []string{"api.interna"}},
+		Keys: map[string][]KeyEntry{"jwt": {
+			{KeyID: "alias/atual", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")},
+			{KeyID: "alias/revogada", UseFrom: mustParse(t, "2024-06-01T00:00:00Z"), RevokedAt: mustParse(t, "2025-02-01T00:00:00Z")},
+		}},
+	}
+	set, err := newTestLoader(client, now).LoadKeySet(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("erro no carregamento: %v", err)
+	}
+	current := set.Active("jwt", now)
+	var revoked *KeyHolder
+	for _, key := range set.Group("jwt") {
+		if key.RevokedBy(now) {
+			revoked = key
+		}
+	}
+	outsider := softHolder(t, client, "alias/fora")
+
+	sign := func(key *KeyHolder, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(key.SigningMethod(), claims)
+		token.Header["kid"] = key.Kid()
+		signed, err := token.SignedString(key.WithContext(context.Background()))
+		if err != nil {
+			t.Fatalf("falha ao assinar: %v", err)
+		}
+		return signed
+	}
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": "https://ca.internal", "sub": "svc-a", "aud": "api.interna", "iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix()}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	valid := sign(current, claims(nil))
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		policy   *VerifyPolicy
+		wantCode string // vazio: válido
+	}{
+		{"token válido", valid, "", nil, ""},
+		{"audiência pedida pelo chamador", sign(current, claims(jwt.MapClaims{"aud": []string{"faturamento", "outra"}})), "faturamento", nil, ""},
+		{"audiência errada", sign(current, claims(jwt.MapClaims{"aud": "outra"})), "", nil, "invalid_audience"},
+		{"issuer errado", sign(current, claims(jwt.MapClaims{"iss": "https://outro"})), "", nil, "invalid_issuer"},
+		{"expirado", sign(current, claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), "", nil, "expired"},
+		{"expirado dentro do leeway", sign(current, claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), "", &VerifyPolicy{Leeway: 2 * time.Minute}, ""},
+		{"ainda não válido", sign(current, claims(jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()})), "", nil, "not_yet_valid"},
+		{"sem exp", sign(current, claims(jwt.MapClaims{"exp": nil})), "", nil, "missing_claim"},
+		{"chave revogada", sign(revoked, claims(nil)), "", nil, "unknown_kid"},
+		{"chave fora do conjunto", sign(outsider, claims(nil)), "", nil, "unknown_kid"},
+		{"alg fora da lista", valid, "", &VerifyPolicy{Algorithms: []string{"ES384"}}, "alg_not_allowed"},
+		{"assinatura adulterada", valid[:strings.LastIndex(valid, ".")+1] + "AAAA" + valid[strings.LastIndex(valid, ".")+5:], "", nil, "invalid_signature"},
+		{"token malformado", "nao.e.jwt", "", nil, "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := *set
+			if tt.policy != nil {
+				verifier.verify = *tt.policy
+			}
+			result := verifier.VerifyJWT(tt.token, tt.audience, now)
+			if tt.wantCode == "" {
+				if !result.Valid || result.Kid != current.Kid() || result.Alg != "ES256" || result.Claims["sub"] != "svc-a" {
+					t.Fatalf("esperado token válido, obtido %+v", result)
+				}
+				return
+			}
+			if result.Valid || result.Error != tt.wantCode || result.Reason == "" || result.Claims != nil {
+				t.Errorf("esperado falha %s, obtido %+v", tt.wantCode, result)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_VerifyPolicy(t *testing.T) {
+	if _, err := ParseConfig([]byte("verify_policy:\n  algorithms: [ES256, PS256]\n  leeway: 30s")); err != nil {
+		t.Errorf("política válida recusada: %v", err)
+	}
+	if _, err := ParseConfig([]byte("verify_policy:\n  algorithms: [HS256]")); err == nil {
+		t.Errorf("esperado erro para algoritmo desconhecido")
+	}
+}
+
+func TestKeySet_VerifyJWT_CacheEnvenenado(t *testing.T) {
+	now := mustParse(t, "2025-03-01T12:00:00Z")
+	ctx := context.Background()
+	conf := &Config{Issuer: "ca.internal", Keys: map[string][]KeyEntry{
+		"jwt": {{KeyID: "alias/jwt", UseFrom: mustParse(t, "2025-01-01T00:00:00Z")}},
+	}}
+	attacker := softHolder(t, softkms.New(softkms.WithKeySpec("alias/jwt", types.KeySpecEccNistP256)), "alias/jwt")
+	soft := softkms.New(softkms.WithKeySpec("alias/jwt", types.KeySpecEccNistP256))
+
+	forged := jwt.NewWithClaims(attacker.SigningMethod(), jwt.MapClaims{"iss": "https://ca.internal", "sub": "intruso", "exp": now.Add(time.Minute).Unix()})
+	forged.Header["kid"] = attacker.Kid()
+	token, err := forged.SignedString(attacker.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("falha ao assinar: %v", err)
+	}
+
+	t.Run("entrada envenenada é recusada na conferência", func(t *testing.T) {
+		cache := NewMemoryPublicKeyCache()
+		cache.Put(ctx, NewCachedPublicKey("alias/jwt", attacker.PubKey, &types.KeyMetadata{KeyState: types.KeyStateEnabled}, now))
+		set, err := newTestLoader(soft, now).WithCache(cache).LoadKeySet(ctx, conf)
+		if err != nil {
+			t.Fatalf("erro no carregamento: %v", err)
+		}
+		set.ConfirmPublished(ctx, now)
+		if result := set.VerifyJWT(token, "", now); result.Valid {
+			t.Errorf("token do atacante aceito: %+v", result)
+		}
+	})
+
+	t.Run("chave do cache ainda não conferida", func(t *testing.T) {
+		cached := NewCachedPublicKey("alias/jwt", attacker.PubKey, nil, now)
+		checked, err := newCacheCheckClient(soft, NewMemoryPublicKeyCache(), cached)
+		if err != nil {
+			t.Fatalf("erro ao criar cliente: %v", err)
+		}
+		key := NewKeyHolder(cached.Output(), jwtkms.NewKMSConfig(checked, "alias/jwt", false), KeyEntry{KeyID: "alias/jwt", ExpiresAt: now.Add(time.Hour)})
+		key.cacheCheck = checked
+		set := NewKeySet("ca.internal", map[string][]*KeyHolder{"jwt": {key}}, nil, nil)
+		if result := set.VerifyJWT(token, "", now); result.Valid || result.Error != "unknown_kid" {
+			t.Errorf("token aceito com chave não conferida: %+v", result)
+		}
+	})
+}
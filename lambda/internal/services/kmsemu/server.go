@@ -0,0 +1,366 @@
+package kmsemu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+const (
+	targetPrefix = "TrentService."
+	contentType  = "application/x-amz-json-1.1"
+)
+
+// Operações do KMS emuladas; softkms.Client implementa todas
+type Backend interface {
+	jwtkms.KMSClient
+	CreateKey(ctx context.Context, in *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error)
+	CreateAlias(ctx context.Context, in *kms.CreateAliasInput, optFns ...func(*kms.Options)) (*kms.CreateAliasOutput, error)
+	DescribeKey(ctx context.Context, in *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+	ListAliases(ctx context.Context, in *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error)
+	Decrypt(ctx context.Context, in *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+	ReplicateKey(ctx context.Context, in *kms.ReplicateKeyInput, optFns ...func(*kms.Options)) (*kms.ReplicateKeyOutput, error)
+}
+
+// Server atende o subconjunto do protocolo JSON 1.1 do KMS usado pelo projeto
+type Server struct {
+	backend Backend
+}
+
+func NewServer(backend Backend) *Server {
+	return &Server{backend: backend}
+}
+
+type operation func(ctx context.Context, b Backend, body []byte) (interface{}, error)
+
+var operations = map[string]operation{
+	"CreateKey":    createKey,
+	"CreateAlias":  createAlias,
+	"GetPublicKey": getPublicKey,
+	"Sign":         sign,
+	"Verify":       verify,
+	"Decrypt":      decrypt,
+	"DescribeKey":  describeKey,
+	"ListAliases":  listAliases,
+	"ReplicateKey": replicateKey,
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "UnsupportedOperationException", "apenas POST é suportado")
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	op, ok := operations[strings.TrimPrefix(target, targetPrefix)]
+	if !ok || !strings.HasPrefix(target, targetPrefix) {
+		writeError(w, http.StatusBadRequest, "UnknownOperationException", fmt.Sprintf("operação não suportada: %s", target))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "SerializationException", err.Error())
+		return
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	out, err := op(r.Context(), s.backend, body)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			writeError(w, http.StatusBadRequest, "SerializationException", err.Error())
+			return
+		}
+		writeAPIError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	json.NewEncoder(w).Encode(out)
+}
+
+type apiError interface {
+	ErrorCode() string
+	ErrorMessage() string
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	var ae apiError
+	if errors.As(err, &ae) {
+		status := http.StatusBadRequest
+		if ae.ErrorCode() == "KMSInternalException" {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, status, ae.ErrorCode(), ae.ErrorMessage())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "KMSInternalException", err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Amzn-Errortype", code)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+}
+
+// Datas trafegam como segundos desde a época, como no SDK
+func epoch(t *time.Time) *float64 {
+	if t == nil {
+		return nil
+	}
+	v := float64(t.UnixNano()) / float64(time.Second)
+	return &v
+}
+
+type keyMetadata struct {
+	KeyId                  *string                           `json:"KeyId"`
+	Arn                    *string                           `json:"Arn,omitempty"`
+	AWSAccountId           *string                           `json:"AWSAccountId,omitempty"`
+	CreationDate           *float64                          `json:"CreationDate,omitempty"`
+	Description            *string                           `json:"Description,omitempty"`
+	Enabled                bool                              `json:"Enabled"`
+	KeyState               types.KeyState                    `json:"KeyState,omitempty"`
+	KeyUsage               types.KeyUsageType                `json:"KeyUsage,omitempty"`
+	KeySpec                types.KeySpec                     `json:"KeySpec,omitempty"`
+	CustomerMasterKeySpec  types.CustomerMasterKeySpec       `json:"CustomerMasterKeySpec,omitempty"`
+	KeyManager             types.KeyManagerType              `json:"KeyManager,omitempty"`
+	Origin                 types.OriginType                  `json:"Origin,omitempty"`
+	SigningAlgorithms      []types.SigningAlgorithmSpec      `json:"SigningAlgorithms,omitempty"`
+	EncryptionAlgorithms   []types.EncryptionAlgorithmSpec   `json:"EncryptionAlgorithms,omitempty"`
+	KeyAgreementAlgorithms []types.KeyAgreementAlgorithmSpec `json:"KeyAgreementAlgorithms,omitempty"`
+	MultiRegion            *bool                             `json:"MultiRegion,omitempty"`
+	MultiRegionConfig      *types.MultiRegionConfiguration   `json:"MultiRegionConfiguration,omitempty"`
+}
+
+func toKeyMetadata(md *types.KeyMetadata) *keyMetadata {
+	if md == nil {
+		return nil
+	}
+	return &keyMetadata{
+		KeyId:                  md.KeyId,
+		Arn:                    md.Arn,
+		AWSAccountId:           md.AWSAccountId,
+		CreationDate:           epoch(md.CreationDate),
+		Description:            md.Description,
+		Enabled:                md.Enabled,
+		KeyState:               md.KeyState,
+		KeyUsage:               md.KeyUsage,
+		KeySpec:                md.KeySpec,
+		CustomerMasterKeySpec:  md.CustomerMasterKeySpec,
+		KeyManager:             md.KeyManager,
+		Origin:                 md.Origin,
+		SigningAlgorithms:      md.SigningAlgorithms,
+		EncryptionAlgorithms:   md.EncryptionAlgorithms,
+		KeyAgreementAlgorithms: md.KeyAgreementAlgorithms,
+		MultiRegion:            md.MultiRegion,
+		MultiRegionConfig:      md.MultiRegionConfiguration,
+	}
+}
+
+func createKey(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		Description *string
+		KeySpec     types.KeySpec
+		KeyUsage    types.KeyUsageType
+		MultiRegion *bool
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.CreateKey(ctx, &kms.CreateKeyInput{Description: in.Description, KeySpec: in.KeySpec, KeyUsage: in.KeyUsage, MultiRegion: in.MultiRegion})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		KeyMetadata *keyMetadata
+	}{toKeyMetadata(out.KeyMetadata)}, nil
+}
+
+func createAlias(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		AliasName   *string
+		TargetKeyId *string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	if _, err := b.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: in.AliasName, TargetKeyId: in.TargetKeyId}); err != nil {
+		return nil, err
+	}
+	return struct{}{}, nil
+}
+
+func getPublicKey(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId *string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: in.KeyId})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		KeyId                  *string
+		KeySpec                types.KeySpec
+		KeyUsage               types.KeyUsageType
+		PublicKey              []byte
+		SigningAlgorithms      []types.SigningAlgorithmSpec      `json:",omitempty"`
+		EncryptionAlgorithms   []types.EncryptionAlgorithmSpec   `json:",omitempty"`
+		KeyAgreementAlgorithms []types.KeyAgreementAlgorithmSpec `json:",omitempty"`
+	}{out.KeyId, out.KeySpec, out.KeyUsage, out.PublicKey, out.SigningAlgorithms, out.EncryptionAlgorithms, out.KeyAgreementAlgorithms}, nil
+}
+
+func sign(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId            *string
+		Message          []byte
+		MessageType      types.MessageType
+		SigningAlgorithm types.SigningAlgorithmSpec
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.Sign(ctx, &kms.SignInput{
+		KeyId:            in.KeyId,
+		Message:          in.Message,
+		MessageType:      in.MessageType,
+		SigningAlgorithm: in.SigningAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		KeyId            *string
+		Signature        []byte
+		SigningAlgorithm types.SigningAlgorithmSpec
+	}{out.KeyId, out.Signature, out.SigningAlgorithm}, nil
+}
+
+func verify(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId            *string
+		Message          []byte
+		MessageType      types.MessageType
+		Signature        []byte
+		SigningAlgorithm types.SigningAlgorithmSpec
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.Verify(ctx, &kms.VerifyInput{
+		KeyId:            in.KeyId,
+		Message:          in.Message,
+		MessageType:      in.MessageType,
+		Signature:        in.Signature,
+		SigningAlgorithm: in.SigningAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		KeyId            *string
+		SignatureValid   bool
+		SigningAlgorithm types.SigningAlgorithmSpec
+	}{out.KeyId, out.SignatureValid, out.SigningAlgorithm}, nil
+}
+
+func decrypt(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId               *string
+		CiphertextBlob      []byte
+		EncryptionAlgorithm types.EncryptionAlgorithmSpec
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:               in.KeyId,
+		CiphertextBlob:      in.CiphertextBlob,
+		EncryptionAlgorithm: in.EncryptionAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		KeyId               *string
+		Plaintext           []byte
+		EncryptionAlgorithm types.EncryptionAlgorithmSpec
+	}{out.KeyId, out.Plaintext, out.EncryptionAlgorithm}, nil
+}
+
+func describeKey(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId *string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: in.KeyId})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		KeyMetadata *keyMetadata
+	}{toKeyMetadata(out.KeyMetadata)}, nil
+}
+
+func replicateKey(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId         *string
+		ReplicaRegion *string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.ReplicateKey(ctx, &kms.ReplicateKeyInput{KeyId: in.KeyId, ReplicaRegion: in.ReplicaRegion})
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		ReplicaKeyMetadata *keyMetadata
+	}{toKeyMetadata(out.ReplicaKeyMetadata)}, nil
+}
+
+func listAliases(ctx context.Context, b Backend, body []byte) (interface{}, error) {
+	var in struct {
+		KeyId *string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out, err := b.ListAliases(ctx, &kms.ListAliasesInput{KeyId: in.KeyId})
+	if err != nil {
+		return nil, err
+	}
+
+	type aliasEntry struct {
+		AliasArn     *string
+		AliasName    *string
+		TargetKeyId  *string
+		CreationDate *float64 `json:",omitempty"`
+	}
+	aliases := make([]aliasEntry, 0, len(out.Aliases))
+	for _, a := range out.Aliases {
+		aliases = append(aliases, aliasEntry{a.AliasArn, a.AliasName, a.TargetKeyId, epoch(a.CreationDate)})
+	}
+	return struct {
+		Aliases   []aliasEntry
+		Truncated bool
+	}{aliases, false}, nil
+}
@@ -0,0 +1,194 @@
+package kmsemu
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+
+	"lambda-ca-kms/internal/services/softkms"
+)
+
+func newTestClient(t *testing.T, statePath string) *kms.Client {
+	t.Helper()
+	backend, err := softkms.NewWithState(statePath, softkms.WithStrictKeys())
+	if err != nil {
+		t.Fatalf("erro ao abrir estado: %v", err)
+	}
+	srv := httptest.NewServer(NewServer(backend))
+	t.Cleanup(srv.Close)
+
+	return kms.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, func(o *kms.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+	})
+}
+
+func TestEmulator_SigningKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	statePath := filepath.Join(t.TempDir(), "kms-state.json")
+	client := newTestClient(t, statePath)
+
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec:  types.KeySpecEccNistP256,
+		KeyUsage: types.KeyUsageTypeSignVerify,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey falhou: %v", err)
+	}
+	if created.KeyMetadata.CreationDate == nil || created.KeyMetadata.KeyState != types.KeyStateEnabled {
+		t.Errorf("metadados incompletos: %+v", created.KeyMetadata)
+	}
+
+	if _, err := client.CreateAlias(ctx, &kms.CreateAliasInput{
+		AliasName:   aws.String("alias/jwt-signer"),
+		TargetKeyId: created.KeyMetadata.KeyId,
+	}); err != nil {
+		t.Fatalf("CreateAlias falhou: %v", err)
+	}
+
+	cfg := jwtkms.NewKMSConfig(client, "alias/jwt-signer", true)
+	signed, err := jwt.NewWithClaims(jwtkms.SigningMethodECDSA256, jwt.MapClaims{"sub": "x"}).SignedString(cfg)
+	if err != nil {
+		t.Fatalf("assinatura via emulador falhou: %v", err)
+	}
+	if _, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return cfg, nil }); err != nil {
+		t.Errorf("Verify via emulador falhou: %v", err)
+	}
+
+	described, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/jwt-signer")})
+	if err != nil {
+		t.Fatalf("DescribeKey falhou: %v", err)
+	}
+	if aws.ToString(described.KeyMetadata.Arn) != aws.ToString(created.KeyMetadata.Arn) {
+		t.Errorf("alias resolveu para outra chave: %s", aws.ToString(described.KeyMetadata.Arn))
+	}
+
+	aliases, err := client.ListAliases(ctx, &kms.ListAliasesInput{})
+	if err != nil {
+		t.Fatalf("ListAliases falhou: %v", err)
+	}
+	if len(aliases.Aliases) != 1 || aws.ToString(aliases.Aliases[0].TargetKeyId) != aws.ToString(created.KeyMetadata.KeyId) {
+		t.Errorf("aliases inesperados: %+v", aliases.Aliases)
+	}
+
+	// Reabre o estado em um novo emulador: a mesma chave deve continuar disponível
+	first, _ := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("alias/jwt-signer")})
+	reopened := newTestClient(t, statePath)
+	second, err := reopened.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("alias/jwt-signer")})
+	if err != nil {
+		t.Fatalf("chave não persistiu no arquivo de estado: %v", err)
+	}
+	if string(first.PublicKey) != string(second.PublicKey) {
+		t.Error("chave pública mudou após reabrir o estado")
+	}
+}
+
+func TestEmulator_Decrypt(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, filepath.Join(t.TempDir(), "state.json"))
+
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec:  types.KeySpecRsa2048,
+		KeyUsage: types.KeyUsageTypeEncryptDecrypt,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey falhou: %v", err)
+	}
+	pubOut, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: created.KeyMetadata.Arn})
+	if err != nil {
+		t.Fatalf("GetPublicKey falhou: %v", err)
+	}
+	pub, _ := x509.ParsePKIXPublicKey(pubOut.PublicKey)
+
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub.(*rsa.PublicKey), []byte("segredo"), nil)
+	if err != nil {
+		t.Fatalf("erro ao cifrar: %v", err)
+	}
+	out, err := client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:               created.KeyMetadata.KeyId,
+		CiphertextBlob:      ciphertext,
+		EncryptionAlgorithm: types.EncryptionAlgorithmSpecRsaesOaepSha256,
+	})
+	if err != nil {
+		t.Fatalf("Decrypt falhou: %v", err)
+	}
+	if string(out.Plaintext) != "segredo" {
+		t.Errorf("plaintext inesperado: %q", out.Plaintext)
+	}
+
+	_, err = client.Sign(ctx, &kms.SignInput{
+		KeyId:            created.KeyMetadata.KeyId,
+		Message:          make([]byte, 32),
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecRsassaPssSha256,
+	})
+	var usage *types.InvalidKeyUsageException
+	if !errors.As(err, &usage) {
+		t.Errorf("esperado InvalidKeyUsageException ao assinar com chave de cifragem, obtido %v", err)
+	}
+}
+
+func TestEmulator_UnknownKey(t *testing.T) {
+	client := newTestClient(t, filepath.Join(t.TempDir(), "state.json"))
+
+	_, err := client.GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String("alias/inexistente")})
+	var notFound *types.NotFoundException
+	if !errors.As(err, &notFound) {
+		t.Errorf("esperado NotFoundException, obtido %v", err)
+	}
+}
+
+func TestEmulator_ReplicateKey(t *testing.T) {
+	ctx := context.Background()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	client := newTestClient(t, statePath)
+
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec:     types.KeySpecEccNistP256,
+		KeyUsage:    types.KeyUsageTypeSignVerify,
+		MultiRegion: aws.Bool(true),
+	})
+	if err != nil || !aws.ToBool(created.KeyMetadata.MultiRegion) {
+		t.Fatalf("CreateKey multirregião falhou: %+v (%v)", created, err)
+	}
+	replica, err := client.ReplicateKey(ctx, &kms.ReplicateKeyInput{KeyId: created.KeyMetadata.KeyId, ReplicaRegion: aws.String("sa-east-1")})
+	if err != nil {
+		t.Fatalf("ReplicateKey falhou: %v", err)
+	}
+	if arn := aws.ToString(replica.ReplicaKeyMetadata.Arn); !strings.Contains(arn, ":sa-east-1:") {
+		t.Errorf("ARN da réplica deveria ser da região sa-east-1: %s", arn)
+	}
+	if _, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: replica.ReplicaKeyMetadata.Arn}); err != nil {
+		t.Errorf("ARN da réplica deveria ser resolvido: %v", err)
+	}
+
+	described, err := newTestClient(t, statePath).DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: created.KeyMetadata.KeyId})
+	if err != nil {
+		t.Fatalf("DescribeKey falhou: %v", err)
+	}
+	mrc := described.KeyMetadata.MultiRegionConfiguration
+	if mrc == nil || len(mrc.ReplicaKeys) != 1 || aws.ToString(mrc.ReplicaKeys[0].Region) != "sa-east-1" {
+		t.Errorf("réplica deveria persistir no estado: %+v", mrc)
+	}
+
+	_, err = client.ReplicateKey(ctx, &kms.ReplicateKeyInput{KeyId: created.KeyMetadata.KeyId, ReplicaRegion: aws.String("sa-east-1")})
+	var exists *types.AlreadyExistsException
+	if !errors.As(err, &exists) {
+		t.Errorf("esperado AlreadyExistsException para réplica repetida, obtido %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package softkms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Cria uma chave assimétrica; assim como no KMS, KeyUsage padrão é ENCRYPT_DECRYPT
+func (c *Client) CreateKey(ctx context.Context, in *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
+	usage := in.KeyUsage
+	if usage == "" {
+		usage = types.KeyUsageTypeEncryptDecrypt
+	}
+	switch usage {
+	case types.KeyUsageTypeSignVerify:
+	case types.KeyUsageTypeEncryptDecrypt:
+		if EncryptionAlgorithms(in.KeySpec) == nil {
+			return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("spec %s não suporta ENCRYPT_DECRYPT", in.KeySpec))}
+		}
+	case types.KeyUsageTypeKeyAgreement:
+		if KeyAgreementAlgorithms(in.KeySpec) == nil {
+			return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("spec %s não suporta KEY_AGREEMENT", in.KeySpec))}
+		}
+	default:
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("KeyUsage não suportado: %s", usage))}
+	}
+
+	priv, err := GenerateKey(in.KeySpec)
+	if err != nil {
+		return nil, err
+	}
+	multiRegion := aws.ToBool(in.MultiRegion)
+	id, err := newKeyID(multiRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:           id,
+		ARN:          c.arn("key/" + id),
+		Spec:         in.KeySpec,
+		Usage:        usage,
+		Description:  aws.ToString(in.Description),
+		CreationDate: time.Now().UTC(),
+		Private:      priv,
+		MultiRegion:  multiRegion,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[id] = key
+	if err := c.saveState(); err != nil {
+		return nil, err
+	}
+	return &kms.CreateKeyOutput{KeyMetadata: c.metadata(key)}, nil
+}
+
+func (c *Client) CreateAlias(ctx context.Context, in *kms.CreateAliasInput, optFns ...func(*kms.Options)) (*kms.CreateAliasOutput, error) {
+	name := aws.ToString(in.AliasName)
+	if !strings.HasPrefix(name, "alias/") || strings.HasPrefix(name, "alias/aws/") {
+		return nil, &types.InvalidAliasNameException{Message: aws.String(fmt.Sprintf("nome de alias inválido: %s", name))}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.aliases[name]; ok {
+		return nil, &types.AlreadyExistsException{Message: aws.String(fmt.Sprintf("alias já existe: %s", name))}
+	}
+	target := c.lookup(aws.ToString(in.TargetKeyId))
+	if target == nil {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("chave não encontrada: %s", aws.ToString(in.TargetKeyId)))}
+	}
+	c.aliases[name] = &alias{name: name, targetKeyID: target.ID, creationDate: time.Now().UTC()}
+	if err := c.saveState(); err != nil {
+		return nil, err
+	}
+	return &kms.CreateAliasOutput{}, nil
+}
+
+func (c *Client) DescribeKey(ctx context.Context, in *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key := c.lookup(aws.ToString(in.KeyId))
+	if key == nil {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("chave não encontrada: %s", aws.ToString(in.KeyId)))}
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: c.metadata(key)}, nil
+}
+
+// Réplica de uma chave multirregião; o ARN da réplica é resolvido pelo mesmo
+// cliente, que assina com a chave da primária
+func (c *Client) ReplicateKey(ctx context.Context, in *kms.ReplicateKeyInput, optFns ...func(*kms.Options)) (*kms.ReplicateKeyOutput, error) {
+	region := aws.ToString(in.ReplicaRegion)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.lookup(aws.ToString(in.KeyId))
+	if key == nil {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("chave não encontrada: %s", aws.ToString(in.KeyId)))}
+	}
+	if !key.MultiRegion {
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("chave %s não é multirregião", key.ID))}
+	}
+	if region == "" || region == c.region || slices.Contains(key.Replicas, region) {
+		return nil, &types.AlreadyExistsException{Message: aws.String(fmt.Sprintf("chave %s já existe em %s", key.ID, region))}
+	}
+	key.Replicas = append(key.Replicas, region)
+	if err := c.saveState(); err != nil {
+		return nil, err
+	}
+
+	md := c.metadata(key)
+	md.Arn = aws.String(c.regionARN(region, "key/"+key.ID))
+	md.MultiRegionConfiguration.MultiRegionKeyType = types.MultiRegionKeyTypeReplica
+	return &kms.ReplicateKeyOutput{ReplicaKeyMetadata: md}, nil
+}
+
+// Lista todos os aliases (ou apenas os da chave em KeyId), sem paginação
+func (c *Client) ListAliases(ctx context.Context, in *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var filter string
+	if in.KeyId != nil {
+		key := c.lookup(aws.ToString(in.KeyId))
+		if key == nil {
+			return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("chave não encontrada: %s", aws.ToString(in.KeyId)))}
+		}
+		filter = key.ID
+	}
+
+	out := &kms.ListAliasesOutput{}
+	for _, a := range c.aliases {
+		if filter != "" && a.targetKeyID != filter {
+			continue
+		}
+		out.Aliases = append(out.Aliases, types.AliasListEntry{
+			AliasName:    aws.String(a.name),
+			AliasArn:     aws.String(c.arn(a.name)),
+			TargetKeyId:  aws.String(a.targetKeyID),
+			CreationDate: aws.Time(a.creationDate),
+		})
+	}
+	sort.Slice(out.Aliases, func(i, j int) bool {
+		return aws.ToString(out.Aliases[i].AliasName) < aws.ToString(out.Aliases[j].AliasName)
+	})
+	return out, nil
+}
+
+func (c *Client) metadata(key *Key) *types.KeyMetadata {
+	md := &types.KeyMetadata{
+		KeyId:                 aws.String(key.ID),
+		Arn:                   aws.String(key.ARN),
+		AWSAccountId:          aws.String(c.accountID),
+		CreationDate:          aws.Time(key.CreationDate),
+		Description:           aws.String(key.Description),
+		Enabled:               true,
+		KeyState:              types.KeyStateEnabled,
+		KeyUsage:              key.Usage,
+		KeySpec:               key.Spec,
+		CustomerMasterKeySpec: types.CustomerMasterKeySpec(key.Spec),
+		KeyManager:            types.KeyManagerTypeCustomer,
+		Origin:                types.OriginTypeAwsKms,
+	}
+	md.SigningAlgorithms, md.EncryptionAlgorithms, md.KeyAgreementAlgorithms = key.algorithms()
+	md.MultiRegion = aws.Bool(key.MultiRegion)
+	if key.MultiRegion {
+		md.MultiRegionConfiguration = &types.MultiRegionConfiguration{
+			MultiRegionKeyType: types.MultiRegionKeyTypePrimary,
+			PrimaryKey:         &types.MultiRegionKey{Arn: aws.String(key.ARN), Region: aws.String(c.region)},
+		}
+		for _, region := range key.Replicas {
+			md.MultiRegionConfiguration.ReplicaKeys = append(md.MultiRegionConfiguration.ReplicaKeys,
+				types.MultiRegionKey{Arn: aws.String(c.regionARN(region, "key/"+key.ID)), Region: aws.String(region)})
+		}
+	}
+	return md
+}
+
+func (c *Client) arn(resource string) string {
+	return c.regionARN(c.region, resource)
+}
+
+func (c *Client) regionARN(region, resource string) string {
+	return fmt.Sprintf("arn:aws:kms:%s:%s:%s", region, c.accountID, resource)
+}
+
+// KeyId no formato UUID usado pelo KMS; chaves multirregião usam mrk-<hex>
+func newKeyID(multiRegion bool) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	h := hex.EncodeToString(b)
+	if multiRegion {
+		return "mrk-" + h, nil
+	}
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:]), nil
+}
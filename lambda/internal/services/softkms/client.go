@@ -0,0 +1,356 @@
+package softkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+var _ jwtkms.KMSClient = (*Client)(nil)
+
+// Chave mantida em software, equivalente a uma chave assimétrica do KMS
+type Key struct {
+	ID           string
+	ARN          string
+	Spec         types.KeySpec
+	Usage        types.KeyUsageType
+	Description  string
+	CreationDate time.Time
+	Private      crypto.Signer
+	MultiRegion  bool
+	Replicas     []string // regiões das réplicas, que assinam com a mesma chave
+}
+
+// Client implementa jwtkms.KMSClient com chaves ECDSA/RSA geradas em memória
+// ou lidas do disco, permitindo rodar o serviço sem AWS.
+type Client struct {
+	mu          sync.RWMutex
+	keys        map[string]*Key
+	aliases     map[string]*alias
+	keyDir      string
+	stateFile   string
+	strict      bool
+	region      string
+	accountID   string
+	defaultSpec types.KeySpec
+	keySpecs    map[string]types.KeySpec
+	keyUsages   map[string]types.KeyUsageType
+}
+
+type alias struct {
+	name         string
+	targetKeyID  string
+	creationDate time.Time
+}
+
+type Option func(*Client)
+
+// Diretório onde as chaves são lidas e persistidas em PEM (PKCS#8)
+func WithKeyDir(dir string) Option {
+	return func(c *Client) { c.keyDir = dir }
+}
+
+// Spec usada ao gerar chaves não configuradas explicitamente
+func WithDefaultKeySpec(spec types.KeySpec) Option {
+	return func(c *Client) { c.defaultSpec = spec }
+}
+
+// Spec por KeyId, usada ao gerar a chave pela primeira vez
+func WithKeySpec(keyID string, spec types.KeySpec) Option {
+	return func(c *Client) { c.keySpecs[keyID] = spec }
+}
+
+// KeyUsage por KeyId, usado ao gerar ou carregar a chave (padrão: SIGN_VERIFY)
+func WithKeyUsage(keyID string, usage types.KeyUsageType) Option {
+	return func(c *Client) { c.keyUsages[keyID] = usage }
+}
+
+// Desliga a criação automática: KeyIds desconhecidos resultam em NotFoundException,
+// como no KMS real
+func WithStrictKeys() Option {
+	return func(c *Client) { c.strict = true }
+}
+
+// Região e conta usadas na composição dos ARNs
+func WithARNScope(region, accountID string) Option {
+	return func(c *Client) {
+		c.region = region
+		c.accountID = accountID
+	}
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		keys:        map[string]*Key{},
+		aliases:     map[string]*alias{},
+		region:      "us-east-1",
+		accountID:   "000000000000",
+		defaultSpec: types.KeySpecEccNistP256,
+		keySpecs:    map[string]types.KeySpec{},
+		keyUsages:   map[string]types.KeyUsageType{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Registra uma chave privada existente sob o KeyId informado
+func (c *Client) AddKey(keyID string, priv crypto.Signer) error {
+	spec, err := specOf(priv)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[keyID] = &Key{
+		ID:           keyID,
+		ARN:          keyID,
+		Spec:         spec,
+		Usage:        types.KeyUsageTypeSignVerify,
+		CreationDate: time.Now().UTC(),
+		Private:      priv,
+	}
+	return c.saveState()
+}
+
+// Recupera a chave pelo KeyId, ARN ou alias; sem WithStrictKeys, KeyIds desconhecidos
+// são carregados do disco ou gerados na primeira consulta
+func (c *Client) Key(keyID string) (*Key, error) {
+	c.mu.RLock()
+	key := c.lookup(keyID)
+	c.mu.RUnlock()
+	if key != nil {
+		return key, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key := c.lookup(keyID); key != nil {
+		return key, nil
+	}
+	if c.strict || keyID == "" {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("chave não encontrada: %s", keyID))}
+	}
+
+	priv, err := c.readKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if priv == nil {
+		spec, ok := c.keySpecs[keyID]
+		if !ok {
+			spec = c.defaultSpec
+		}
+		priv, err = GenerateKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.writeKey(keyID, priv); err != nil {
+			return nil, err
+		}
+	}
+
+	spec, err := specOf(priv)
+	if err != nil {
+		return nil, err
+	}
+	usage, ok := c.keyUsages[keyID]
+	if !ok {
+		usage = types.KeyUsageTypeSignVerify
+	}
+	key = &Key{
+		ID:           keyID,
+		ARN:          keyID,
+		Spec:         spec,
+		Usage:        usage,
+		CreationDate: time.Now().UTC(),
+		Private:      priv,
+	}
+	c.keys[keyID] = key
+	if err := c.saveState(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Resolve KeyId, ARN de chave, nome de alias ou ARN de alias; exige o lock
+func (c *Client) lookup(keyID string) *Key {
+	if key, ok := c.keys[keyID]; ok {
+		return key
+	}
+	name := keyID
+	if i := strings.Index(keyID, ":alias/"); i >= 0 {
+		name = keyID[i+1:]
+	}
+	if a, ok := c.aliases[name]; ok {
+		return c.keys[a.targetKeyID]
+	}
+	if i := strings.Index(keyID, ":key/"); i >= 0 {
+		return c.keys[keyID[i+len(":key/"):]]
+	}
+	return nil
+}
+
+func (c *Client) GetPublicKey(ctx context.Context, in *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	key, err := c.Key(aws.ToString(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Private.Public())
+	if err != nil {
+		return nil, err
+	}
+	out := &kms.GetPublicKeyOutput{
+		KeyId:     aws.String(key.ARN),
+		KeySpec:   key.Spec,
+		KeyUsage:  key.Usage,
+		PublicKey: der,
+	}
+	out.SigningAlgorithms, out.EncryptionAlgorithms, out.KeyAgreementAlgorithms = key.algorithms()
+	return out, nil
+}
+
+func (c *Client) Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	key, err := c.Key(aws.ToString(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	if key.Usage != types.KeyUsageTypeSignVerify {
+		return nil, invalidUsage(key)
+	}
+	digest, hash, err := digestFor(in.SigningAlgorithm, in.MessageType, in.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig []byte
+	switch priv := key.Private.(type) {
+	case *ecdsa.PrivateKey:
+		if !isECDSA(in.SigningAlgorithm) {
+			return nil, invalidAlgorithm(key, in.SigningAlgorithm)
+		}
+		sig, err = ecdsa.SignASN1(rand.Reader, priv, digest)
+	case *rsa.PrivateKey:
+		switch {
+		case isPSS(in.SigningAlgorithm):
+			sig, err = rsa.SignPSS(rand.Reader, priv, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		case isPKCS1(in.SigningAlgorithm):
+			sig, err = rsa.SignPKCS1v15(rand.Reader, priv, hash, digest)
+		default:
+			return nil, invalidAlgorithm(key, in.SigningAlgorithm)
+		}
+	default:
+		return nil, invalidAlgorithm(key, in.SigningAlgorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.SignOutput{
+		KeyId:            aws.String(key.ARN),
+		Signature:        sig,
+		SigningAlgorithm: in.SigningAlgorithm,
+	}, nil
+}
+
+// Assim como o KMS, uma assinatura inválida resulta em KMSInvalidSignatureException
+func (c *Client) Verify(ctx context.Context, in *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error) {
+	key, err := c.Key(aws.ToString(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	if key.Usage != types.KeyUsageTypeSignVerify {
+		return nil, invalidUsage(key)
+	}
+	digest, hash, err := digestFor(in.SigningAlgorithm, in.MessageType, in.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := false
+	switch pub := key.Private.Public().(type) {
+	case *ecdsa.PublicKey:
+		if !isECDSA(in.SigningAlgorithm) {
+			return nil, invalidAlgorithm(key, in.SigningAlgorithm)
+		}
+		valid = ecdsa.VerifyASN1(pub, digest, in.Signature)
+	case *rsa.PublicKey:
+		switch {
+		case isPSS(in.SigningAlgorithm):
+			valid = rsa.VerifyPSS(pub, hash, digest, in.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		case isPKCS1(in.SigningAlgorithm):
+			valid = rsa.VerifyPKCS1v15(pub, hash, digest, in.Signature) == nil
+		default:
+			return nil, invalidAlgorithm(key, in.SigningAlgorithm)
+		}
+	}
+	if !valid {
+		return nil, &types.KMSInvalidSignatureException{Message: aws.String("assinatura inválida")}
+	}
+
+	return &kms.VerifyOutput{
+		KeyId:            aws.String(key.ARN),
+		SignatureValid:   true,
+		SigningAlgorithm: in.SigningAlgorithm,
+	}, nil
+}
+
+// Decifra dados cifrados com a chave pública RSA (RSAES_OAEP_SHA_1 ou RSAES_OAEP_SHA_256)
+func (c *Client) Decrypt(ctx context.Context, in *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	key, err := c.Key(aws.ToString(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	if key.Usage != types.KeyUsageTypeEncryptDecrypt {
+		return nil, invalidUsage(key)
+	}
+	priv, ok := key.Private.(*rsa.PrivateKey)
+	if !ok {
+		return nil, invalidUsage(key)
+	}
+
+	var hash crypto.Hash
+	switch in.EncryptionAlgorithm {
+	case types.EncryptionAlgorithmSpecRsaesOaepSha1:
+		hash = crypto.SHA1
+	case types.EncryptionAlgorithmSpecRsaesOaepSha256:
+		hash = crypto.SHA256
+	default:
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("algoritmo não suportado: %s", in.EncryptionAlgorithm))}
+	}
+
+	plain, err := rsa.DecryptOAEP(hash.New(), rand.Reader, priv, in.CiphertextBlob, nil)
+	if err != nil {
+		return nil, &types.InvalidCiphertextException{Message: aws.String("não foi possível decifrar o ciphertext")}
+	}
+	return &kms.DecryptOutput{
+		KeyId:               aws.String(key.ARN),
+		Plaintext:           plain,
+		EncryptionAlgorithm: in.EncryptionAlgorithm,
+	}, nil
+}
+
+func invalidUsage(key *Key) error {
+	return &types.InvalidKeyUsageException{
+		Message: aws.String(fmt.Sprintf("operação incompatível com o KeyUsage %s da chave %s", key.Usage, key.ID)),
+	}
+}
+
+func invalidAlgorithm(key *Key, alg types.SigningAlgorithmSpec) error {
+	return &types.InvalidKeyUsageException{
+		Message: aws.String(fmt.Sprintf("algoritmo %s incompatível com a chave %s (%s)", alg, key.ID, key.Spec)),
+	}
+}
@@ -0,0 +1,158 @@
+package softkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matelang/jwt-go-aws-kms/v2/jwtkms"
+)
+
+func TestSignVerifyWithJWTKMS(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   types.KeySpec
+		method *jwtkms.KMSSigningMethod
+	}{
+		{"ES256", types.KeySpecEccNistP256, jwtkms.SigningMethodECDSA256},
+		{"ES384", types.KeySpecEccNistP384, jwtkms.SigningMethodECDSA384},
+		{"PS256", types.KeySpecRsa2048, jwtkms.SigningMethodPS256},
+		{"RS256", types.KeySpecRsa2048, jwtkms.SigningMethodRS256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New(WithKeySpec("alias/"+tt.name, tt.spec))
+			cfg := jwtkms.NewKMSConfig(client, "alias/"+tt.name, false)
+
+			signed, err := jwt.NewWithClaims(tt.method, jwt.MapClaims{"sub": "x"}).SignedString(cfg)
+			if err != nil {
+				t.Fatalf("erro ao assinar: %v", err)
+			}
+
+			out, err := client.GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String("alias/" + tt.name)})
+			if err != nil {
+				t.Fatalf("erro ao obter chave pública: %v", err)
+			}
+			if out.KeySpec != tt.spec {
+				t.Errorf("esperado spec %s, obtido %s", tt.spec, out.KeySpec)
+			}
+			pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+			if err != nil {
+				t.Fatalf("chave pública inválida: %v", err)
+			}
+			if _, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return pub, nil }); err != nil {
+				t.Errorf("assinatura não verificou com a chave pública: %v", err)
+			}
+
+			verifyCfg := jwtkms.NewKMSConfig(client, "alias/"+tt.name, true)
+			if _, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return verifyCfg, nil }); err != nil {
+				t.Errorf("Verify do KMS em software falhou: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_InvalidSignature(t *testing.T) {
+	client := New()
+	digest := make([]byte, 32)
+	_, err := client.Verify(context.Background(), &kms.VerifyInput{
+		KeyId:            aws.String("alias/x"),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		Signature:        []byte("invalida"),
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+	})
+	var invalid *types.KMSInvalidSignatureException
+	if !errors.As(err, &invalid) {
+		t.Errorf("esperado KMSInvalidSignatureException, obtido %v", err)
+	}
+}
+
+func TestSign_AlgorithmMismatch(t *testing.T) {
+	client := New()
+	_, err := client.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String("alias/ec"),
+		Message:          make([]byte, 32),
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecRsassaPssSha256,
+	})
+	var usage *types.InvalidKeyUsageException
+	if !errors.As(err, &usage) {
+		t.Errorf("esperado InvalidKeyUsageException, obtido %v", err)
+	}
+}
+
+func TestKeyDir_PersistsAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	first, err := New(WithKeyDir(dir)).GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("arn:aws:kms:us-east-1:1:alias/jwt")})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "arn_aws_kms_us-east-1_1_alias_jwt.pem")); err != nil {
+		t.Fatalf("chave não persistida: %v", err)
+	}
+
+	second, err := New(WithKeyDir(dir)).GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("arn:aws:kms:us-east-1:1:alias/jwt")})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if string(first.PublicKey) != string(second.PublicKey) {
+		t.Error("esperada a mesma chave após recarregar do disco")
+	}
+}
+
+func TestKeyDir_ReadsExistingPEM(t *testing.T) {
+	dir := t.TempDir()
+	priv, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(priv)
+	os.WriteFile(filepath.Join(dir, "alias_disk.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+
+	out, err := New(WithKeyDir(dir)).GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String("alias/disk")})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if out.KeySpec != types.KeySpecEccNistP384 {
+		t.Errorf("esperado ECC_NIST_P384, obtido %s", out.KeySpec)
+	}
+	want, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if string(out.PublicKey) != string(want) {
+		t.Error("chave pública não corresponde ao PEM do disco")
+	}
+}
+
+func TestWithKeyUsage_KeyAgreement(t *testing.T) {
+	ctx := context.Background()
+	client := New(WithKeyUsage("alias/jose", types.KeyUsageTypeKeyAgreement))
+
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("alias/jose")})
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if out.KeyUsage != types.KeyUsageTypeKeyAgreement || len(out.KeyAgreementAlgorithms) != 1 || len(out.SigningAlgorithms) != 0 {
+		t.Errorf("metadados inesperados para KEY_AGREEMENT: %+v", out)
+	}
+
+	_, err = client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String("alias/jose"),
+		Message:          make([]byte, 32),
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+	})
+	var usage *types.InvalidKeyUsageException
+	if !errors.As(err, &usage) {
+		t.Errorf("esperado InvalidKeyUsageException, obtido %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package softkms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Gera uma chave privada para a spec do KMS informada
+func GenerateKey(spec types.KeySpec) (crypto.Signer, error) {
+	switch spec {
+	case types.KeySpecEccNistP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case types.KeySpecEccNistP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case types.KeySpecEccNistP521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case types.KeySpecRsa2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case types.KeySpecRsa3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case types.KeySpecRsa4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("key spec não suportada: %s", spec))}
+	}
+}
+
+// Algoritmos de assinatura que o KMS anuncia para cada spec
+func SigningAlgorithms(spec types.KeySpec) []types.SigningAlgorithmSpec {
+	switch spec {
+	case types.KeySpecEccNistP256:
+		return []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256}
+	case types.KeySpecEccNistP384:
+		return []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha384}
+	case types.KeySpecEccNistP521:
+		return []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha512}
+	case types.KeySpecRsa2048, types.KeySpecRsa3072, types.KeySpecRsa4096:
+		return []types.SigningAlgorithmSpec{
+			types.SigningAlgorithmSpecRsassaPssSha256,
+			types.SigningAlgorithmSpecRsassaPssSha384,
+			types.SigningAlgorithmSpecRsassaPssSha512,
+			types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+			types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+			types.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+		}
+	default:
+		return nil
+	}
+}
+
+// Algoritmos de cifragem que o KMS anuncia para chaves ENCRYPT_DECRYPT
+func EncryptionAlgorithms(spec types.KeySpec) []types.EncryptionAlgorithmSpec {
+	switch spec {
+	case types.KeySpecRsa2048, types.KeySpecRsa3072, types.KeySpecRsa4096:
+		return []types.EncryptionAlgorithmSpec{
+			types.EncryptionAlgorithmSpecRsaesOaepSha1,
+			types.EncryptionAlgorithmSpecRsaesOaepSha256,
+		}
+	default:
+		return nil
+	}
+}
+
+// Algoritmos de acordo de chave para chaves KEY_AGREEMENT
+func KeyAgreementAlgorithms(spec types.KeySpec) []types.KeyAgreementAlgorithmSpec {
+	switch spec {
+	case types.KeySpecEccNistP256, types.KeySpecEccNistP384, types.KeySpecEccNistP521:
+		return []types.KeyAgreementAlgorithmSpec{types.KeyAgreementAlgorithmSpecEcdh}
+	default:
+		return nil
+	}
+}
+
+// Algoritmos anunciados conforme o KeyUsage da chave
+func (k *Key) algorithms() ([]types.SigningAlgorithmSpec, []types.EncryptionAlgorithmSpec, []types.KeyAgreementAlgorithmSpec) {
+	switch k.Usage {
+	case types.KeyUsageTypeEncryptDecrypt:
+		return nil, EncryptionAlgorithms(k.Spec), nil
+	case types.KeyUsageTypeKeyAgreement:
+		return nil, nil, KeyAgreementAlgorithms(k.Spec)
+	default:
+		return SigningAlgorithms(k.Spec), nil, nil
+	}
+}
+
+func specOf(priv crypto.Signer) (types.KeySpec, error) {
+	switch k := priv.(type) {
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return types.KeySpecEccNistP256, nil
+		case elliptic.P384():
+			return types.KeySpecEccNistP384, nil
+		case elliptic.P521():
+			return types.KeySpecEccNistP521, nil
+		}
+	case *rsa.PrivateKey:
+		switch k.N.BitLen() {
+		case 2048:
+			return types.KeySpecRsa2048, nil
+		case 3072:
+			return types.KeySpecRsa3072, nil
+		case 4096:
+			return types.KeySpecRsa4096, nil
+		}
+	}
+	return "", errors.New("tipo de chave privada não suportado")
+}
+
+func digestFor(alg types.SigningAlgorithmSpec, msgType types.MessageType, msg []byte) ([]byte, crypto.Hash, error) {
+	var hash crypto.Hash
+	switch alg {
+	case types.SigningAlgorithmSpecEcdsaSha256, types.SigningAlgorithmSpecRsassaPssSha256, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256:
+		hash = crypto.SHA256
+	case types.SigningAlgorithmSpecEcdsaSha384, types.SigningAlgorithmSpecRsassaPssSha384, types.SigningAlgorithmSpecRsassaPkcs1V15Sha384:
+		hash = crypto.SHA384
+	case types.SigningAlgorithmSpecEcdsaSha512, types.SigningAlgorithmSpecRsassaPssSha512, types.SigningAlgorithmSpecRsassaPkcs1V15Sha512:
+		hash = crypto.SHA512
+	default:
+		return nil, 0, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("algoritmo não suportado: %s", alg))}
+	}
+
+	if msgType == types.MessageTypeDigest {
+		if len(msg) != hash.Size() {
+			return nil, 0, errors.New("tamanho do digest incompatível com o algoritmo")
+		}
+		return msg, hash, nil
+	}
+	h := hash.New()
+	h.Write(msg)
+	return h.Sum(nil), hash, nil
+}
+
+func isECDSA(alg types.SigningAlgorithmSpec) bool {
+	return alg == types.SigningAlgorithmSpecEcdsaSha256 ||
+		alg == types.SigningAlgorithmSpecEcdsaSha384 ||
+		alg == types.SigningAlgorithmSpecEcdsaSha512
+}
+
+func isPSS(alg types.SigningAlgorithmSpec) bool {
+	return alg == types.SigningAlgorithmSpecRsassaPssSha256 ||
+		alg == types.SigningAlgorithmSpecRsassaPssSha384 ||
+		alg == types.SigningAlgorithmSpecRsassaPssSha512
+}
+
+func isPKCS1(alg types.SigningAlgorithmSpec) bool {
+	return alg == types.SigningAlgorithmSpecRsassaPkcs1V15Sha256 ||
+		alg == types.SigningAlgorithmSpecRsassaPkcs1V15Sha384 ||
+		alg == types.SigningAlgorithmSpecRsassaPkcs1V15Sha512
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func (c *Client) keyPath(keyID string) string {
+	return filepath.Join(c.keyDir, unsafeFileChars.ReplaceAllString(keyID, "_")+".pem")
+}
+
+// Lê a chave do disco; retorna nil sem erro quando o arquivo não existe
+func (c *Client) readKey(keyID string) (crypto.Signer, error) {
+	if c.keyDir == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(c.keyPath(keyID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+func (c *Client) writeKey(keyID string, priv crypto.Signer) error {
+	if c.keyDir == "" {
+		return nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.keyDir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.keyPath(keyID), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+}
+
+// Interpreta chaves privadas PEM em PKCS#8, SEC1 ou PKCS#1
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("PEM de chave privada inválido")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return asSigner(priv)
+	}
+}
+
+func asSigner(priv interface{}) (crypto.Signer, error) {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("tipo de chave privada não suportado")
+	}
+	return signer, nil
+}
@@ -0,0 +1,125 @@
+package softkms
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Formato do arquivo de estado: chaves em PKCS#8 e aliases
+type stateFile struct {
+	Keys    []stateKey   `json:"keys"`
+	Aliases []stateAlias `json:"aliases"`
+}
+
+type stateKey struct {
+	ID           string    `json:"key_id"`
+	ARN          string    `json:"arn"`
+	Spec         string    `json:"key_spec"`
+	Usage        string    `json:"key_usage"`
+	Description  string    `json:"description,omitempty"`
+	CreationDate time.Time `json:"creation_date"`
+	PrivateKey   []byte    `json:"private_key"`
+	MultiRegion  bool      `json:"multi_region,omitempty"`
+	Replicas     []string  `json:"replica_regions,omitempty"`
+}
+
+type stateAlias struct {
+	Name         string    `json:"alias_name"`
+	TargetKeyID  string    `json:"target_key_id"`
+	CreationDate time.Time `json:"creation_date"`
+}
+
+// Cria um cliente cujas chaves e aliases persistem no arquivo informado;
+// o arquivo é lido se existir e regravado a cada alteração
+func NewWithState(path string, opts ...Option) (*Client, error) {
+	c := New(opts...)
+	c.stateFile = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var st stateFile
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	for _, k := range st.Keys {
+		priv, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := asSigner(priv)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[k.ID] = &Key{
+			ID:           k.ID,
+			ARN:          k.ARN,
+			Spec:         types.KeySpec(k.Spec),
+			Usage:        types.KeyUsageType(k.Usage),
+			Description:  k.Description,
+			CreationDate: k.CreationDate,
+			Private:      signer,
+			MultiRegion:  k.MultiRegion,
+			Replicas:     k.Replicas,
+		}
+	}
+	for _, a := range st.Aliases {
+		c.aliases[a.Name] = &alias{name: a.Name, targetKeyID: a.TargetKeyID, creationDate: a.CreationDate}
+	}
+	return c, nil
+}
+
+// Grava o estado atual; exige o lock de escrita
+func (c *Client) saveState() error {
+	if c.stateFile == "" {
+		return nil
+	}
+
+	st := stateFile{Keys: []stateKey{}, Aliases: []stateAlias{}}
+	for _, k := range c.keys {
+		der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+		if err != nil {
+			return err
+		}
+		st.Keys = append(st.Keys, stateKey{
+			ID:           k.ID,
+			ARN:          k.ARN,
+			Spec:         string(k.Spec),
+			Usage:        string(k.Usage),
+			Description:  k.Description,
+			CreationDate: k.CreationDate,
+			PrivateKey:   der,
+			MultiRegion:  k.MultiRegion,
+			Replicas:     k.Replicas,
+		})
+	}
+	for _, a := range c.aliases {
+		st.Aliases = append(st.Aliases, stateAlias{Name: a.name, TargetKeyID: a.targetKeyID, CreationDate: a.creationDate})
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.stateFile); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	tmp := c.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.stateFile)
+}
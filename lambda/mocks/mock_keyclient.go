@@ -0,0 +1,122 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: lambda-ca-kms/internal/services/keymanager (interfaces: KeyClient)
+//
+// Generated by this command:
+//
+//	mockgen -destination=mocks/mock_keyclient.go -package=mocks -mock_names KeyClient=MockKeyClient lambda-ca-kms/internal/services/keymanager KeyClient
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	kms "github.com/aws/aws-sdk-go-v2/service/kms"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockKeyClient is a mock of KeyClient interface.
+type MockKeyClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockKeyClientMockRecorder
+	isgomock struct{}
+}
+
+// MockKeyClientMockRecorder is the mock recorder for MockKeyClient.
+type MockKeyClientMockRecorder struct {
+	mock *MockKeyClient
+}
+
+// NewMockKeyClient creates a new mock instance.
+func NewMockKeyClient(ctrl *gomock.Controller) *MockKeyClient {
+	mock := &MockKeyClient{ctrl: ctrl}
+	mock.recorder = &MockKeyClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockKeyClient) EXPECT() *MockKeyClientMockRecorder {
+	return m.recorder
+}
+
+// DescribeKey mocks base method.
+func (m *MockKeyClient) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DescribeKey", varargs...)
+	ret0, _ := ret[0].(*kms.DescribeKeyOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeKey indicates an expected call of DescribeKey.
+func (mr *MockKeyClientMockRecorder) DescribeKey(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeKey", reflect.TypeOf((*MockKeyClient)(nil).DescribeKey), varargs...)
+}
+
+// GetPublicKey mocks base method.
+func (m *MockKeyClient) GetPublicKey(ctx context.Context, in *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, in}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetPublicKey", varargs...)
+	ret0, _ := ret[0].(*kms.GetPublicKeyOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPublicKey indicates an expected call of GetPublicKey.
+func (mr *MockKeyClientMockRecorder) GetPublicKey(ctx, in any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, in}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublicKey", reflect.TypeOf((*MockKeyClient)(nil).GetPublicKey), varargs...)
+}
+
+// Sign mocks base method.
+func (m *MockKeyClient) Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, in}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Sign", varargs...)
+	ret0, _ := ret[0].(*kms.SignOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Sign indicates an expected call of Sign.
+func (mr *MockKeyClientMockRecorder) Sign(ctx, in any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, in}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockKeyClient)(nil).Sign), varargs...)
+}
+
+// Verify mocks base method.
+func (m *MockKeyClient) Verify(ctx context.Context, in *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, in}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Verify", varargs...)
+	ret0, _ := ret[0].(*kms.VerifyOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockKeyClientMockRecorder) Verify(ctx, in any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, in}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockKeyClient)(nil).Verify), varargs...)
+}